@@ -0,0 +1,336 @@
+// Package bot verifies that addresses belong to search engine and other
+// crawlers, using the IP ranges the operators publish and forward-confirmed
+// reverse DNS: the hostname of the address must be in one of the crawler's
+// domains and resolve back to the address.
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iputil"
+	"github.com/apimgr/echoip/src/iputil/iprange"
+	"github.com/apimgr/echoip/src/iputil/subnet"
+)
+
+// Bot describes a crawler and how to recognize it.
+type Bot struct {
+	Name string
+	// UserAgents are substrings of the User-Agent of the crawler, matched
+	// case-insensitively.
+	UserAgents []string
+	// Domains hold the hostnames of the crawler's addresses.
+	Domains []string
+	// Ranges is where the crawler's published IP ranges are downloaded
+	// from, if it publishes them.
+	Ranges geoip.Source
+}
+
+// DefaultBots returns the major search engine crawlers and crawlers that
+// publish their IP ranges.
+func DefaultBots() []Bot {
+	return []Bot{
+		{
+			Name:       "Googlebot",
+			UserAgents: []string{"Googlebot", "Storebot-Google", "Google-InspectionTool", "GoogleOther", "AdsBot-Google"},
+			Domains:    []string{"googlebot.com", "google.com"},
+			Ranges:     geoip.Source{URLs: []string{"https://developers.google.com/static/search/apis/ipranges/googlebot.json"}},
+		},
+		{
+			Name:       "Bingbot",
+			UserAgents: []string{"bingbot", "BingPreview", "msnbot", "adidxbot"},
+			Domains:    []string{"search.msn.com"},
+			Ranges:     geoip.Source{URLs: []string{"https://www.bing.com/toolbox/bingbot.json"}},
+		},
+		{
+			Name:       "Applebot",
+			UserAgents: []string{"Applebot"},
+			Domains:    []string{"applebot.apple.com"},
+			Ranges:     geoip.Source{URLs: []string{"https://search.developer.apple.com/applebot.json"}},
+		},
+		{
+			Name:       "GPTBot",
+			UserAgents: []string{"GPTBot"},
+			Ranges:     geoip.Source{URLs: []string{"https://openai.com/gptbot.json"}},
+		},
+		{
+			Name:       "YandexBot",
+			UserAgents: []string{"YandexBot", "YandexImages", "YandexMobileBot"},
+			Domains:    []string{"yandex.ru", "yandex.net", "yandex.com"},
+		},
+		{
+			Name:       "Baiduspider",
+			UserAgents: []string{"Baiduspider"},
+			Domains:    []string{"baidu.com", "baidu.jp"},
+		},
+		{
+			Name:       "Yahoo! Slurp",
+			UserAgents: []string{"Slurp"},
+			Domains:    []string{"crawl.yahoo.net"},
+		},
+	}
+}
+
+// ParseRanges reads IP ranges in the format Google, Bing, Apple and OpenAI
+// publish them in, an object whose prefixes member lists objects with an
+// ipv4Prefix or ipv6Prefix.
+func ParseRanges(r io.Reader) ([]*net.IPNet, error) {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Prefixes) == 0 {
+		return nil, fmt.Errorf("no prefixes found")
+	}
+	var networks []*net.IPNet
+	for _, p := range doc.Prefixes {
+		prefix := p.IPv4Prefix
+		if prefix == "" {
+			prefix = p.IPv6Prefix
+		}
+		n, err := subnet.Parse(prefix)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// cacheTTL is how long verification results are cached.
+const cacheTTL = time.Hour
+
+// cacheSize is the maximum number of cached verification results.
+const cacheSize = 10000
+
+// lookupTimeout limits the DNS lookups of a verification.
+const lookupTimeout = 5 * time.Second
+
+// table holds the published ranges of a bot.
+type table struct {
+	name     string
+	networks iprange.Table[struct{}]
+}
+
+func (t *table) Len() int {
+	return t.networks.Len()
+}
+
+// result is a cached verification.
+type result struct {
+	name    string
+	expires time.Time
+}
+
+// Verifier verifies crawler addresses. Published ranges are downloaded to a
+// data directory by the embedded FileSet, and verification results are
+// cached.
+type Verifier struct {
+	*geoip.FileSet[*table]
+	dir      string
+	resolver *net.Resolver
+	bots     []Bot
+	cacheMu  sync.Mutex
+	cache    map[string]result
+}
+
+// NewVerifier creates a Verifier storing published ranges in the bots
+// subdirectory of dataDir. Ranges are downloaded with downloader, and DNS
+// lookups use resolver, or the default resolver if it is nil.
+func NewVerifier(dataDir string, downloader *geoip.Downloader, resolver *net.Resolver) *Verifier {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	v := &Verifier{
+		FileSet:  geoip.NewFileSet[*table](downloader),
+		dir:      filepath.Join(dataDir, "bots"),
+		resolver: resolver,
+		cache:    make(map[string]result),
+	}
+	// Results may depend on the published ranges
+	v.OnUpdate(v.clearCache)
+	return v
+}
+
+// Add configures a bot. Bots are matched in the order they were added.
+func (v *Verifier) Add(b Bot) error {
+	if b.Name == "" {
+		return fmt.Errorf("bot without name")
+	}
+	if len(b.Domains) == 0 && len(b.Ranges.URLs) == 0 {
+		return fmt.Errorf("no domains or ranges for bot %s", b.Name)
+	}
+	for _, other := range v.bots {
+		if strings.EqualFold(other.Name, b.Name) {
+			return fmt.Errorf("duplicate bot: %s", b.Name)
+		}
+	}
+	v.bots = append(v.bots, b)
+	if len(b.Ranges.URLs) > 0 {
+		spec := geoip.FileSpec{Name: "ranges of " + b.Name, File: v.file(b), Source: b.Ranges}
+		v.FileSet.Add(spec, func(file string) (*table, error) {
+			return loadTable(b.Name, file)
+		})
+	}
+	return nil
+}
+
+// Bots returns the configured bots.
+func (v *Verifier) Bots() []Bot {
+	return v.bots
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func (v *Verifier) file(b Bot) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(strings.ToLower(b.Name), "-"), "-")
+	return filepath.Join(v.dir, name+".json")
+}
+
+func loadTable(name, file string) (*table, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	networks, err := ParseRanges(f)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{name: name}
+	for _, n := range subnet.Aggregate(networks) {
+		if err := t.networks.AddNetwork(n, struct{}{}); err != nil {
+			return nil, err
+		}
+	}
+	t.networks.Sort()
+	return t, nil
+}
+
+func (v *Verifier) clearCache() {
+	v.cacheMu.Lock()
+	defer v.cacheMu.Unlock()
+	v.cache = make(map[string]result)
+}
+
+// Claimed returns the name of the bot userAgent claims to be, if any.
+func (v *Verifier) Claimed(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+	for _, b := range v.bots {
+		for _, token := range b.UserAgents {
+			if strings.Contains(userAgent, strings.ToLower(token)) {
+				return b.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Verify returns the name of the bot ip belongs to and true if it can be
+// verified. Otherwise, it returns the name of the bot userAgent claims to be,
+// if any, and false.
+func (v *Verifier) Verify(ip net.IP, userAgent string) (string, bool) {
+	if name := v.verify(ip); name != "" {
+		return name, true
+	}
+	return v.Claimed(userAgent), false
+}
+
+// verify returns the name of the bot ip belongs to, or an empty string if it
+// does not belong to one.
+func (v *Verifier) verify(ip net.IP) string {
+	key := ip.String()
+	now := time.Now()
+	v.cacheMu.Lock()
+	r, ok := v.cache[key]
+	v.cacheMu.Unlock()
+	if ok && now.Before(r.expires) {
+		return r.name
+	}
+	if name := v.lookupRanges(ip); name != "" {
+		return name
+	}
+	name, err := v.lookupDNS(ip)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		// Do not cache failures that may be temporary
+		return ""
+	}
+	v.cacheMu.Lock()
+	defer v.cacheMu.Unlock()
+	if len(v.cache) >= cacheSize {
+		for k, r := range v.cache {
+			if now.After(r.expires) {
+				delete(v.cache, k)
+			}
+		}
+		if len(v.cache) >= cacheSize {
+			v.cache = make(map[string]result)
+		}
+	}
+	v.cache[key] = result{name: name, expires: now.Add(cacheTTL)}
+	return name
+}
+
+func (v *Verifier) lookupRanges(ip net.IP) string {
+	for _, t := range v.Values() {
+		if _, _, ok := t.networks.Lookup(ip); ok {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// lookupDNS returns the name of the bot whose domains hold the hostname of
+// ip, if the hostname resolves back to ip.
+func (v *Verifier) lookupDNS(ip net.IP) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	hostname, err := iputil.LookupAddrContext(ctx, v.resolver, ip)
+	if err != nil || hostname == "" {
+		return "", err
+	}
+	b := v.botForHost(hostname)
+	if b == nil {
+		return "", nil
+	}
+	addrs, err := v.resolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if addr.IP.Equal(ip) {
+			return b.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// botForHost returns the bot whose domains hold hostname.
+func (v *Verifier) botForHost(hostname string) *Bot {
+	hostname = strings.ToLower(hostname)
+	for i := range v.bots {
+		for _, domain := range v.bots[i].Domains {
+			if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+				return &v.bots[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iputil"
+)
+
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeAAAA = 28
+)
+
+// stubDNS answers A, AAAA and PTR queries from a fixed zone.
+type stubDNS struct {
+	conn    net.PacketConn
+	ptr     map[string]string
+	addrs   map[string][]net.IP
+	queries atomic.Int32
+}
+
+func newStubDNS(t *testing.T, ptr map[string]string, addrs map[string][]net.IP) *stubDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubDNS{conn: conn, ptr: make(map[string]string), addrs: addrs}
+	for ip, name := range ptr {
+		s.ptr[iputil.ReversePointer(net.ParseIP(ip))] = name
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+// resolver returns a resolver sending all queries to s.
+func (s *stubDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *stubDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *stubDNS) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// Read the name of the only question
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	if i+5 > len(query) {
+		return nil
+	}
+	question := query[12 : i+5]
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	name := strings.ToLower(strings.Join(labels, "."))
+	s.queries.Add(1)
+
+	var answers [][]byte
+	exists := false
+	if target, ok := s.ptr[name]; ok {
+		exists = true
+		if qtype == typePTR {
+			answers = append(answers, encodeName(target+"."))
+		}
+	}
+	if ips, ok := s.addrs[name]; ok {
+		exists = true
+		for _, ip := range ips {
+			if ip4 := ip.To4(); ip4 != nil && qtype == typeA {
+				answers = append(answers, ip4)
+			} else if ip4 == nil && qtype == typeAAAA {
+				answers = append(answers, ip.To16())
+			}
+		}
+	}
+	resp := make([]byte, 12, 512)
+	copy(resp, query[:2])
+	flags := uint16(0x8180) // Response, recursion desired and available
+	if !exists {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, question...)
+	for _, rdata := range answers {
+		// Pointer to the name in the question
+		resp = append(resp, 0xc0, 12)
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, 1)
+		resp = binary.BigEndian.AppendUint32(resp, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+	return resp
+}
+
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func TestParseRanges(t *testing.T) {
+	in := `{"creationTime":"2025-01-01T00:00:00.000000","prefixes":[{"ipv6Prefix":"2001:4860:4801:10::/64"},{"ipv4Prefix":"66.249.64.0/27"}]}`
+	networks, err := ParseRanges(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 2 || networks[0].String() != "2001:4860:4801:10::/64" || networks[1].String() != "66.249.64.0/27" {
+		t.Errorf("ParseRanges = %v, want 2001:4860:4801:10::/64 and 66.249.64.0/27", networks)
+	}
+	for _, in := range []string{`{}`, `<html>`, `{"prefixes":[{"ipv4Prefix":"bogus"}]}`} {
+		if _, err := ParseRanges(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseRanges(%s) succeeded, want error", in)
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dns := newStubDNS(t,
+		map[string]string{
+			"66.249.66.1":    "crawl-66-249-66-1.googlebot.com",
+			"2001:db8::1":    "crawl-2001-db8--1.googlebot.com",
+			"157.55.39.1":    "msnbot-157-55-39-1.search.msn.com",
+			"192.0.2.10":     "crawl-192-0-2-10.googlebot.com",
+			"192.0.2.11":     "crawl.notgooglebot.com",
+			"198.51.100.200": "crawl.example.com",
+		},
+		map[string][]net.IP{
+			"crawl-66-249-66-1.googlebot.com":   {net.ParseIP("66.249.66.1")},
+			"crawl-2001-db8--1.googlebot.com":   {net.ParseIP("2001:db8::1")},
+			"msnbot-157-55-39-1.search.msn.com": {net.ParseIP("157.55.39.1")},
+			// Spoofed PTR record pointing into a crawler's domain
+			"crawl-192-0-2-10.googlebot.com": {net.ParseIP("203.0.113.5")},
+			"crawl.notgooglebot.com":         {net.ParseIP("192.0.2.11")},
+		})
+	// Ranges that are already in the data directory are not downloaded
+	dataDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dataDir, "bots"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ranges := `{"prefixes":[{"ipv4Prefix":"198.51.100.0/25"}]}`
+	if err := os.WriteFile(filepath.Join(dataDir, "bots", "googlebot.json"), []byte(ranges), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(dataDir, nil, dns.resolver())
+	bots := DefaultBots()[:2]
+	bots[0].Ranges = geoip.Source{URLs: []string{"http://ranges.invalid/googlebot.json"}}
+	bots[1].Ranges = geoip.Source{}
+	for _, b := range bots {
+		if err := v.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, b := range []Bot{{Name: "googlebot", Domains: []string{"googlebot.com"}}, {Name: "nowhere"}, {}} {
+		if err := v.Add(b); err == nil {
+			t.Errorf("Add(%+v) succeeded, want error", b)
+		}
+	}
+	if err := v.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	googlebot := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	var tests = []struct {
+		ip        string
+		userAgent string
+		name      string
+		verified  bool
+	}{
+		{"66.249.66.1", "", "Googlebot", true},
+		{"2001:db8::1", googlebot, "Googlebot", true},
+		{"157.55.39.1", "", "Bingbot", true},
+		{"198.51.100.1", "", "Googlebot", true},
+		{"192.0.2.10", googlebot, "Googlebot", false},
+		{"192.0.2.10", "", "", false},
+		{"192.0.2.11", "", "", false},
+		{"192.0.2.12", "Mozilla/5.0 (compatible; bingbot/2.0)", "Bingbot", false},
+		{"198.51.100.200", "curl/8.0", "", false},
+	}
+	for _, tt := range tests {
+		name, verified := v.Verify(net.ParseIP(tt.ip), tt.userAgent)
+		if name != tt.name || verified != tt.verified {
+			t.Errorf("Verify(%s, %q) = %q, %t, want %q, %t", tt.ip, tt.userAgent, name, verified, tt.name, tt.verified)
+		}
+	}
+
+	// Results are cached, and published ranges need no DNS lookups
+	queries := dns.queries.Load()
+	for _, ip := range []string{"66.249.66.1", "192.0.2.10", "192.0.2.12", "198.51.100.2"} {
+		v.Verify(net.ParseIP(ip), "")
+	}
+	if got := dns.queries.Load(); got != queries {
+		t.Errorf("Expected cached results, got %d more DNS queries", got-queries)
+	}
+}
@@ -0,0 +1,117 @@
+// Package cloud tags addresses with the cloud provider, region and service
+// they belong to, using the IP range feeds the providers publish. Feeds are
+// downloaded from configurable URLs and refreshed periodically, or read from
+// local files for offline deployments.
+package cloud
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/apimgr/echoip/src/geoip"
+)
+
+// Feed describes a provider's range feed and where to get it from.
+type Feed struct {
+	// Provider is reported for addresses in the feed and selects its format.
+	Provider string
+	// Source is where to download the feed from.
+	Source geoip.Source
+	// File, if set, is a local copy of the feed that is read instead of
+	// downloading it. It is reloaded when it changes.
+	File string
+}
+
+// DefaultFeeds returns the feeds of AWS, Google Cloud, Oracle Cloud and
+// Cloudflare. Azure publishes its service tags under a URL that changes every
+// week, so its feed must be configured explicitly.
+func DefaultFeeds() []Feed {
+	return []Feed{
+		{Provider: AWS, Source: geoip.Source{URLs: []string{"https://ip-ranges.amazonaws.com/ip-ranges.json"}}},
+		{Provider: GCP, Source: geoip.Source{URLs: []string{"https://www.gstatic.com/ipranges/cloud.json"}}},
+		{Provider: Oracle, Source: geoip.Source{URLs: []string{"https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json"}}},
+		{Provider: Cloudflare, Source: geoip.Source{URLs: []string{"https://www.cloudflare.com/ips-v4"}}},
+		{Provider: Cloudflare, Source: geoip.Source{URLs: []string{"https://www.cloudflare.com/ips-v6"}}},
+	}
+}
+
+var validProvider = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+func loadIndex(provider, file string) (*Index, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := &Index{}
+	if err := Parse(provider, f, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Manager downloads feeds to a data directory and looks up addresses in them.
+// The embedded FileSet initializes, updates and reloads the feeds.
+type Manager struct {
+	*geoip.FileSet[*Index]
+	dir   string
+	feeds []Feed
+}
+
+// NewManager creates a Manager storing feeds in the cloud subdirectory of
+// dataDir. Feeds are downloaded with downloader.
+func NewManager(dataDir string, downloader *geoip.Downloader) *Manager {
+	return &Manager{FileSet: geoip.NewFileSet[*Index](downloader), dir: filepath.Join(dataDir, "cloud")}
+}
+
+// Add configures a feed. A provider may have several feeds, e.g. one for each
+// address family.
+func (m *Manager) Add(f Feed) error {
+	if !validProvider.MatchString(f.Provider) {
+		return fmt.Errorf("invalid cloud provider: %q", f.Provider)
+	}
+	if f.File == "" && len(f.Source.URLs) == 0 {
+		return fmt.Errorf("no URL or file for cloud provider %s", f.Provider)
+	}
+	name := f.Provider
+	count := 0
+	for _, other := range m.feeds {
+		if other.Provider == f.Provider {
+			count++
+		}
+	}
+	if count > 0 {
+		name = fmt.Sprintf("%s-%d", f.Provider, count+1)
+	}
+	m.feeds = append(m.feeds, f)
+	spec := geoip.FileSpec{Name: "cloud ranges of " + name, File: f.File}
+	if f.File == "" {
+		spec.File, spec.Source = filepath.Join(m.dir, name+".data"), f.Source
+	}
+	m.FileSet.Add(spec, func(file string) (*Index, error) {
+		return loadIndex(f.Provider, file)
+	})
+	return nil
+}
+
+// Feeds returns the configured feeds.
+func (m *Manager) Feeds() []Feed {
+	return m.feeds
+}
+
+// Lookup returns the range of the most specific network containing ip across
+// all feeds. Of equally specific networks, the one with more detail wins.
+func (m *Manager) Lookup(ip net.IP) (Range, bool) {
+	var found Range
+	best := -1
+	for _, idx := range m.Values() {
+		r, ones, ok := idx.lookup(ip)
+		if ok && (ones > best || (ones == best && r.detail() > found.detail())) {
+			found, best = r, ones
+		}
+	}
+	return found, best >= 0
+}
@@ -0,0 +1,171 @@
+package cloud
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	var idx Index
+	for _, tt := range []struct {
+		cidr string
+		r    Range
+	}{
+		{"10.0.0.0/8", Range{Provider: "a"}},
+		{"10.1.0.0/16", Range{Provider: "a", Region: "r1"}},
+		{"10.1.2.0/24", Range{Provider: "a", Region: "r1"}},
+		{"10.1.2.0/24", Range{Provider: "a", Region: "r1", Service: "s1"}},
+		{"10.1.2.0/24", Range{Provider: "a"}},
+		{"2001:db8::/32", Range{Provider: "b"}},
+	} {
+		if err := idx.AddCIDR(tt.cidr, tt.r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := idx.AddCIDR("10.0.0.0/33", Range{}); err == nil {
+		t.Error("AddCIDR succeeded with an invalid network")
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Len = %d, want 4", idx.Len())
+	}
+	var tests = []struct {
+		ip   string
+		want Range
+		ok   bool
+	}{
+		{"10.2.0.1", Range{Provider: "a"}, true},
+		{"10.1.3.1", Range{Provider: "a", Region: "r1"}, true},
+		{"10.1.2.3", Range{Provider: "a", Region: "r1", Service: "s1"}, true},
+		{"2001:db8::1", Range{Provider: "b"}, true},
+		{"11.0.0.1", Range{}, false},
+		{"::ffff:10.1.2.3", Range{Provider: "a", Region: "r1", Service: "s1"}, true},
+	}
+	for _, tt := range tests {
+		got, ok := idx.Lookup(net.ParseIP(tt.ip))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%s) = %+v, %t, want %+v, %t", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+var feeds = map[string]string{
+	AWS: `{"syncToken":"1","prefixes":[
+{"ip_prefix":"3.5.140.0/22","region":"ap-northeast-2","service":"AMAZON","network_border_group":"ap-northeast-2"},
+{"ip_prefix":"3.5.140.0/22","region":"ap-northeast-2","service":"S3","network_border_group":"ap-northeast-2"},
+{"ip_prefix":"15.230.0.0/16","region":"GLOBAL","service":"AMAZON","network_border_group":"GLOBAL"}],
+"ipv6_prefixes":[{"ipv6_prefix":"2600:1f14::/35","region":"us-west-2","service":"EC2","network_border_group":"us-west-2"}]}`,
+	GCP: `{"syncToken":"1","prefixes":[
+{"ipv4Prefix":"34.1.208.0/20","service":"Google Cloud","scope":"africa-south1"},
+{"ipv6Prefix":"2600:1900:8000::/44","service":"Google Cloud","scope":"global"}]}`,
+	Azure: `{"changeNumber":1,"cloud":"Public","values":[
+{"name":"AzureCloud","id":"AzureCloud","properties":{"region":"","platform":"Azure","systemService":"","addressPrefixes":["20.33.0.0/16"]}},
+{"name":"AzureCloud.eastus","id":"AzureCloud.eastus","properties":{"region":"eastus","platform":"Azure","systemService":"","addressPrefixes":["20.33.0.0/24"]}},
+{"name":"Storage.EastUS","id":"Storage.EastUS","properties":{"region":"eastus","platform":"Azure","systemService":"AzureStorage","addressPrefixes":["20.33.0.0/24","2603:1030::/48"]}}]}`,
+	Oracle: `{"last_updated_timestamp":"2025-01-01T00:00:00","regions":[
+{"region":"us-phoenix-1","cidrs":[{"cidr":"129.146.0.0/21","tags":["OCI"]},{"cidr":"134.70.8.0/21","tags":["OSN","OBJECT_STORAGE"]}]}]}`,
+	Cloudflare: "173.245.48.0/20\n2400:cb00::/32\n",
+}
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		provider string
+		ip       string
+		want     Range
+	}{
+		{AWS, "3.5.140.1", Range{AWS, "ap-northeast-2", "S3"}},
+		{AWS, "15.230.1.1", Range{AWS, "GLOBAL", ""}},
+		{AWS, "2600:1f14::1", Range{AWS, "us-west-2", "EC2"}},
+		{GCP, "34.1.208.1", Range{GCP, "africa-south1", "Google Cloud"}},
+		{GCP, "2600:1900:8000::1", Range{GCP, "", "Google Cloud"}},
+		{Azure, "20.33.1.1", Range{Azure, "", ""}},
+		{Azure, "20.33.0.1", Range{Azure, "eastus", "AzureStorage"}},
+		{Azure, "2603:1030::1", Range{Azure, "eastus", "AzureStorage"}},
+		{Oracle, "129.146.0.1", Range{Oracle, "us-phoenix-1", "OCI"}},
+		{Oracle, "134.70.8.1", Range{Oracle, "us-phoenix-1", "OSN,OBJECT_STORAGE"}},
+		{Cloudflare, "173.245.48.1", Range{Provider: Cloudflare}},
+		{Cloudflare, "2400:cb00::1", Range{Provider: Cloudflare}},
+	}
+	indexes := make(map[string]*Index)
+	for provider, feed := range feeds {
+		idx := &Index{}
+		if err := Parse(provider, strings.NewReader(feed), idx); err != nil {
+			t.Fatalf("Parse(%s): %s", provider, err)
+		}
+		indexes[provider] = idx
+	}
+	for _, tt := range tests {
+		if got, _ := indexes[tt.provider].Lookup(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Lookup(%s) in %s = %+v, want %+v", tt.ip, tt.provider, got, tt.want)
+		}
+	}
+	for _, provider := range []string{AWS, GCP, Azure, Oracle} {
+		if err := Parse(provider, strings.NewReader("{}"), &Index{}); err == nil {
+			t.Errorf("Parse(%s) succeeded without ranges", provider)
+		}
+		if err := Parse(provider, strings.NewReader("<html>"), &Index{}); err == nil {
+			t.Errorf("Parse(%s) succeeded with HTML", provider)
+		}
+	}
+	if err := Parse(AWS, strings.NewReader(`{"prefixes":[{"ip_prefix":"bogus"}]}`), &Index{}); err == nil || !strings.Contains(err.Error(), "invalid aws range") {
+		t.Errorf("Parse of invalid prefix: got %v, want invalid aws range", err)
+	}
+}
+
+func TestManager(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir := t.TempDir()
+	local := func(name, feed string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(feed), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	m := NewManager(t.TempDir(), nil)
+	for _, f := range []Feed{
+		{Provider: AWS, File: local("ip-ranges.json", feeds[AWS])},
+		{Provider: Cloudflare, File: local("ips-v4", "173.245.48.0/20\n")},
+		{Provider: Cloudflare, File: local("ips-v6", "2400:cb00::/32\n")},
+		{Provider: Azure, File: local("ServiceTags_Public.json", feeds[Azure])},
+	} {
+		if err := m.Add(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []Feed{
+		{Provider: "../etc", File: filepath.Join(dir, "ips-v4")},
+		{Provider: "AWS", File: filepath.Join(dir, "ips-v4")},
+		{Provider: GCP},
+	} {
+		if err := m.Add(f); err == nil {
+			t.Errorf("Add(%+v) succeeded, want error", f)
+		}
+	}
+	if err := m.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		ip   string
+		want Range
+		ok   bool
+	}{
+		{"3.5.140.1", Range{AWS, "ap-northeast-2", "S3"}, true},
+		{"173.245.48.1", Range{Provider: Cloudflare}, true},
+		{"2400:cb00::1", Range{Provider: Cloudflare}, true},
+		{"20.33.0.1", Range{Azure, "eastus", "AzureStorage"}, true},
+		{"20.33.1.1", Range{Azure, "", ""}, true},
+		{"192.0.2.1", Range{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := m.Lookup(net.ParseIP(tt.ip))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%s) = %+v, %t, want %+v, %t", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+}
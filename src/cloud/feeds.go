@@ -0,0 +1,182 @@
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iplist"
+)
+
+// Provider names, which select the format of their feeds. Feeds of other
+// providers are lists of networks in CIDR notation.
+const (
+	AWS        = "aws"
+	GCP        = "gcp"
+	Azure      = "azure"
+	Oracle     = "oracle"
+	Cloudflare = "cloudflare"
+)
+
+// parsers read the published range documents of the providers.
+var parsers = map[string]func(io.Reader, *Index) error{
+	AWS:    parseAWS,
+	GCP:    parseGCP,
+	Azure:  parseAzure,
+	Oracle: parseOracle,
+}
+
+// Parse reads a feed of provider into idx.
+func Parse(provider string, r io.Reader, idx *Index) error {
+	if parse, ok := parsers[provider]; ok {
+		return parse(r, idx)
+	}
+	networks, err := iplist.Parse(r)
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		idx.Add(n, Range{Provider: provider})
+	}
+	return nil
+}
+
+// addPrefix adds the network prefix to idx, reporting the provider as the
+// source of the error if prefix is invalid.
+func addPrefix(idx *Index, prefix string, r Range) error {
+	if err := idx.AddCIDR(prefix, r); err != nil {
+		return fmt.Errorf("invalid %s range: %w", r.Provider, err)
+	}
+	return nil
+}
+
+// parseAWS reads https://ip-ranges.amazonaws.com/ip-ranges.json, which lists
+// every prefix for the service AMAZON and again for the specific service
+// using it, if any.
+func parseAWS(r io.Reader, idx *Index) error {
+	var doc struct {
+		Prefixes []struct {
+			Prefix  string `json:"ip_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			Prefix  string `json:"ipv6_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Prefixes) == 0 && len(doc.IPv6Prefixes) == 0 {
+		return fmt.Errorf("no AWS prefixes found")
+	}
+	service := func(s string) string {
+		if s == "AMAZON" {
+			return ""
+		}
+		return s
+	}
+	for _, p := range doc.Prefixes {
+		if err := addPrefix(idx, p.Prefix, Range{AWS, p.Region, service(p.Service)}); err != nil {
+			return err
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		if err := addPrefix(idx, p.Prefix, Range{AWS, p.Region, service(p.Service)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseGCP reads https://www.gstatic.com/ipranges/cloud.json.
+func parseGCP(r io.Reader, idx *Index) error {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Prefixes) == 0 {
+		return fmt.Errorf("no GCP prefixes found")
+	}
+	for _, p := range doc.Prefixes {
+		prefix := p.IPv4Prefix
+		if prefix == "" {
+			prefix = p.IPv6Prefix
+		}
+		region := p.Scope
+		if region == "global" {
+			region = ""
+		}
+		if err := addPrefix(idx, prefix, Range{GCP, region, p.Service}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseAzure reads the weekly Azure IP Ranges and Service Tags file, in which
+// tags for all of Azure, its regions and its services overlap.
+func parseAzure(r io.Reader, idx *Index) error {
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Values) == 0 {
+		return fmt.Errorf("no Azure service tags found")
+	}
+	for _, v := range doc.Values {
+		for _, prefix := range v.Properties.AddressPrefixes {
+			if err := addPrefix(idx, prefix, Range{Azure, v.Properties.Region, v.Properties.SystemService}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseOracle reads
+// https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json.
+func parseOracle(r io.Reader, idx *Index) error {
+	var doc struct {
+		Regions []struct {
+			Region string `json:"region"`
+			CIDRs  []struct {
+				CIDR string   `json:"cidr"`
+				Tags []string `json:"tags"`
+			} `json:"cidrs"`
+		} `json:"regions"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return err
+	}
+	if len(doc.Regions) == 0 {
+		return fmt.Errorf("no Oracle regions found")
+	}
+	for _, region := range doc.Regions {
+		for _, c := range region.CIDRs {
+			if err := addPrefix(idx, c.CIDR, Range{Oracle, region.Region, strings.Join(c.Tags, ",")}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
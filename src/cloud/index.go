@@ -0,0 +1,111 @@
+package cloud
+
+import (
+	"net"
+
+	"github.com/apimgr/echoip/src/iputil/subnet"
+)
+
+// Range describes the networks a provider publishes for a region or service.
+type Range struct {
+	Provider string
+	Region   string
+	Service  string
+}
+
+// detail counts the fields of r besides the provider that are set.
+func (r Range) detail() int {
+	n := 0
+	if r.Region != "" {
+		n++
+	}
+	if r.Service != "" {
+		n++
+	}
+	return n
+}
+
+var masks [129]net.IPMask
+
+func init() {
+	for i := range masks {
+		masks[i] = net.CIDRMask(i, 128)
+	}
+}
+
+// Index finds the most specific of a set of possibly overlapping networks that
+// contains an address. Providers publish networks for a whole cloud, its
+// regions and the services in them, which nest within each other.
+type Index struct {
+	// lengths holds the prefix lengths in use, longest first. IPv4 networks
+	// are stored as IPv4-mapped IPv6 networks.
+	lengths []int
+	ranges  map[int]map[string]Range
+	n       int
+}
+
+// Add adds network n. Of two ranges for the same network, the one with more
+// detail is kept.
+func (idx *Index) Add(n *net.IPNet, r Range) {
+	ones, bits := n.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+	key := string(n.IP.To16().Mask(masks[ones]))
+	if idx.ranges == nil {
+		idx.ranges = make(map[int]map[string]Range)
+	}
+	ranges, ok := idx.ranges[ones]
+	if !ok {
+		ranges = make(map[string]Range)
+		idx.ranges[ones] = ranges
+		i := 0
+		for i < len(idx.lengths) && idx.lengths[i] > ones {
+			i++
+		}
+		idx.lengths = append(idx.lengths[:i], append([]int{ones}, idx.lengths[i:]...)...)
+	}
+	if old, ok := ranges[key]; ok {
+		if r.detail() > old.detail() {
+			ranges[key] = r
+		}
+		return
+	}
+	ranges[key] = r
+	idx.n++
+}
+
+// AddCIDR adds the network s in CIDR notation.
+func (idx *Index) AddCIDR(s string, r Range) error {
+	n, err := subnet.Parse(s)
+	if err != nil {
+		return err
+	}
+	idx.Add(n, r)
+	return nil
+}
+
+// Len returns the number of networks in the index.
+func (idx *Index) Len() int {
+	return idx.n
+}
+
+// Lookup returns the range of the most specific network containing ip.
+func (idx *Index) Lookup(ip net.IP) (Range, bool) {
+	r, _, ok := idx.lookup(ip)
+	return r, ok
+}
+
+// lookup is Lookup that also returns the prefix length of the network found.
+func (idx *Index) lookup(ip net.IP) (Range, int, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return Range{}, 0, false
+	}
+	for _, ones := range idx.lengths {
+		if r, ok := idx.ranges[ones][string(ip.Mask(masks[ones]))]; ok {
+			return r, ones, true
+		}
+	}
+	return Range{}, 0, false
+}
@@ -0,0 +1,96 @@
+// Package country provides metadata about countries from an embedded ISO 3166
+// dataset.
+package country
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"sync"
+)
+
+// countryTable lists the ISO 3166-1 countries and Kosovo, which geo databases
+// report with the user-assigned code XK. Languages are ISO 639 codes
+// separated by spaces, the most widely used first.
+//
+//go:embed countries.csv
+var countryTable []byte
+
+// Country holds the metadata of a country.
+type Country struct {
+	Alpha2         string   `json:"iso"`
+	Alpha3         string   `json:"iso3"`
+	Numeric        string   `json:"iso_numeric,omitempty"`
+	Name           string   `json:"name"`
+	Flag           string   `json:"flag"`
+	Capital        string   `json:"capital,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	CurrencyName   string   `json:"currency_name,omitempty"`
+	CurrencySymbol string   `json:"currency_symbol,omitempty"`
+	CallingCode    string   `json:"calling_code,omitempty"`
+	Languages      []string `json:"languages,omitempty"`
+	TLD            string   `json:"tld,omitempty"`
+}
+
+var (
+	loadOnce  sync.Once
+	countries map[string]*Country
+)
+
+func load() {
+	countries = make(map[string]*Country)
+	records, err := csv.NewReader(bytes.NewReader(countryTable)).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	for _, record := range records[1:] {
+		c := &Country{
+			Alpha2:         record[0],
+			Alpha3:         record[1],
+			Numeric:        record[2],
+			Name:           record[3],
+			Flag:           Flag(record[0]),
+			Capital:        record[4],
+			Currency:       record[5],
+			CurrencyName:   record[6],
+			CurrencySymbol: record[7],
+			CallingCode:    record[8],
+			Languages:      strings.Fields(record[9]),
+			TLD:            record[10],
+		}
+		for _, code := range []string{c.Alpha2, c.Alpha3, c.Numeric} {
+			if code != "" {
+				countries[code] = c
+			}
+		}
+	}
+}
+
+// Lookup returns the country with the given alpha-2, alpha-3 or numeric code.
+// Letter codes are case-insensitive.
+func Lookup(code string) (Country, bool) {
+	loadOnce.Do(load)
+	c, ok := countries[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Country{}, false
+	}
+	return *c, true
+}
+
+// Flag returns the emoji flag of the country with the given alpha-2 code,
+// which is written as the regional indicator symbols of its letters. It
+// returns an empty string if code is not two letters.
+func Flag(code string) string {
+	if len(code) != 2 {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		b.WriteRune(0x1F1E6 + c - 'A')
+	}
+	return b.String()
+}
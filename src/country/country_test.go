@@ -0,0 +1,73 @@
+package country
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	want := Country{
+		Alpha2:         "NO",
+		Alpha3:         "NOR",
+		Numeric:        "578",
+		Name:           "Norway",
+		Flag:           "🇳🇴",
+		Capital:        "Oslo",
+		Currency:       "NOK",
+		CurrencyName:   "Norwegian Krone",
+		CurrencySymbol: "kr",
+		CallingCode:    "+47",
+		Languages:      []string{"no", "nb", "nn"},
+		TLD:            ".no",
+	}
+	for _, code := range []string{"NO", "no", "NOR", "nor", "578", " NO "} {
+		got, ok := Lookup(code)
+		if !ok {
+			t.Errorf("Lookup(%q) found nothing", code)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Lookup(%q) = %+v, want %+v", code, got, want)
+		}
+	}
+	for _, code := range []string{"", "ZZ", "XX", "000", "N"} {
+		if got, ok := Lookup(code); ok {
+			t.Errorf("Lookup(%q) = %+v, want none", code, got)
+		}
+	}
+	if got, ok := Lookup("XK"); !ok || got.Alpha3 != "XKX" || got.Numeric != "" {
+		t.Errorf("Lookup(%q) = %+v, %t, want Kosovo without numeric code", "XK", got, ok)
+	}
+}
+
+func TestCountryTable(t *testing.T) {
+	loadOnce.Do(load)
+	for code, c := range countries {
+		if c.Alpha2 != code && c.Alpha3 != code && c.Numeric != code {
+			t.Errorf("%s indexes %s", code, c.Alpha2)
+		}
+		if len(c.Alpha2) != 2 || len(c.Alpha3) != 3 || c.Name == "" {
+			t.Errorf("%s has invalid codes or name: %+v", code, c)
+		}
+		if c.Currency != "" && (c.CurrencyName == "" || c.CurrencySymbol == "") {
+			t.Errorf("%s has currency %s without name or symbol", c.Alpha2, c.Currency)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	var tests = []struct {
+		in, out string
+	}{
+		{"US", "🇺🇸"},
+		{"de", "🇩🇪"},
+		{"", ""},
+		{"USA", ""},
+		{"1A", ""},
+	}
+	for _, tt := range tests {
+		if got := Flag(tt.in); got != tt.out {
+			t.Errorf("Flag(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
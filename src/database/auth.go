@@ -5,7 +5,6 @@
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -0,0 +1,305 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultDownloadTimeout = 10 * time.Minute
+
+// Source describes where a file is downloaded from.
+type Source struct {
+	// URLs are tried in order until one succeeds, so additional entries act
+	// as mirrors.
+	URLs []string
+	// ChecksumURL optionally points to a SHA-256 checksum of the downloaded
+	// file, either as a bare hex digest or in sha256sum format.
+	ChecksumURL string
+	// Member selects the file to extract from a tar archive by name suffix.
+	// The first regular file is used when empty.
+	Member string
+	// Username and Password are sent as HTTP basic authentication when
+	// Username is set.
+	Username string
+	Password string
+}
+
+// DownloadOptions configures the HTTP client used for downloads.
+type DownloadOptions struct {
+	// Timeout bounds a single download, including reading the body.
+	Timeout time.Duration
+	// Proxy is the URL of an HTTP proxy. The proxy environment variables are
+	// used when empty.
+	Proxy string
+	// CAFile is a PEM bundle of additional trusted certificate authorities.
+	CAFile string
+}
+
+// Downloader fetches files over HTTP. Files are written to a temporary file
+// next to their destination, verified and then renamed into place, so a
+// failed or partial download never replaces a working file.
+type Downloader struct {
+	client *http.Client
+}
+
+// downloadMeta is stored next to each downloaded file to allow conditional
+// requests.
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// NewDownloader creates a Downloader from opts.
+func NewDownloader(opts DownloadOptions) (*Downloader, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+	return &Downloader{client: &http.Client{Transport: transport, Timeout: timeout}}, nil
+}
+
+// Download fetches src into dst. If validate is not nil it is called with the
+// path of the downloaded file before it replaces dst. Download reports
+// whether dst was changed; it is left untouched when the server reports that
+// the file has not been modified since the last download.
+func (d *Downloader) Download(src Source, dst string, validate func(string) error) (bool, error) {
+	if len(src.URLs) == 0 {
+		return false, fmt.Errorf("no URL configured for %s", filepath.Base(dst))
+	}
+	var errs []error
+	for _, u := range src.URLs {
+		changed, err := d.download(u, src, dst, validate)
+		if err == nil {
+			return changed, nil
+		}
+		if len(src.URLs) > 1 {
+			log.Printf("Download of %s from %s failed: %v", filepath.Base(dst), redactURL(u), err)
+		}
+		errs = append(errs, err)
+	}
+	return false, errors.Join(errs...)
+}
+
+func (d *Downloader) download(rawURL string, src Source, dst string, validate func(string) error) (bool, error) {
+	metaFile := dst + ".meta"
+	var meta downloadMeta
+	if _, err := os.Stat(dst); err == nil {
+		if b, err := os.ReadFile(metaFile); err == nil {
+			json.Unmarshal(b, &meta)
+		}
+	}
+
+	req, err := newRequest(src, rawURL)
+	if err != nil {
+		return false, err
+	}
+	if meta.URL == rawURL {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	dir := filepath.Dir(dst)
+	raw, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".download-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(raw.Name())
+	defer raw.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(raw, hash), resp.Body); err != nil {
+		return false, err
+	}
+	if src.ChecksumURL != "" {
+		if err := d.verifyChecksum(src, hex.EncodeToString(hash.Sum(nil))); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := raw.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	out, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(out.Name())
+	if err := unpack(out, raw, src.Member); err != nil {
+		out.Close()
+		return false, fmt.Errorf("failed to unpack %s: %w", redactURL(rawURL), err)
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+	if validate != nil {
+		if err := validate(out.Name()); err != nil {
+			return false, fmt.Errorf("downloaded file is invalid: %w", err)
+		}
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(out.Name(), dst); err != nil {
+		return false, err
+	}
+
+	meta = downloadMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if b, err := json.Marshal(meta); err == nil {
+		os.WriteFile(metaFile, b, 0644)
+	}
+	return true, nil
+}
+
+// newRequest creates a GET request for rawURL with the credentials of src.
+// The client drops them if the server redirects to another host.
+func newRequest(src Source, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if src.Username != "" {
+		req.SetBasicAuth(src.Username, src.Password)
+	}
+	return req, nil
+}
+
+// verifyChecksum compares sum with the SHA-256 digest published at
+// src.ChecksumURL.
+func (d *Downloader) verifyChecksum(src Source, sum string) error {
+	req, err := newRequest(src, src.ChecksumURL)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch checksum: HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return fmt.Errorf("empty checksum file")
+	}
+	if want := strings.ToLower(fields[0]); want != sum {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", sum, want)
+	}
+	return nil
+}
+
+// unpack copies r to w, decompressing gzip and extracting tar archives as
+// detected from their content.
+func unpack(w io.Writer, r io.Reader, member string) error {
+	br := bufio.NewReaderSize(r, 1024)
+	// gzip magic followed by the deflate compression method
+	if magic, _ := br.Peek(3); bytes.Equal(magic, []byte{0x1f, 0x8b, 0x08}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		br = bufio.NewReaderSize(gz, 1024)
+	}
+	// Tar archives carry the "ustar" magic at offset 257 of their first
+	// header
+	if header, _ := br.Peek(262); len(header) == 262 && string(header[257:262]) == "ustar" {
+		return extractTar(w, br, member)
+	}
+	_, err := io.Copy(w, br)
+	return err
+}
+
+func extractTar(w io.Writer, r io.Reader, member string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			if member == "" {
+				return fmt.Errorf("archive contains no files")
+			}
+			return fmt.Errorf("archive contains no file matching %q", member)
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg || (member != "" && !strings.HasSuffix(path.Clean(h.Name), member)) {
+			continue
+		}
+		_, err = io.Copy(w, tr)
+		return err
+	}
+}
+
+// redactURL removes credentials from u so that it can be logged.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,149 @@
+package geoip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(b)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarball(t *testing.T, files map[string]string, order ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range order {
+		body := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// validContent accepts files starting with "valid", standing in for opening
+// a database.
+func validContent(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(b, []byte("valid")) {
+		return fmt.Errorf("unexpected content %q", b)
+	}
+	return nil
+}
+
+func TestDownload(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	sum := sha256.Sum256([]byte("valid v2"))
+	files := map[string][]byte{
+		"/plain":      []byte("valid v1"),
+		"/v2":         []byte("valid v2"),
+		"/v2.sha256":  []byte(hex.EncodeToString(sum[:]) + "  v2\n"),
+		"/bad.sha256": []byte(strings.Repeat("0", 64)),
+		"/invalid":    []byte("garbage"),
+		"/gz":         gzipped(t, []byte("valid gzip")),
+		"/tgz": gzipped(t, tarball(t, map[string]string{
+			"GeoLite2-City_20240101/COPYRIGHT.txt":      "copyright",
+			"GeoLite2-City_20240101/GeoLite2-City.mmdb": "valid tar",
+		}, "GeoLite2-City_20240101/COPYRIGHT.txt", "GeoLite2-City_20240101/GeoLite2-City.mmdb")),
+	}
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		b, ok := files[r.URL.Path]
+		if !ok {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		etag := `"` + r.URL.Path + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(b)
+	}))
+	defer s.Close()
+
+	d, err := NewDownloader(DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "test.mmdb")
+
+	var tests = []struct {
+		name     string
+		src      Source
+		changed  bool
+		err      bool
+		requests int
+		content  string
+	}{
+		{"plain", Source{URLs: []string{s.URL + "/plain"}}, true, false, 1, "valid v1"},
+		{"not modified", Source{URLs: []string{s.URL + "/plain"}}, false, false, 1, "valid v1"},
+		{"invalid content", Source{URLs: []string{s.URL + "/invalid"}}, false, true, 1, "valid v1"},
+		{"checksum mismatch", Source{URLs: []string{s.URL + "/v2"}, ChecksumURL: s.URL + "/bad.sha256"}, false, true, 2, "valid v1"},
+		{"mirror and checksum", Source{URLs: []string{s.URL + "/missing", s.URL + "/v2"}, ChecksumURL: s.URL + "/v2.sha256"}, true, false, 3, "valid v2"},
+		{"gzip", Source{URLs: []string{s.URL + "/gz"}}, true, false, 1, "valid gzip"},
+		{"tar.gz without member", Source{URLs: []string{s.URL + "/tgz"}, Member: ".csv"}, false, true, 1, "valid gzip"},
+		{"tar.gz", Source{URLs: []string{s.URL + "/tgz"}, Member: ".mmdb"}, true, false, 1, "valid tar"},
+		{"all mirrors fail", Source{URLs: []string{s.URL + "/missing", s.URL + "/gone"}}, false, true, 2, "valid tar"},
+	}
+	for _, tt := range tests {
+		requests = 0
+		changed, err := d.Download(tt.src, dst, validContent)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: err = %v, want error %t", tt.name, err, tt.err)
+		}
+		if changed != tt.changed {
+			t.Errorf("%s: changed = %t, want %t", tt.name, changed, tt.changed)
+		}
+		if requests != tt.requests {
+			t.Errorf("%s: made %d requests, want %d", tt.name, requests, tt.requests)
+		}
+		b, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.content {
+			t.Errorf("%s: content = %q, want %q", tt.name, b, tt.content)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got, want := strings.Join(names, ","), "test.mmdb,test.mmdb.meta"; got != want {
+		t.Errorf("files left in data directory = %s, want %s", got, want)
+	}
+}
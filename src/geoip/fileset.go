@@ -0,0 +1,196 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileSpec describes a file of a FileSet.
+type FileSpec struct {
+	// Name describes the file in messages, e.g. "list tor-exits".
+	Name string
+	// File is the path of the file.
+	File string
+	// Source is where to download the file from. Without URLs, File is a
+	// local file that is read as it is and reloaded when it changes.
+	Source Source
+}
+
+func (s FileSpec) local() bool {
+	return len(s.Source.URLs) == 0
+}
+
+// FileSet keeps a set of downloaded or local files loaded into values of type
+// T, which report the number of ranges they hold. Downloaded files are only
+// replaced by files that load, and a file that fails to load keeps its
+// previous value.
+type FileSet[T interface{ Len() int }] struct {
+	downloader *Downloader
+	files      []setFile[T]
+	current    atomic.Pointer[loadedSet[T]]
+	mu         sync.Mutex
+	onUpdate   []func()
+}
+
+type setFile[T any] struct {
+	spec FileSpec
+	load func(file string) (T, error)
+}
+
+// loadedSet holds the loaded files and their values, which are kept
+// separately so that lookups need not copy them.
+type loadedSet[T any] struct {
+	files  []loadedFile[T]
+	values []T
+}
+
+type loadedFile[T any] struct {
+	index   int
+	value   T
+	modTime time.Time
+}
+
+// NewFileSet creates a FileSet downloading files with downloader.
+func NewFileSet[T interface{ Len() int }](downloader *Downloader) *FileSet[T] {
+	return &FileSet[T]{downloader: downloader}
+}
+
+// Add adds a file that is loaded with load. Values are returned in the order
+// their files were added.
+func (s *FileSet[T]) Add(spec FileSpec, load func(file string) (T, error)) {
+	s.files = append(s.files, setFile[T]{spec: spec, load: load})
+}
+
+// Initialize downloads the files that are missing and loads all files. Files
+// that cannot be downloaded or loaded are skipped, and an error describing
+// them is returned.
+func (s *FileSet[T]) Initialize() error {
+	var errs []error
+	for _, f := range s.files {
+		if f.spec.local() {
+			continue
+		}
+		if _, err := os.Stat(f.spec.File); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.spec.File), 0755); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create data directory: %w", err))
+			continue
+		}
+		if _, err := s.download(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, s.load())
+	return errors.Join(errs...)
+}
+
+// Update downloads all files, checks local files for changes and reloads the
+// files if any changed.
+func (s *FileSet[T]) Update() error {
+	loaded := make(map[int]time.Time)
+	if current := s.current.Load(); current != nil {
+		for _, l := range current.files {
+			loaded[l.index] = l.modTime
+		}
+	}
+	changed := false
+	var errs []error
+	for i, f := range s.files {
+		if f.spec.local() {
+			info, err := os.Stat(f.spec.File)
+			changed = changed || (err == nil && !info.ModTime().Equal(loaded[i]))
+			continue
+		}
+		updated, err := s.download(f)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		changed = changed || updated
+	}
+	if changed {
+		// Files that were replaced are valid, so reload even if some
+		// downloads failed
+		errs = append(errs, s.load())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FileSet[T]) download(f setFile[T]) (bool, error) {
+	validate := func(file string) error {
+		_, err := f.load(file)
+		return err
+	}
+	updated, err := s.downloader.Download(f.spec.Source, f.spec.File, validate)
+	if err != nil {
+		return false, fmt.Errorf("failed to download %s: %w", f.spec.Name, err)
+	}
+	return updated, nil
+}
+
+// load loads the files and swaps them in for the ones currently in use, then
+// notifies the OnUpdate callbacks.
+func (s *FileSet[T]) load() error {
+	previous := make(map[int]loadedFile[T])
+	if current := s.current.Load(); current != nil {
+		for _, l := range current.files {
+			previous[l.index] = l
+		}
+	}
+	next := &loadedSet[T]{}
+	var errs []error
+	for i, f := range s.files {
+		info, err := os.Stat(f.spec.File)
+		if os.IsNotExist(err) && !f.spec.local() {
+			continue
+		}
+		l := loadedFile[T]{index: i}
+		if err == nil {
+			l.modTime = info.ModTime()
+			l.value, err = f.load(f.spec.File)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load %s: %w", f.spec.Name, err))
+			var ok bool
+			if l, ok = previous[i]; !ok {
+				continue
+			}
+		} else {
+			log.Printf("Loaded %s with %d ranges", f.spec.Name, l.value.Len())
+		}
+		next.files = append(next.files, l)
+		next.values = append(next.values, l.value)
+	}
+	s.current.Store(next)
+	s.mu.Lock()
+	callbacks := s.onUpdate
+	s.mu.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+	return errors.Join(errs...)
+}
+
+// OnUpdate registers fn to be called after files have been loaded, e.g. to
+// invalidate cached lookups.
+func (s *FileSet[T]) OnUpdate(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onUpdate = append(s.onUpdate, fn)
+}
+
+// Values returns the values of the loaded files. The returned slice must not
+// be modified.
+func (s *FileSet[T]) Values() []T {
+	current := s.current.Load()
+	if current == nil {
+		return nil
+	}
+	return current.values
+}
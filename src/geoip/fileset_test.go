@@ -0,0 +1,124 @@
+package geoip
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lines is the value of a file in tests: its lines after a "valid" line.
+type lines []string
+
+func (l lines) Len() int { return len(l) }
+
+func loadLines(file string) (lines, error) {
+	if err := validContent(file); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b))[1:], nil
+}
+
+func TestFileSet(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	files := map[string]string{"/a": "valid a1 a2", "/b": "valid b1"}
+	modified := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Serve Last-Modified so that unchanged files are not downloaded again
+		http.ServeContent(w, r, "", modified, strings.NewReader(body))
+	}))
+	defer s.Close()
+
+	local := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(local, []byte("valid c1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	downloader, err := NewDownloader(DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "files")
+	set := NewFileSet[lines](downloader)
+	for _, spec := range []FileSpec{
+		{Name: "file a", File: filepath.Join(dir, "a"), Source: Source{URLs: []string{s.URL + "/a"}}},
+		{Name: "file gone", File: filepath.Join(dir, "gone"), Source: Source{URLs: []string{s.URL + "/gone"}}},
+		{Name: "local file", File: local},
+		{Name: "file b", File: filepath.Join(dir, "b"), Source: Source{URLs: []string{s.URL + "/b"}}},
+	} {
+		set.Add(spec, loadLines)
+	}
+	updates := 0
+	set.OnUpdate(func() { updates++ })
+	if got := set.Values(); got != nil {
+		t.Errorf("Values before Initialize = %v, want nil", got)
+	}
+	if err := set.Initialize(); err == nil || !strings.Contains(err.Error(), "file gone") {
+		t.Errorf("Initialize: got %v, want error for file gone", err)
+	}
+	want := []lines{{"a1", "a2"}, {"c1"}, {"b1"}}
+	if got := set.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Values = %v, want %v", got, want)
+	}
+	if updates != 1 {
+		t.Errorf("Expected 1 update, got %d", updates)
+	}
+
+	// Unchanged files are not reloaded
+	if err := set.Update(); err == nil {
+		t.Error("Update succeeded with a missing file")
+	}
+	if updates != 1 {
+		t.Errorf("Expected 1 update, got %d", updates)
+	}
+
+	// Invalid downloads leave the file unchanged, while valid downloads and
+	// changed local files are reloaded
+	files["/a"] = "<html>rate limited</html>"
+	files["/b"] = "valid b2"
+	modified = modified.Add(time.Hour)
+	if err := os.WriteFile(local, []byte("valid c2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(local, later, later); err != nil {
+		t.Fatal(err)
+	}
+	set.Update()
+	want = []lines{{"a1", "a2"}, {"c2"}, {"b2"}}
+	if got := set.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Values after update = %v, want %v", got, want)
+	}
+	if updates != 2 {
+		t.Errorf("Expected 2 updates, got %d", updates)
+	}
+
+	// A local file that fails to load keeps its previous value
+	if err := os.WriteFile(local, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(local, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Update(); err == nil || !strings.Contains(err.Error(), "failed to load local file") {
+		t.Errorf("Update: got %v, want error for local file", err)
+	}
+	if got := set.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Values after failed load = %v, want %v", got, want)
+	}
+}
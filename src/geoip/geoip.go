@@ -1,17 +1,17 @@
 package geoip
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apimgr/echoip/src/iputil/geo"
-	geoip2 "github.com/oschwald/geoip2-golang"
 )
 
 const (
@@ -20,40 +20,89 @@
 
 // CDN URLs for databases (sapics/ip-location-db via jsdelivr)
 const (
-	cityIPv4URL  = "https://cdn.jsdelivr.net/npm/@ip-location-db/geolite2-city-mmdb/geolite2-city-ipv4.mmdb"
-	cityIPv6URL  = "https://cdn.jsdelivr.net/npm/@ip-location-db/geolite2-city-mmdb/geolite2-city-ipv6.mmdb"
-	countryURL   = "https://cdn.jsdelivr.net/npm/@ip-location-db/geo-whois-asn-country-mmdb/geo-whois-asn-country.mmdb"
-	asnURL       = "https://cdn.jsdelivr.net/npm/@ip-location-db/asn-mmdb/asn.mmdb"
+	cityIPv4URL = "https://cdn.jsdelivr.net/npm/@ip-location-db/geolite2-city-mmdb/geolite2-city-ipv4.mmdb"
+	cityIPv6URL = "https://cdn.jsdelivr.net/npm/@ip-location-db/geolite2-city-mmdb/geolite2-city-ipv6.mmdb"
+	countryURL  = "https://cdn.jsdelivr.net/npm/@ip-location-db/geo-whois-asn-country-mmdb/geo-whois-asn-country.mmdb"
+	asnURL      = "https://cdn.jsdelivr.net/npm/@ip-location-db/asn-mmdb/asn.mmdb"
 )
 
+// Database names, as used by SetSource
+const (
+	CityIPv4 = "geolite2-city-ipv4"
+	CityIPv6 = "geolite2-city-ipv6"
+	Country  = "geo-whois-asn-country"
+	ASN      = "asn"
+	// City covers both IPv4 and IPv6 and replaces CityIPv4 and CityIPv6
+	// when configured with UseMaxMind
+	City = "city"
+)
+
+// database is a GeoIP database file and where to download it from
+type database struct {
+	name   string
+	file   string
+	source Source
+}
+
 // Manager handles GeoIP database management
 type Manager struct {
 	dataDir        string
-	cityIPv4File   string
-	cityIPv6File   string
-	countryFile    string
-	asnFile        string
-	cityIPv4DB     *geoip2.Reader
-	cityIPv6DB     *geoip2.Reader
-	countryDB      *geoip2.Reader
-	asnDB          *geoip2.Reader
+	databases      []*database
+	downloader     *Downloader
+	current        atomic.Pointer[geoipReader]
 	lastUpdate     time.Time
 	updateInterval time.Duration
+	mu             sync.Mutex
+	onUpdate       []func()
 }
 
 // NewManager creates a new GeoIP manager
 func NewManager(dataDir string) *Manager {
 	geoipDir := filepath.Join(dataDir, "geoip")
+	downloader, _ := NewDownloader(DownloadOptions{})
 	return &Manager{
-		dataDir:        geoipDir,
-		cityIPv4File:   filepath.Join(geoipDir, "geolite2-city-ipv4.mmdb"),
-		cityIPv6File:   filepath.Join(geoipDir, "geolite2-city-ipv6.mmdb"),
-		countryFile:    filepath.Join(geoipDir, "geo-whois-asn-country.mmdb"),
-		asnFile:        filepath.Join(geoipDir, "asn.mmdb"),
+		dataDir: geoipDir,
+		databases: []*database{
+			{CityIPv4, filepath.Join(geoipDir, "geolite2-city-ipv4.mmdb"), Source{URLs: []string{cityIPv4URL}}},
+			{CityIPv6, filepath.Join(geoipDir, "geolite2-city-ipv6.mmdb"), Source{URLs: []string{cityIPv6URL}}},
+			{Country, filepath.Join(geoipDir, "geo-whois-asn-country.mmdb"), Source{URLs: []string{countryURL}}},
+			{ASN, filepath.Join(geoipDir, "asn.mmdb"), Source{URLs: []string{asnURL}}},
+		},
+		downloader:     downloader,
 		updateInterval: updateInterval,
 	}
 }
 
+// SetSource changes where the named database is downloaded from.
+func (m *Manager) SetSource(name string, src Source) error {
+	db := m.database(name)
+	if db == nil {
+		return fmt.Errorf("unknown GeoIP database: %s", name)
+	}
+	db.source = src
+	return nil
+}
+
+// SetDownloader replaces the downloader used to fetch databases.
+func (m *Manager) SetDownloader(d *Downloader) {
+	m.downloader = d
+}
+
+// Downloader returns the downloader used to fetch databases, so that other
+// data files can share its configuration.
+func (m *Manager) Downloader() *Downloader {
+	return m.downloader
+}
+
+func (m *Manager) database(name string) *database {
+	for _, db := range m.databases {
+		if db.name == name {
+			return db
+		}
+	}
+	return nil
+}
+
 // Initialize downloads databases if needed and loads them
 func (m *Manager) Initialize() error {
 	// Create data directory
@@ -83,89 +132,96 @@ func (m *Manager) Initialize() error {
 
 // databasesExist checks if all required databases exist
 func (m *Manager) databasesExist() bool {
-	files := []string{m.cityIPv4File, m.cityIPv6File, m.countryFile, m.asnFile}
-	for _, file := range files {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
+	for _, db := range m.databases {
+		if _, err := os.Stat(db.file); os.IsNotExist(err) {
 			return false
 		}
 	}
 	return true
 }
 
-// loadDatabases loads all GeoIP databases into memory
+// loadDatabases opens all GeoIP databases and swaps them in for the ones
+// currently in use. The previous databases are closed once all lookups that
+// are still using them have finished. On error the current databases are
+// kept.
 func (m *Manager) loadDatabases() error {
-	var err error
-
-	// Load City IPv4
-	m.cityIPv4DB, err = geoip2.Open(m.cityIPv4File)
-	if err != nil {
-		return fmt.Errorf("failed to load city IPv4 database: %w", err)
-	}
-
-	// Load City IPv6
-	m.cityIPv6DB, err = geoip2.Open(m.cityIPv6File)
-	if err != nil {
-		return fmt.Errorf("failed to load city IPv6 database: %w", err)
+	g := &geoipReader{}
+	targets := map[string]**geo.MMDB{
+		CityIPv4: &g.cityIPv4DB,
+		CityIPv6: &g.cityIPv6DB,
+		City:     &g.cityDB,
+		Country:  &g.countryDB,
+		ASN:      &g.asnDB,
+	}
+	for _, d := range m.databases {
+		db, err := geo.OpenMMDB(d.file)
+		if err != nil {
+			g.close()
+			return fmt.Errorf("failed to load %s database: %w", d.name, err)
+		}
+		*targets[d.name] = db
 	}
+	m.swap(g)
+	return nil
+}
 
-	// Load Country
-	m.countryDB, err = geoip2.Open(m.countryFile)
-	if err != nil {
-		return fmt.Errorf("failed to load country database: %w", err)
+// swap makes g the current databases, closes the previous ones once they are
+// no longer in use and notifies the OnUpdate callbacks.
+func (m *Manager) swap(g *geoipReader) {
+	if old := m.current.Swap(g); old != nil {
+		old.close()
 	}
-
-	// Load ASN
-	m.asnDB, err = geoip2.Open(m.asnFile)
-	if err != nil {
-		return fmt.Errorf("failed to load ASN database: %w", err)
+	m.mu.Lock()
+	callbacks := m.onUpdate
+	m.mu.Unlock()
+	for _, fn := range callbacks {
+		fn()
 	}
+}
 
-	return nil
+// OnUpdate registers fn to be called after new databases have been loaded,
+// e.g. to invalidate cached lookups.
+func (m *Manager) OnUpdate(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onUpdate = append(m.onUpdate, fn)
 }
 
-// DownloadDatabases downloads all 4 GeoIP databases from sapics/ip-location-db via CDN
+// DownloadDatabases downloads all GeoIP databases from their configured
+// sources
 func (m *Manager) DownloadDatabases() error {
-	databases := map[string]struct {
-		url      string
-		filepath string
-	}{
-		"geolite2-city-ipv4":      {cityIPv4URL, m.cityIPv4File},
-		"geolite2-city-ipv6":      {cityIPv6URL, m.cityIPv6File},
-		"geo-whois-asn-country":   {countryURL, m.countryFile},
-		"asn":                     {asnURL, m.asnFile},
-	}
-
-	for name, db := range databases {
-		log.Printf("  Downloading %s.mmdb...", name)
+	_, err := m.download()
+	return err
+}
 
-		if err := m.downloadFile(db.url, db.filepath); err != nil {
-			return fmt.Errorf("failed to download %s: %w", name, err)
+// download fetches every database and reports whether any of them changed.
+// Each file is only replaced after it has been verified to be a valid
+// MaxMind database.
+func (m *Manager) download() (bool, error) {
+	changed := false
+	var errs []error
+	for _, db := range m.databases {
+		log.Printf("  Downloading %s.mmdb...", db.name)
+		updated, err := m.downloader.Download(db.source, db.file, validateMMDB)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to download %s: %w", db.name, err))
+			continue
+		}
+		if !updated {
+			log.Printf("  %s.mmdb is up to date", db.name)
 		}
+		changed = changed || updated
 	}
-
-	return nil
+	return changed, errors.Join(errs...)
 }
 
-// downloadFile downloads a file from URL to local path
-func (m *Manager) downloadFile(url, localPath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-	}
-
-	out, err := os.Create(localPath)
+// validateMMDB checks that file can be opened as a MaxMind database
+func validateMMDB(file string) error {
+	db, err := geo.OpenMMDB(file)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
+	return db.Close()
 }
 
 // ShouldUpdate checks if databases need updating
@@ -180,12 +236,15 @@ func (m *Manager) Update() error {
 	}
 
 	log.Println("Updating GeoIP databases...")
-	if err := m.DownloadDatabases(); err != nil {
-		return err
+	changed, err := m.download()
+	if changed {
+		// Files that were replaced are valid, so reload even if some
+		// downloads failed
+		if err := m.loadDatabases(); err != nil {
+			return err
+		}
 	}
-
-	// Reload databases
-	if err := m.loadDatabases(); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -194,58 +253,106 @@ func (m *Manager) Update() error {
 	return nil
 }
 
-// Reader returns a geo.Reader interface wrapping the databases
+// Reader returns a geo.Reader that always uses the most recently loaded
+// databases, so updates take effect without handing out a new reader.
 func (m *Manager) Reader() geo.Reader {
-	return &geoipReader{
-		cityIPv4DB: m.cityIPv4DB,
-		cityIPv6DB: m.cityIPv6DB,
-		countryDB:  m.countryDB,
-		asnDB:      m.asnDB,
-	}
+	return &managedReader{m: m}
 }
 
-// geoipReader implements geo.Reader interface with IPv4/IPv6 database selection
-type geoipReader struct {
-	cityIPv4DB *geoip2.Reader
-	cityIPv6DB *geoip2.Reader
-	countryDB  *geoip2.Reader
-	asnDB      *geoip2.Reader
+// managedReader implements geo.Reader on top of the databases currently
+// loaded by a Manager.
+type managedReader struct {
+	m *Manager
 }
 
-func (g *geoipReader) Country(ip net.IP) (geo.Country, error) {
-	country := geo.Country{}
-	if g.countryDB == nil {
-		return country, nil
+// acquire returns the current databases with their read lock held, which
+// keeps them from being closed until the caller releases the lock. It returns
+// nil if no databases have been loaded.
+func (r *managedReader) acquire() *geoipReader {
+	for {
+		g := r.m.current.Load()
+		if g == nil {
+			return nil
+		}
+		g.mu.RLock()
+		if !g.closed {
+			return g
+		}
+		// Swapped out and closed after we loaded it
+		g.mu.RUnlock()
 	}
+}
 
-	record, err := g.countryDB.Country(ip)
-	if err != nil {
-		return country, err
+func (r *managedReader) Country(ip net.IP) (geo.Country, error) {
+	g := r.acquire()
+	if g == nil {
+		return geo.Country{}, nil
 	}
+	defer g.mu.RUnlock()
+	return g.Country(ip)
+}
 
-	if c, exists := record.Country.Names["en"]; exists {
-		country.Name = c
+func (r *managedReader) City(ip net.IP) (geo.City, error) {
+	g := r.acquire()
+	if g == nil {
+		return geo.City{}, nil
 	}
-	if c, exists := record.RegisteredCountry.Names["en"]; exists && country.Name == "" {
-		country.Name = c
+	defer g.mu.RUnlock()
+	return g.City(ip)
+}
+
+func (r *managedReader) ASN(ip net.IP) (geo.ASN, error) {
+	g := r.acquire()
+	if g == nil {
+		return geo.ASN{}, nil
 	}
-	if record.Country.IsoCode != "" {
-		country.ISO = record.Country.IsoCode
+	defer g.mu.RUnlock()
+	return g.ASN(ip)
+}
+
+func (r *managedReader) IsEmpty() bool {
+	g := r.acquire()
+	if g == nil {
+		return true
 	}
-	if record.RegisteredCountry.IsoCode != "" && country.ISO == "" {
-		country.ISO = record.RegisteredCountry.IsoCode
+	defer g.mu.RUnlock()
+	return g.IsEmpty()
+}
+
+// geoipReader implements geo.Reader interface with IPv4/IPv6 database selection
+type geoipReader struct {
+	cityIPv4DB *geo.MMDB
+	cityIPv6DB *geo.MMDB
+	cityDB     *geo.MMDB
+	countryDB  *geo.MMDB
+	asnDB      *geo.MMDB
+	mu         sync.RWMutex
+	closed     bool
+}
+
+// close waits for lookups holding the read lock to finish and closes the
+// databases.
+func (g *geoipReader) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, db := range []*geo.MMDB{g.cityIPv4DB, g.cityIPv6DB, g.cityDB, g.countryDB, g.asnDB} {
+		if db != nil {
+			db.Close()
+		}
 	}
-	isEU := record.Country.IsInEuropeanUnion || record.RegisteredCountry.IsInEuropeanUnion
-	country.IsEU = &isEU
+	g.closed = true
+}
 
-	return country, nil
+func (g *geoipReader) Country(ip net.IP) (geo.Country, error) {
+	if g.countryDB == nil {
+		return geo.Country{}, nil
+	}
+	return g.countryDB.Country(ip)
 }
 
 func (g *geoipReader) City(ip net.IP) (geo.City, error) {
-	city := geo.City{}
-
 	// Select appropriate city database based on IP version
-	var cityDB *geoip2.Reader
+	var cityDB *geo.MMDB
 	if ip.To4() != nil {
 		// IPv4
 		cityDB = g.cityIPv4DB
@@ -253,65 +360,23 @@ func (g *geoipReader) City(ip net.IP) (geo.City, error) {
 		// IPv6
 		cityDB = g.cityIPv6DB
 	}
-
 	if cityDB == nil {
-		return city, nil
-	}
-
-	record, err := cityDB.City(ip)
-	if err != nil {
-		return city, err
-	}
-
-	if c, exists := record.City.Names["en"]; exists {
-		city.Name = c
-	}
-	if len(record.Subdivisions) > 0 {
-		if c, exists := record.Subdivisions[0].Names["en"]; exists {
-			city.RegionName = c
-		}
-		if record.Subdivisions[0].IsoCode != "" {
-			city.RegionCode = record.Subdivisions[0].IsoCode
-		}
+		// Single database for both versions
+		cityDB = g.cityDB
 	}
-	city.Latitude = record.Location.Latitude
-	city.Longitude = record.Location.Longitude
-
-	// Metro code is US Only
-	if record.Location.MetroCode > 0 && record.Country.IsoCode == "US" {
-		city.MetroCode = record.Location.MetroCode
-	}
-	if record.Postal.Code != "" {
-		city.PostalCode = record.Postal.Code
-	}
-	if record.Location.TimeZone != "" {
-		city.Timezone = record.Location.TimeZone
+	if cityDB == nil {
+		return geo.City{}, nil
 	}
-
-	return city, nil
+	return cityDB.City(ip)
 }
 
 func (g *geoipReader) ASN(ip net.IP) (geo.ASN, error) {
-	asn := geo.ASN{}
 	if g.asnDB == nil {
-		return asn, nil
-	}
-
-	record, err := g.asnDB.ASN(ip)
-	if err != nil {
-		return asn, err
-	}
-
-	if record.AutonomousSystemNumber > 0 {
-		asn.AutonomousSystemNumber = record.AutonomousSystemNumber
-	}
-	if record.AutonomousSystemOrganization != "" {
-		asn.AutonomousSystemOrganization = record.AutonomousSystemOrganization
+		return geo.ASN{}, nil
 	}
-
-	return asn, nil
+	return g.asnDB.ASN(ip)
 }
 
 func (g *geoipReader) IsEmpty() bool {
-	return g.cityIPv4DB == nil && g.cityIPv6DB == nil && g.countryDB == nil
+	return g.cityIPv4DB == nil && g.cityIPv6DB == nil && g.cityDB == nil && g.countryDB == nil
 }
@@ -0,0 +1,53 @@
+package geoip
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwapWaitsForLookups(t *testing.T) {
+	m := NewManager(t.TempDir())
+	r := m.Reader().(*managedReader)
+	if !r.IsEmpty() {
+		t.Fatal("IsEmpty() = false before loading databases")
+	}
+
+	updates := 0
+	m.OnUpdate(func() { updates++ })
+
+	first := &geoipReader{}
+	m.swap(first)
+	if got := r.acquire(); got != first {
+		t.Fatalf("acquire() = %p, want %p", got, first)
+	}
+
+	// Swap while a lookup still holds the first databases
+	second := &geoipReader{}
+	done := make(chan struct{})
+	go func() {
+		m.swap(second)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("swap returned while a lookup was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if m.current.Load() != second {
+		t.Error("new lookups do not use the new databases")
+	}
+
+	first.mu.RUnlock()
+	<-done
+	if !first.closed {
+		t.Error("previous databases were not closed")
+	}
+	if got := r.acquire(); got != second {
+		t.Errorf("acquire() = %p, want %p", got, second)
+	} else {
+		got.mu.RUnlock()
+	}
+	if updates != 2 {
+		t.Errorf("OnUpdate callback ran %d times, want 2", updates)
+	}
+}
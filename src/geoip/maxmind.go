@@ -0,0 +1,98 @@
+package geoip
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxMindURL is the base URL of the MaxMind download service.
+const DefaultMaxMindURL = "https://download.maxmind.com"
+
+// Database roles that can be served by a MaxMind edition
+const (
+	RoleCity    = "city"
+	RoleCountry = "country"
+	RoleASN     = "asn"
+)
+
+var editionPattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// MaxMind holds the credentials for downloading GeoLite2 or GeoIP2 editions
+// from MaxMind.
+type MaxMind struct {
+	AccountID  string
+	LicenseKey string
+	// BaseURL replaces DefaultMaxMindURL, e.g. to download from a local
+	// mirror.
+	BaseURL string
+}
+
+// Source returns the download source of an edition such as GeoIP2-City or
+// GeoLite2-ASN. Editions are downloaded as tar.gz archives, verified against
+// their published SHA-256 checksum and the embedded mmdb file is extracted.
+func (mm MaxMind) Source(edition string) Source {
+	base := mm.BaseURL
+	if base == "" {
+		base = DefaultMaxMindURL
+	}
+	u := strings.TrimRight(base, "/") + "/geoip/databases/" + url.PathEscape(edition) + "/download?suffix=tar.gz"
+	return Source{
+		URLs:        []string{u},
+		ChecksumURL: u + ".sha256",
+		Member:      ".mmdb",
+		Username:    mm.AccountID,
+		Password:    mm.LicenseKey,
+	}
+}
+
+// UseMaxMind downloads the database for role (RoleCity, RoleCountry or
+// RoleASN) as the given MaxMind edition instead of its default source.
+// MaxMind city editions cover IPv4 and IPv6, so they replace both city
+// databases.
+func (m *Manager) UseMaxMind(mm MaxMind, role, edition string) error {
+	if mm.AccountID == "" || mm.LicenseKey == "" {
+		return fmt.Errorf("MaxMind account ID and license key are required")
+	}
+	if !editionPattern.MatchString(edition) {
+		return fmt.Errorf("invalid MaxMind edition: %q", edition)
+	}
+	db := &database{
+		file:   filepath.Join(m.dataDir, edition+".mmdb"),
+		source: mm.Source(edition),
+	}
+	switch role {
+	case RoleCity:
+		db.name = City
+		m.removeDatabases(CityIPv4, CityIPv6, City)
+	case RoleCountry:
+		db.name = Country
+		m.removeDatabases(Country)
+	case RoleASN:
+		db.name = ASN
+		m.removeDatabases(ASN)
+	default:
+		return fmt.Errorf("unknown GeoIP database role: %s (expected %s, %s or %s)", role, RoleCity, RoleCountry, RoleASN)
+	}
+	m.databases = append(m.databases, db)
+	return nil
+}
+
+func (m *Manager) removeDatabases(names ...string) {
+	databases := m.databases[:0]
+	for _, db := range m.databases {
+		keep := true
+		for _, name := range names {
+			if db.name == name {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			databases = append(databases, db)
+		}
+	}
+	m.databases = databases
+}
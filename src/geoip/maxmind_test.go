@@ -0,0 +1,130 @@
+package geoip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// emptyMMDB is a valid MaxMind database without any networks: an empty search
+// tree, the data section separator and metadata setting the record size.
+var emptyMMDB = append(append(make([]byte, 16), "\xAB\xCD\xEFMaxMind.com"...),
+	0xe1, 0x4b, 'r', 'e', 'c', 'o', 'r', 'd', '_', 's', 'i', 'z', 'e', 0xa1, 24)
+
+func TestMaxMindSource(t *testing.T) {
+	mm := MaxMind{AccountID: "42", LicenseKey: "secret"}
+	src := mm.Source("GeoIP2-City")
+	want := "https://download.maxmind.com/geoip/databases/GeoIP2-City/download?suffix=tar.gz"
+	if len(src.URLs) != 1 || src.URLs[0] != want {
+		t.Errorf("URLs = %v, want [%s]", src.URLs, want)
+	}
+	if src.ChecksumURL != want+".sha256" {
+		t.Errorf("ChecksumURL = %s, want %s.sha256", src.ChecksumURL, want)
+	}
+	if src.Username != "42" || src.Password != "secret" || src.Member != ".mmdb" {
+		t.Errorf("unexpected source %+v", src)
+	}
+	mm.BaseURL = "http://localhost:8000/"
+	if got := mm.Source("GeoLite2-ASN").URLs[0]; got != "http://localhost:8000/geoip/databases/GeoLite2-ASN/download?suffix=tar.gz" {
+		t.Errorf("URL with base URL = %s", got)
+	}
+}
+
+func TestUseMaxMindErrors(t *testing.T) {
+	mm := MaxMind{AccountID: "42", LicenseKey: "secret"}
+	var tests = []struct {
+		mm      MaxMind
+		role    string
+		edition string
+		err     string
+	}{
+		{MaxMind{AccountID: "42"}, RoleCity, "GeoIP2-City", "MaxMind account ID and license key are required"},
+		{mm, "isp", "GeoIP2-ISP", "unknown GeoIP database role: isp (expected city, country or asn)"},
+		{mm, RoleCity, "../GeoIP2-City", `invalid MaxMind edition: "../GeoIP2-City"`},
+	}
+	for _, tt := range tests {
+		err := NewManager(t.TempDir()).UseMaxMind(tt.mm, tt.role, tt.edition)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("UseMaxMind(%s, %s) = %v, want %s", tt.role, tt.edition, err, tt.err)
+		}
+	}
+}
+
+func TestMaxMindDownload(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	archives := make(map[string][]byte)
+	for _, edition := range []string{"GeoIP2-City", "GeoIP2-Country", "GeoIP2-ISP"} {
+		dir := edition + "_20240102"
+		archives[edition] = gzipped(t, tarball(t, map[string]string{
+			dir + "/LICENSE.txt":          "license",
+			dir + "/" + edition + ".mmdb": string(emptyMMDB),
+		}, dir+"/LICENSE.txt", dir+"/"+edition+".mmdb"))
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "42" || pass != "secret" {
+			http.Error(w, "invalid license key", http.StatusUnauthorized)
+			return
+		}
+		edition := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/geoip/databases/"), "/download")
+		b, ok := archives[edition]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("suffix") {
+		case "tar.gz":
+			w.Write(b)
+		case "tar.gz.sha256":
+			sum := sha256.Sum256(b)
+			w.Write([]byte(hex.EncodeToString(sum[:]) + "  " + edition + "_20240102.tar.gz\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	var tests = []struct {
+		licenseKey string
+		err        bool
+	}{
+		{"wrong", true},
+		{"secret", false},
+	}
+	for _, tt := range tests {
+		dataDir := t.TempDir()
+		m := NewManager(dataDir)
+		mm := MaxMind{AccountID: "42", LicenseKey: tt.licenseKey, BaseURL: s.URL}
+		for role, edition := range map[string]string{RoleCity: "GeoIP2-City", RoleCountry: "GeoIP2-Country", RoleASN: "GeoIP2-ISP"} {
+			if err := m.UseMaxMind(mm, role, edition); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := m.Initialize()
+		if (err != nil) != tt.err {
+			t.Errorf("license key %s: err = %v, want error %t", tt.licenseKey, err, tt.err)
+		}
+		if tt.err {
+			continue
+		}
+		if m.Reader().IsEmpty() {
+			t.Errorf("license key %s: no databases loaded", tt.licenseKey)
+		}
+		for _, edition := range []string{"GeoIP2-City", "GeoIP2-Country", "GeoIP2-ISP"} {
+			if _, err := os.Stat(filepath.Join(dataDir, "geoip", edition+".mmdb")); err != nil {
+				t.Error(err)
+			}
+		}
+		for _, file := range []string{"geolite2-city-ipv4.mmdb", "geolite2-city-ipv6.mmdb"} {
+			if _, err := os.Stat(filepath.Join(dataDir, "geoip", file)); err == nil {
+				t.Errorf("%s was downloaded although the city role uses MaxMind", file)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package iplist matches addresses against lists of networks, such as Tor exit
+// nodes, VPN endpoints, hosting providers and blocklists, that are downloaded
+// from configurable URLs and refreshed periodically.
+package iplist
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iputil/iprange"
+	"github.com/apimgr/echoip/src/iputil/subnet"
+)
+
+// Kind is what the addresses on a list have in common.
+type Kind string
+
+const (
+	Tor       Kind = "tor"
+	VPN       Kind = "vpn"
+	Hosting   Kind = "hosting"
+	Blocklist Kind = "blocklist"
+)
+
+// Kinds returns the supported kinds of lists.
+func Kinds() []Kind {
+	return []Kind{Tor, VPN, Hosting, Blocklist}
+}
+
+// DefaultBlocklistScore is the score of blocklists that are not given one.
+const DefaultBlocklistScore = 100
+
+// List describes a list and where to download it from.
+type List struct {
+	// Name identifies the list in responses and names its file in the data
+	// directory.
+	Name   string
+	Kind   Kind
+	Source geoip.Source
+	// Score, from 0 to 100, is how strongly being on the list indicates abuse.
+	Score int
+}
+
+// Match is a list that contains an address.
+type Match struct {
+	Name  string
+	Kind  Kind
+	Score int
+}
+
+// Score combines the scores of the lists in matches into a reputation score
+// from 0, for addresses on no list with a score, to 100. Each list is
+// treated as independent evidence, so that being on several lists scores
+// higher than being on any one of them.
+func Score(matches []Match) int {
+	clean := 1.0
+	for _, m := range matches {
+		clean *= 1 - float64(m.Score)/100
+	}
+	return int(math.Round(100 * (1 - clean)))
+}
+
+// DefaultLists returns the Tor Project's exit list and X4BNet's VPN and
+// datacenter ranges.
+func DefaultLists() []List {
+	return []List{
+		{Name: "tor-exits", Kind: Tor, Source: geoip.Source{URLs: []string{"https://check.torproject.org/torbulkexitlist"}}},
+		{Name: "x4bnet-vpn", Kind: VPN, Source: geoip.Source{URLs: []string{"https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/vpn/ipv4.txt"}}},
+		{Name: "x4bnet-datacenter", Kind: Hosting, Source: geoip.Source{URLs: []string{"https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/datacenter/ipv4.txt"}}},
+	}
+}
+
+// DefaultBlocklists returns the Spamhaus DROP lists of networks controlled by
+// spammers and cybercriminals, which include the former EDROP list.
+func DefaultBlocklists() []List {
+	return []List{
+		{Name: "spamhaus-drop", Kind: Blocklist, Score: DefaultBlocklistScore, Source: geoip.Source{URLs: []string{"https://www.spamhaus.org/drop/drop_v4.json"}}},
+		{Name: "spamhaus-drop-v6", Kind: Blocklist, Score: DefaultBlocklistScore, Source: geoip.Source{URLs: []string{"https://www.spamhaus.org/drop/drop_v6.json"}}},
+	}
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Parse reads a list with one address or network in CIDR notation per line.
+// Anything after a # or ; is a comment, as is anything after the first field
+// of a line, so that annotated lists such as FireHOL netsets can be used as
+// they are. Lines holding a JSON object give the network in their cidr
+// member, as in the Spamhaus DROP lists; objects without one are skipped.
+func Parse(r io.Reader) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(text), "{") {
+			var entry struct {
+				CIDR string `json:"cidr"`
+			}
+			if err := json.Unmarshal([]byte(text), &entry); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			text = entry.CIDR
+		}
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := subnet.Parse(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		networks = append(networks, n)
+	}
+	return networks, scanner.Err()
+}
+
+// table holds the networks of a loaded list.
+type table struct {
+	list     List
+	networks iprange.Table[struct{}]
+}
+
+func (t *table) Len() int {
+	return t.networks.Len()
+}
+
+func loadTable(l List, file string) (*table, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	networks, err := Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{list: l}
+	// Lists may contain overlapping networks, which a Table cannot hold
+	for _, n := range subnet.Aggregate(networks) {
+		if err := t.networks.AddNetwork(n, struct{}{}); err != nil {
+			return nil, err
+		}
+	}
+	t.networks.Sort()
+	return t, nil
+}
+
+// Manager downloads lists to a data directory and matches addresses against
+// them. The embedded FileSet initializes, updates and reloads the lists.
+type Manager struct {
+	*geoip.FileSet[*table]
+	dir   string
+	lists []List
+}
+
+// NewManager creates a Manager storing lists in the lists subdirectory of
+// dataDir. Lists are downloaded with downloader.
+func NewManager(dataDir string, downloader *geoip.Downloader) *Manager {
+	return &Manager{FileSet: geoip.NewFileSet[*table](downloader), dir: filepath.Join(dataDir, "lists")}
+}
+
+// Add configures a list. Lists are consulted in the order they were added.
+func (m *Manager) Add(l List) error {
+	if !validName.MatchString(l.Name) {
+		return fmt.Errorf("invalid list name: %q", l.Name)
+	}
+	if !validKind(l.Kind) {
+		return fmt.Errorf("invalid kind of list %s: %q", l.Name, l.Kind)
+	}
+	if l.Score < 0 || l.Score > 100 {
+		return fmt.Errorf("invalid score of list %s: %d", l.Name, l.Score)
+	}
+	if len(l.Source.URLs) == 0 {
+		return fmt.Errorf("no URL for list %s", l.Name)
+	}
+	for _, other := range m.lists {
+		if other.Name == l.Name {
+			return fmt.Errorf("duplicate list: %s", l.Name)
+		}
+	}
+	m.lists = append(m.lists, l)
+	spec := geoip.FileSpec{Name: "list " + l.Name, File: filepath.Join(m.dir, l.Name+".txt"), Source: l.Source}
+	m.FileSet.Add(spec, func(file string) (*table, error) {
+		return loadTable(l, file)
+	})
+	return nil
+}
+
+func validKind(k Kind) bool {
+	for _, kind := range Kinds() {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists returns the configured lists.
+func (m *Manager) Lists() []List {
+	return m.lists
+}
+
+// Lookup returns the lists that contain ip, in the order they were added.
+func (m *Manager) Lookup(ip net.IP) []Match {
+	var matches []Match
+	for _, t := range m.Values() {
+		if _, _, ok := t.networks.Lookup(ip); ok {
+			matches = append(matches, Match{Name: t.list.Name, Kind: t.list.Kind, Score: t.list.Score})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,131 @@
+package iplist
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/echoip/src/geoip"
+)
+
+func TestParse(t *testing.T) {
+	in := "# Tor exits\n192.0.2.1\n\n198.51.100.0/24 ; SBL123\n2001:db8::/32 # documentation\n  203.0.113.7  extra\n"
+	networks, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range networks {
+		got = append(got, n.String())
+	}
+	want := []string{"192.0.2.1/32", "198.51.100.0/24", "2001:db8::/32", "203.0.113.7/32"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %v, want %v", got, want)
+	}
+	drop := `{"cidr":"1.10.16.0/20","sblid":"SBL256894","rir":"apnic"}
+{"cidr":"2001:db8::/32","sblid":"SBL1","rir":"ripencc"}
+{"type":"metadata","timestamp":1760000000,"size":2,"records":2}
+`
+	networks, err = Parse(strings.NewReader(drop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 2 || networks[0].String() != "1.10.16.0/20" || networks[1].String() != "2001:db8::/32" {
+		t.Errorf("Parse of Spamhaus DROP = %v, want 1.10.16.0/20 and 2001:db8::/32", networks)
+	}
+	if _, err := Parse(strings.NewReader("192.0.2.1\n<html>\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Parse of invalid list: got %v, want error for line 2", err)
+	}
+}
+
+func TestScore(t *testing.T) {
+	var tests = []struct {
+		scores []int
+		want   int
+	}{
+		{nil, 0},
+		{[]int{0}, 0},
+		{[]int{100}, 100},
+		{[]int{50}, 50},
+		{[]int{50, 50}, 75},
+		{[]int{50, 0, 20}, 60},
+		{[]int{100, 30}, 100},
+	}
+	for _, tt := range tests {
+		var matches []Match
+		for _, s := range tt.scores {
+			matches = append(matches, Match{Score: s})
+		}
+		if got := Score(matches); got != tt.want {
+			t.Errorf("Score(%v) = %d, want %d", tt.scores, got, tt.want)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dataDir := t.TempDir()
+	files := map[string]string{
+		"tor":  "192.0.2.1\n192.0.2.2\n",
+		"vpn":  "198.51.100.0/25\n198.51.100.0/24\n",
+		"dc":   "198.51.100.0/24\n2001:db8::/32\n",
+		"drop": `{"cidr":"198.51.100.128/25","sblid":"SBL1"}` + "\n",
+	}
+	// Lists that are already in the data directory are not downloaded
+	if err := os.MkdirAll(filepath.Join(dataDir, "lists"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dataDir, "lists", name+".txt"), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := geoip.Source{URLs: []string{"http://lists.invalid/"}}
+	m := NewManager(dataDir, nil)
+	for _, l := range []List{
+		{Name: "tor", Kind: Tor, Source: source},
+		{Name: "vpn", Kind: VPN, Source: source},
+		{Name: "dc", Kind: Hosting, Source: source},
+		{Name: "drop", Kind: Blocklist, Score: 80, Source: source},
+	} {
+		if err := m.Add(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, l := range []List{
+		{Name: "tor", Kind: Tor, Source: source},
+		{Name: "../etc", Kind: Tor, Source: source},
+		{Name: "other", Kind: "proxy", Source: source},
+		{Name: "other", Kind: Blocklist, Score: 101, Source: source},
+		{Name: "other", Kind: Tor},
+	} {
+		if err := m.Add(l); err == nil {
+			t.Errorf("Add(%+v) succeeded, want error", l)
+		}
+	}
+	if err := m.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		ip   string
+		want []Match
+	}{
+		{"192.0.2.1", []Match{{"tor", Tor, 0}}},
+		{"192.0.2.3", nil},
+		{"198.51.100.1", []Match{{"vpn", VPN, 0}, {"dc", Hosting, 0}}},
+		{"198.51.100.200", []Match{{"vpn", VPN, 0}, {"dc", Hosting, 0}, {"drop", Blocklist, 80}}},
+		{"2001:db8::1", []Match{{"dc", Hosting, 0}}},
+		{"2001:db9::1", nil},
+	}
+	for _, tt := range tests {
+		if got := m.Lookup(net.ParseIP(tt.ip)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package iputil
+
+import (
+	"net"
+)
+
+// Class describes what an address is used for, based on the IANA IPv4 and
+// IPv6 special-purpose address registries.
+type Class struct {
+	// Category is public for ordinary global unicast addresses, or the
+	// special purpose of the address, e.g. private, cgnat or documentation
+	Category string
+	// Private is set for addresses of private networks: RFC 1918, the CGNAT
+	// shared address space and IPv6 unique local addresses
+	Private bool
+	// Bogon is set for addresses that are not globally reachable and should
+	// not appear on the public internet
+	Bogon bool
+}
+
+type specialNetwork struct {
+	network  *net.IPNet
+	category string
+	private  bool
+	global   bool
+}
+
+func special(cidr, category string, private, global bool) specialNetwork {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return specialNetwork{n, category, private, global}
+}
+
+// specialNetworks lists the special-purpose networks. Globally reachable
+// exceptions come before the network containing them, since the first match
+// wins.
+var specialNetworks = []specialNetwork{
+	// IPv4, https://www.iana.org/assignments/iana-ipv4-special-registry
+	special("0.0.0.0/8", "this-network", false, false),
+	special("10.0.0.0/8", "private", true, false),
+	special("100.64.0.0/10", "cgnat", true, false),
+	special("127.0.0.0/8", "loopback", false, false),
+	special("169.254.0.0/16", "link-local", false, false),
+	special("172.16.0.0/12", "private", true, false),
+	special("192.0.0.9/32", "anycast", false, true),
+	special("192.0.0.10/32", "anycast", false, true),
+	special("192.0.0.0/24", "ietf-protocol", false, false),
+	special("192.0.2.0/24", "documentation", false, false),
+	special("192.31.196.0/24", "as112", false, true),
+	special("192.52.193.0/24", "amt", false, true),
+	special("192.88.99.0/24", "6to4-relay", false, false),
+	special("192.168.0.0/16", "private", true, false),
+	special("192.175.48.0/24", "as112", false, true),
+	special("198.18.0.0/15", "benchmarking", false, false),
+	special("198.51.100.0/24", "documentation", false, false),
+	special("203.0.113.0/24", "documentation", false, false),
+	special("224.0.0.0/4", "multicast", false, false),
+	special("255.255.255.255/32", "broadcast", false, false),
+	special("240.0.0.0/4", "reserved", false, false),
+
+	// IPv6, https://www.iana.org/assignments/iana-ipv6-special-registry
+	special("::/128", "unspecified", false, false),
+	special("::1/128", "loopback", false, false),
+	special("64:ff9b::/96", "nat64", false, true),
+	special("64:ff9b:1::/48", "nat64", false, false),
+	special("100::/64", "discard", false, false),
+	special("2001::/32", "teredo", false, true),
+	special("2001:1::1/128", "anycast", false, true),
+	special("2001:1::2/128", "anycast", false, true),
+	special("2001:1::3/128", "anycast", false, true),
+	special("2001:2::/48", "benchmarking", false, false),
+	special("2001:3::/32", "amt", false, true),
+	special("2001:4:112::/48", "as112", false, true),
+	special("2001:10::/28", "orchid", false, false),
+	special("2001:20::/28", "orchid", false, true),
+	special("2001:30::/28", "drone-remote-id", false, true),
+	special("2001::/23", "ietf-protocol", false, false),
+	special("2001:db8::/32", "documentation", false, false),
+	special("2002::/16", "6to4", false, true),
+	special("2620:4f:8000::/48", "as112", false, true),
+	special("3fff::/20", "documentation", false, false),
+	special("5f00::/16", "srv6", false, false),
+	special("fc00::/7", "unique-local", true, false),
+	special("fe80::/10", "link-local", false, false),
+	special("ff00::/8", "multicast", false, false),
+	// Everything outside of global unicast is unallocated
+	special("2000::/3", "public", false, true),
+	special("::/0", "reserved", false, false),
+}
+
+// Classify returns the Class of ip. IPv4-mapped IPv6 addresses are classified
+// as IPv4 addresses.
+func Classify(ip net.IP) Class {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, s := range specialNetworks {
+		if s.network.Contains(ip) {
+			return Class{Category: s.category, Private: s.private, Bogon: !s.global}
+		}
+	}
+	return Class{Category: "public"}
+}
+
+// Version returns 4 for IPv4 addresses, including IPv4-mapped IPv6 addresses,
+// and 6 otherwise.
+func Version(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
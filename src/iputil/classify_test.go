@@ -0,0 +1,53 @@
+package iputil
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		in      string
+		out     Class
+		version int
+	}{
+		{"8.8.8.8", Class{Category: "public"}, 4},
+		{"10.0.0.1", Class{Category: "private", Private: true, Bogon: true}, 4},
+		{"172.31.255.255", Class{Category: "private", Private: true, Bogon: true}, 4},
+		{"172.32.0.1", Class{Category: "public"}, 4},
+		{"100.64.0.1", Class{Category: "cgnat", Private: true, Bogon: true}, 4},
+		{"127.0.0.1", Class{Category: "loopback", Bogon: true}, 4},
+		{"169.254.169.254", Class{Category: "link-local", Bogon: true}, 4},
+		{"192.0.0.9", Class{Category: "anycast"}, 4},
+		{"192.0.0.8", Class{Category: "ietf-protocol", Bogon: true}, 4},
+		{"198.51.100.7", Class{Category: "documentation", Bogon: true}, 4},
+		{"198.19.0.1", Class{Category: "benchmarking", Bogon: true}, 4},
+		{"224.0.0.251", Class{Category: "multicast", Bogon: true}, 4},
+		{"255.255.255.255", Class{Category: "broadcast", Bogon: true}, 4},
+		{"250.1.2.3", Class{Category: "reserved", Bogon: true}, 4},
+		{"::ffff:192.168.1.1", Class{Category: "private", Private: true, Bogon: true}, 4},
+		{"2001:4860:4860::8888", Class{Category: "public"}, 6},
+		{"::", Class{Category: "unspecified", Bogon: true}, 6},
+		{"::1", Class{Category: "loopback", Bogon: true}, 6},
+		{"2001:db8::1", Class{Category: "documentation", Bogon: true}, 6},
+		{"3fff:1::1", Class{Category: "documentation", Bogon: true}, 6},
+		{"2001:0:4136:e378::1", Class{Category: "teredo"}, 6},
+		{"2001:2::1", Class{Category: "benchmarking", Bogon: true}, 6},
+		{"2001:100::1", Class{Category: "ietf-protocol", Bogon: true}, 6},
+		{"2002:c000:204::1", Class{Category: "6to4"}, 6},
+		{"64:ff9b::808:808", Class{Category: "nat64"}, 6},
+		{"fd12:3456::1", Class{Category: "unique-local", Private: true, Bogon: true}, 6},
+		{"fe80::1", Class{Category: "link-local", Bogon: true}, 6},
+		{"ff02::1", Class{Category: "multicast", Bogon: true}, 6},
+		{"4000::1", Class{Category: "reserved", Bogon: true}, 6},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.in)
+		if out := Classify(ip); out != tt.out {
+			t.Errorf("Classify(%s) = %+v, want %+v", tt.in, out, tt.out)
+		}
+		if v := Version(ip); v != tt.version {
+			t.Errorf("Version(%s) = %d, want %d", tt.in, v, tt.version)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package geo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iputil/iprange"
+)
+
+// rangeRecord holds the geo information for an address range. Its fields are
+// comparable so that identical records can be shared.
+type rangeRecord struct {
+	countryName    string
+	countryISO     string
+	countryEU      *bool
+	continentName  string
+	continentCode  string
+	city           string
+	regionName     string
+	regionCode     string
+	postalCode     string
+	timezone       string
+	metroCode      uint
+	latitude       float64
+	longitude      float64
+	accuracyRadius uint
+	asn            uint
+	asnOrg         string
+}
+
+func (rec *rangeRecord) countryInfo() Country {
+	return Country{Name: rec.countryName, ISO: rec.countryISO, IsEU: rec.countryEU,
+		Continent: Place{Name: rec.continentName, ISO: rec.continentCode}}
+}
+
+func (rec *rangeRecord) cityInfo() City {
+	return City{
+		Name:           rec.city,
+		RegionName:     rec.regionName,
+		RegionCode:     rec.regionCode,
+		PostalCode:     rec.postalCode,
+		Timezone:       rec.timezone,
+		MetroCode:      rec.metroCode,
+		Latitude:       rec.latitude,
+		Longitude:      rec.longitude,
+		AccuracyRadius: rec.accuracyRadius,
+	}
+}
+
+func (rec *rangeRecord) asnInfo() ASN {
+	return ASN{AutonomousSystemNumber: rec.asn, AutonomousSystemOrganization: rec.asnOrg}
+}
+
+// rangeReader answers lookups from address ranges loaded into memory, as
+// used for the CSV formats.
+type rangeReader struct {
+	table       iprange.Table[*rangeRecord]
+	hasLocation bool
+	// records interns identical records while loading, since many ranges
+	// share a location
+	records map[rangeRecord]*rangeRecord
+}
+
+func newRangeReader() *rangeReader {
+	return &rangeReader{records: make(map[rangeRecord]*rangeRecord)}
+}
+
+func (r *rangeReader) add(start, end net.IP, rec rangeRecord) error {
+	p, ok := r.records[rec]
+	if !ok {
+		p = &rec
+		r.records[rec] = p
+	}
+	if !rec.countryInfo().empty() || !rec.cityInfo().empty() {
+		r.hasLocation = true
+	}
+	return r.table.Add(start, end, p)
+}
+
+// done prepares r for lookups once all ranges are added.
+func (r *rangeReader) done() {
+	r.table.Sort()
+	r.records = nil
+}
+
+func (r *rangeReader) Country(ip net.IP) (Country, error) {
+	rec, network, ok := r.table.Lookup(ip)
+	if !ok {
+		return Country{}, nil
+	}
+	country := rec.countryInfo()
+	if !country.empty() {
+		country.Network = network
+	}
+	return country, nil
+}
+
+func (r *rangeReader) City(ip net.IP) (City, error) {
+	rec, network, ok := r.table.Lookup(ip)
+	if !ok {
+		return City{}, nil
+	}
+	city := rec.cityInfo()
+	if !city.empty() {
+		city.Network = network
+	}
+	return city, nil
+}
+
+func (r *rangeReader) ASN(ip net.IP) (ASN, error) {
+	rec, network, ok := r.table.Lookup(ip)
+	if !ok {
+		return ASN{}, nil
+	}
+	asn := rec.asnInfo()
+	if !asn.empty() {
+		asn.Network = network
+	}
+	return asn, nil
+}
+
+func (r *rangeReader) IsEmpty() bool {
+	return !r.hasLocation
+}
+
+// readCSV calls fn for each row of the CSV file at path. Rows must all have
+// the same number of fields.
+func readCSV(path string, fn func(row []string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.ReuseRecord = true
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			line, _ := cr.FieldPos(0)
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+}
+
+// unknown maps the placeholders used for missing values to an empty string.
+func unknown(s string) string {
+	if s == "-" || s == "ZZ" {
+		return ""
+	}
+	return s
+}
+
+// parseUint parses an optional unsigned number.
+func parseUint(s string) (uint, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint(n), err
+}
+
+func parseCoordinate(s string) (float64, error) {
+	if s == "" || s == "-" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseDecimalIP parses an address given as a decimal number.
+func parseDecimalIP(s string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil, fmt.Errorf("invalid IP number %q", s)
+	}
+	return n, nil
+}
+
+// decimalIP converts an address parsed by parseDecimalIP to an IPv6 address,
+// or to an IPv4 address if ipv6 is false.
+func decimalIP(n *big.Int, ipv6 bool) net.IP {
+	if ipv6 {
+		return n.FillBytes(make(net.IP, 16))
+	}
+	return n.FillBytes(make(net.IP, 4))
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	return ip, nil
+}
+
+// OpenIP2LocationCSV loads an IP2Location CSV file (IPv4 or IPv6). The DB1,
+// DB3, DB5, DB9, DB11 and ASN editions are supported.
+func OpenIP2LocationCSV(path string) (Reader, error) {
+	r := newRangeReader()
+	// IPv6 files hold IPv4 addresses in ::ffff:0:0/96 and start with a range
+	// from 0, so a file is IPv6 as soon as a number exceeds 32 bits
+	ipv6 := false
+	err := readCSV(path, func(row []string) error {
+		if len(row) < 4 {
+			return fmt.Errorf("expected at least 4 columns, got %d", len(row))
+		}
+		from, err := parseDecimalIP(row[0])
+		if err != nil {
+			return err
+		}
+		to, err := parseDecimalIP(row[1])
+		if err != nil {
+			return err
+		}
+		ipv6 = ipv6 || from.BitLen() > 32 || to.BitLen() > 32
+		start, end := decimalIP(from, ipv6), decimalIP(to, ipv6)
+		var rec rangeRecord
+		if len(row) == 5 && strings.Contains(row[2], "/") {
+			// ASN: ip_from, ip_to, cidr, asn, as
+			if row[3] != "-" {
+				if rec.asn, err = parseASN(row[3]); err != nil {
+					return err
+				}
+			}
+			rec.asnOrg = unknown(row[4])
+			return r.add(start, end, rec)
+		}
+		rec.countryISO = unknown(row[2])
+		rec.countryName = unknown(row[3])
+		switch len(row) {
+		case 4: // DB1
+		case 10: // DB11: ..., zip_code, time_zone
+			rec.timezone = unknown(row[9])
+			fallthrough
+		case 9: // DB9: ..., zip_code
+			rec.postalCode = unknown(row[8])
+			fallthrough
+		case 8: // DB5: ..., latitude, longitude
+			if rec.latitude, err = parseCoordinate(row[6]); err != nil {
+				return err
+			}
+			if rec.longitude, err = parseCoordinate(row[7]); err != nil {
+				return err
+			}
+			fallthrough
+		case 6: // DB3: ip_from, ip_to, country_code, country_name, region_name, city_name
+			rec.regionName = unknown(row[4])
+			rec.city = unknown(row[5])
+		default:
+			return fmt.Errorf("unsupported IP2Location CSV with %d columns (supported: DB1, DB3, DB5, DB9, DB11, ASN)", len(row))
+		}
+		return r.add(start, end, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.done()
+	return r, nil
+}
+
+// OpenDBIPCSV loads a DB-IP Lite CSV file: IP to Country, IP to City or IP to
+// ASN.
+func OpenDBIPCSV(path string) (Reader, error) {
+	r := newRangeReader()
+	err := readCSV(path, func(row []string) error {
+		if len(row) < 3 {
+			return fmt.Errorf("expected at least 3 columns, got %d", len(row))
+		}
+		start, err := parseIP(row[0])
+		if err != nil {
+			return err
+		}
+		end, err := parseIP(row[1])
+		if err != nil {
+			return err
+		}
+		var rec rangeRecord
+		switch len(row) {
+		case 3: // start, end, country
+			rec.countryISO = unknown(row[2])
+		case 4: // start, end, asn, as_organization
+			if rec.asn, err = parseASN(row[2]); err != nil {
+				return err
+			}
+			rec.asnOrg = row[3]
+		case 8: // start, end, continent, country, stateprov, city, latitude, longitude
+			rec.continentCode = unknown(row[2])
+			rec.countryISO = unknown(row[3])
+			rec.regionName = row[4]
+			rec.city = row[5]
+			if rec.latitude, err = parseCoordinate(row[6]); err != nil {
+				return err
+			}
+			if rec.longitude, err = parseCoordinate(row[7]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported DB-IP CSV with %d columns", len(row))
+		}
+		return r.add(start, end, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.done()
+	return r, nil
+}
+
+var (
+	isEU  = true
+	notEU = false
+)
+
+// OpenCSV loads a CSV file whose first row names the columns. Each row
+// describes either a network (column network, in CIDR notation) or a range
+// (columns start and end). The remaining columns use the field names of the
+// JSON API: continent, continent_code, country, country_iso, country_eu,
+// region_name, region_code, city, latitude, longitude, accuracy_radius,
+// zip_code, time_zone, metro_code, asn and asn_org.
+func OpenCSV(path string) (Reader, error) {
+	r := newRangeReader()
+	var columns []string
+	err := readCSV(path, func(row []string) error {
+		if columns == nil {
+			columns = append(columns, row...)
+			return checkCSVColumns(columns)
+		}
+		var (
+			rec        rangeRecord
+			start, end net.IP
+			network    *net.IPNet
+			err        error
+		)
+		for i, v := range row {
+			v = strings.TrimSpace(v)
+			switch columns[i] {
+			case "network":
+				_, network, err = net.ParseCIDR(v)
+			case "start":
+				start, err = parseIP(v)
+			case "end":
+				end, err = parseIP(v)
+			case "continent":
+				rec.continentName = v
+			case "continent_code":
+				rec.continentCode = v
+			case "country":
+				rec.countryName = v
+			case "country_iso":
+				rec.countryISO = v
+			case "country_eu":
+				if v != "" {
+					var eu bool
+					if eu, err = strconv.ParseBool(v); eu {
+						rec.countryEU = &isEU
+					} else {
+						rec.countryEU = &notEU
+					}
+				}
+			case "region_name":
+				rec.regionName = v
+			case "region_code":
+				rec.regionCode = v
+			case "city":
+				rec.city = v
+			case "latitude":
+				rec.latitude, err = parseCoordinate(v)
+			case "longitude":
+				rec.longitude, err = parseCoordinate(v)
+			case "zip_code":
+				rec.postalCode = v
+			case "time_zone":
+				rec.timezone = v
+			case "metro_code":
+				rec.metroCode, err = parseUint(v)
+			case "accuracy_radius":
+				rec.accuracyRadius, err = parseUint(v)
+			case "asn":
+				if v != "" {
+					rec.asn, err = parseASN(v)
+				}
+			case "asn_org":
+				rec.asnOrg = v
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", columns[i], err)
+			}
+		}
+		if network != nil {
+			return r.addNetwork(network, rec)
+		}
+		return r.add(start, end, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.done()
+	return r, nil
+}
+
+func (r *rangeReader) addNetwork(n *net.IPNet, rec rangeRecord) error {
+	start := n.IP.Mask(n.Mask)
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^n.Mask[i]
+	}
+	return r.add(start, end, rec)
+}
+
+var csvColumns = []string{"network", "start", "end", "continent", "continent_code", "country", "country_iso", "country_eu", "region_name", "region_code", "city", "latitude", "longitude", "accuracy_radius", "zip_code", "time_zone", "metro_code", "asn", "asn_org"}
+
+func checkCSVColumns(columns []string) error {
+	seen := make(map[string]bool)
+	for i, c := range columns {
+		c = strings.TrimSpace(c)
+		columns[i] = c
+		known := false
+		for _, k := range csvColumns {
+			known = known || k == c
+		}
+		if !known {
+			return fmt.Errorf("unknown column %q", c)
+		}
+		seen[c] = true
+	}
+	if !seen["network"] && !(seen["start"] && seen["end"]) {
+		return fmt.Errorf("header must contain either network or start and end")
+	}
+	return nil
+}
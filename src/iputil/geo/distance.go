@@ -0,0 +1,30 @@
+package geo
+
+import "math"
+
+// EarthRadius is the mean radius of the earth in kilometers.
+const EarthRadius = 6371.0088
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance returns the great-circle distance in kilometers between two
+// locations, using the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1, φ2 := radians(lat1), radians(lat2)
+	dφ, dλ := radians(lat2-lat1), radians(lon2-lon1)
+	a := math.Sin(dφ/2)*math.Sin(dφ/2) + math.Cos(φ1)*math.Cos(φ2)*math.Sin(dλ/2)*math.Sin(dλ/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial bearing in degrees clockwise from north, from 0
+// up to 360, for travelling along a great circle from the first location to
+// the second.
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	φ1, φ2 := radians(lat1), radians(lat2)
+	dλ := radians(lon2 - lon1)
+	y := math.Sin(dλ) * math.Cos(φ2)
+	x := math.Cos(φ1)*math.Sin(φ2) - math.Sin(φ1)*math.Cos(φ2)*math.Cos(dλ)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
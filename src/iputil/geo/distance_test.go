@@ -0,0 +1,30 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceAndBearing(t *testing.T) {
+	var tests = []struct {
+		lat1, lon1, lat2, lon2 float64
+		distance, bearing      float64
+	}{
+		// Oslo to London
+		{59.9139, 10.7522, 51.5074, -0.1278, 1153.8, 220.7},
+		// Sydney to Santiago, across the date line
+		{-33.8688, 151.2093, -33.4489, -70.6693, 11346.7, 145.3},
+		{0, 0, 0, 90, 10007.6, 90},
+		{0, 0, 10, 0, 1111.9, 0},
+		{10, 0, 0, 0, 1111.9, 180},
+		{40, -74, 40, -74, 0, 0},
+	}
+	for _, tt := range tests {
+		if d := Distance(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(d-tt.distance) > 0.5 {
+			t.Errorf("Distance(%v, %v, %v, %v) = %.1f, want %.1f", tt.lat1, tt.lon1, tt.lat2, tt.lon2, d, tt.distance)
+		}
+		if b := Bearing(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(b-tt.bearing) > 0.1 {
+			t.Errorf("Bearing(%v, %v, %v, %v) = %.1f, want %.1f", tt.lat1, tt.lon1, tt.lat2, tt.lon2, b, tt.bearing)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package geo
 
 import (
-	"math"
 	"net"
-
-	geoip2 "github.com/oschwald/geoip2-golang"
 )
 
+// Reader looks up geo information for an IP address. Each result carries the
+// network of the database record that matched, or nil if there was none.
+//
+// Readers backed by files also implement io.Closer.
+//
+// Results from readers returned by Merge have Sources set, mapping the name
+// of each field that has a value to the name of the source that supplied it.
 type Reader interface {
 	Country(net.IP) (Country, error)
 	City(net.IP) (City, error)
@@ -14,144 +18,138 @@ type Reader interface {
 	IsEmpty() bool
 }
 
+// Place is a named area, such as a continent, country or subdivision, with
+// its ISO code and GeoNames ID.
+type Place struct {
+	Name      string
+	Names     map[string]string
+	ISO       string
+	GeoNameID uint
+}
+
+// Country describes the country in which an address is located. The
+// registered country is where the ISP registered the network, and the
+// represented country is the one served by e.g. a military base or embassy.
+//
+// Name is the English name. Names maps language codes, such as de or pt-BR,
+// to localized names when the database has them, here and in City and Place.
 type Country struct {
-	Name string
-	ISO  string
-	IsEU *bool
+	Name               string
+	Names              map[string]string
+	ISO                string
+	IsEU               *bool
+	GeoNameID          uint
+	Continent          Place
+	RegisteredCountry  Place
+	RepresentedCountry Place
+	Network            *net.IPNet
+	Sources            map[string]string
 }
 
+// City describes the location of an address. RegionName and RegionCode are
+// those of the first of Subdivisions, which are ordered from the largest to
+// the smallest. AccuracyRadius is the radius in kilometers around the
+// coordinates in which the address is likely located.
 type City struct {
-	Name       string
-	Latitude   float64
-	Longitude  float64
-	PostalCode string
-	Timezone   string
-	MetroCode  uint
-	RegionName string
-	RegionCode string
+	Name           string
+	Names          map[string]string
+	GeoNameID      uint
+	Latitude       float64
+	Longitude      float64
+	AccuracyRadius uint
+	PostalCode     string
+	Timezone       string
+	MetroCode      uint
+	RegionName     string
+	RegionCode     string
+	Subdivisions   []Place
+	Network        *net.IPNet
+	Sources        map[string]string
 }
 
 type ASN struct {
 	AutonomousSystemNumber       uint
 	AutonomousSystemOrganization string
+	Network                      *net.IPNet
+	Sources                      map[string]string
+}
+
+func (p Place) empty() bool {
+	return p.Name == "" && p.ISO == "" && p.GeoNameID == 0
+}
+
+func (c Country) empty() bool {
+	return c.Name == "" && c.ISO == "" && c.IsEU == nil && c.GeoNameID == 0 &&
+		c.Continent.empty() && c.RegisteredCountry.empty() && c.RepresentedCountry.empty()
+}
+
+func (c City) empty() bool {
+	return c.Name == "" && c.RegionName == "" && c.RegionCode == "" && c.PostalCode == "" &&
+		c.Timezone == "" && c.MetroCode == 0 && c.Latitude == 0 && c.Longitude == 0 && c.GeoNameID == 0 &&
+		len(c.Subdivisions) == 0
+}
+
+func (a ASN) empty() bool {
+	return a.AutonomousSystemNumber == 0 && a.AutonomousSystemOrganization == ""
 }
 
 type geoip struct {
-	country *geoip2.Reader
-	city    *geoip2.Reader
-	asn     *geoip2.Reader
+	country *MMDB
+	city    *MMDB
+	asn     *MMDB
 }
 
+// Open opens separate MaxMind databases for countries, cities and ASNs. Empty
+// paths are skipped.
 func Open(countryDB, cityDB string, asnDB string) (Reader, error) {
-	var country, city, asn *geoip2.Reader
-	if countryDB != "" {
-		r, err := geoip2.Open(countryDB)
-		if err != nil {
-			return nil, err
-		}
-		country = r
-	}
-	if cityDB != "" {
-		r, err := geoip2.Open(cityDB)
-		if err != nil {
-			return nil, err
+	g := &geoip{}
+	for _, db := range []struct {
+		path string
+		dst  **MMDB
+	}{{countryDB, &g.country}, {cityDB, &g.city}, {asnDB, &g.asn}} {
+		if db.path == "" {
+			continue
 		}
-		city = r
-	}
-	if asnDB != "" {
-		r, err := geoip2.Open(asnDB)
+		r, err := OpenMMDB(db.path)
 		if err != nil {
+			g.Close()
 			return nil, err
 		}
-		asn = r
+		*db.dst = r
 	}
-	return &geoip{country: country, city: city, asn: asn}, nil
+	return g, nil
 }
 
 func (g *geoip) Country(ip net.IP) (Country, error) {
-	country := Country{}
 	if g.country == nil {
-		return country, nil
-	}
-	record, err := g.country.Country(ip)
-	if err != nil {
-		return country, err
-	}
-	if c, exists := record.Country.Names["en"]; exists {
-		country.Name = c
-	}
-	if c, exists := record.RegisteredCountry.Names["en"]; exists && country.Name == "" {
-		country.Name = c
+		return Country{}, nil
 	}
-	if record.Country.IsoCode != "" {
-		country.ISO = record.Country.IsoCode
-	}
-	if record.RegisteredCountry.IsoCode != "" && country.ISO == "" {
-		country.ISO = record.RegisteredCountry.IsoCode
-	}
-	isEU := record.Country.IsInEuropeanUnion || record.RegisteredCountry.IsInEuropeanUnion
-	country.IsEU = &isEU
-	return country, nil
+	return g.country.Country(ip)
 }
 
 func (g *geoip) City(ip net.IP) (City, error) {
-	city := City{}
 	if g.city == nil {
-		return city, nil
-	}
-	record, err := g.city.City(ip)
-	if err != nil {
-		return city, err
-	}
-	if c, exists := record.City.Names["en"]; exists {
-		city.Name = c
-	}
-	if len(record.Subdivisions) > 0 {
-		if c, exists := record.Subdivisions[0].Names["en"]; exists {
-			city.RegionName = c
-		}
-		if record.Subdivisions[0].IsoCode != "" {
-			city.RegionCode = record.Subdivisions[0].IsoCode
-		}
-	}
-	if !math.IsNaN(record.Location.Latitude) {
-		city.Latitude = record.Location.Latitude
-	}
-	if !math.IsNaN(record.Location.Longitude) {
-		city.Longitude = record.Location.Longitude
-	}
-	// Metro code is US Only https://maxmind.github.io/GeoIP2-dotnet/doc/v2.7.1/html/P_MaxMind_GeoIP2_Model_Location_MetroCode.htm
-	if record.Location.MetroCode > 0 && record.Country.IsoCode == "US" {
-		city.MetroCode = record.Location.MetroCode
+		return City{}, nil
 	}
-	if record.Postal.Code != "" {
-		city.PostalCode = record.Postal.Code
-	}
-	if record.Location.TimeZone != "" {
-		city.Timezone = record.Location.TimeZone
-	}
-
-	return city, nil
+	return g.city.City(ip)
 }
 
 func (g *geoip) ASN(ip net.IP) (ASN, error) {
-	asn := ASN{}
 	if g.asn == nil {
-		return asn, nil
-	}
-	record, err := g.asn.ASN(ip)
-	if err != nil {
-		return asn, err
-	}
-	if record.AutonomousSystemNumber > 0 {
-		asn.AutonomousSystemNumber = record.AutonomousSystemNumber
+		return ASN{}, nil
 	}
-	if record.AutonomousSystemOrganization != "" {
-		asn.AutonomousSystemOrganization = record.AutonomousSystemOrganization
-	}
-	return asn, nil
+	return g.asn.ASN(ip)
 }
 
 func (g *geoip) IsEmpty() bool {
 	return g.country == nil && g.city == nil
 }
+
+func (g *geoip) Close() error {
+	for _, db := range []*MMDB{g.country, g.city, g.asn} {
+		if db != nil {
+			db.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package geo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+
+	"github.com/apimgr/echoip/src/iputil/iprange"
+)
+
+// Column positions by IP2Location database type (DB1 to DB26). Position 1 is
+// the start of the range and 0 means that the type lacks the column.
+var (
+	ip2lCountryPosition   = [27]uint8{0, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+	ip2lRegionPosition    = [27]uint8{0, 0, 0, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
+	ip2lCityPosition      = [27]uint8{0, 0, 0, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}
+	ip2lLatitudePosition  = [27]uint8{0, 0, 0, 0, 0, 5, 5, 0, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+	ip2lLongitudePosition = [27]uint8{0, 0, 0, 0, 0, 6, 6, 0, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6}
+	ip2lZipCodePosition   = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 7, 7, 7, 0, 7, 7, 7, 0, 7, 0, 7, 7, 7, 0, 7, 7, 7}
+	ip2lTimezonePosition  = [27]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 8, 7, 8, 8, 8, 7, 8, 0, 8, 8, 8, 0, 8, 8, 8}
+)
+
+// IP2Location reads IP2Location BIN databases. Records are read from the file
+// on demand.
+type IP2Location struct {
+	f         *os.File
+	dbType    uint8
+	dbColumn  uint8
+	ipv4Count uint32
+	ipv4Addr  uint32
+	ipv6Count uint32
+	ipv6Addr  uint32
+	ipv4Index uint32
+	ipv6Index uint32
+}
+
+// OpenIP2LocationBIN opens the IP2Location BIN file at path.
+func OpenIP2LocationBIN(path string) (*IP2Location, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 29)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header[0] == 'P' && header[1] == 'K' {
+		f.Close()
+		return nil, fmt.Errorf("%s is a zip archive, extract the BIN file first", path)
+	}
+	db := &IP2Location{
+		f:         f,
+		dbType:    header[0],
+		dbColumn:  header[1],
+		ipv4Count: binary.LittleEndian.Uint32(header[5:]),
+		ipv4Addr:  binary.LittleEndian.Uint32(header[9:]),
+		ipv6Count: binary.LittleEndian.Uint32(header[13:]),
+		ipv6Addr:  binary.LittleEndian.Uint32(header[17:]),
+		ipv4Index: binary.LittleEndian.Uint32(header[21:]),
+		ipv6Index: binary.LittleEndian.Uint32(header[25:]),
+	}
+	if db.dbType == 0 || int(db.dbType) >= len(ip2lCountryPosition) || db.dbColumn == 0 || (db.ipv4Count == 0 && db.ipv6Count == 0) {
+		f.Close()
+		return nil, fmt.Errorf("%s is not an IP2Location BIN database", path)
+	}
+	return db, nil
+}
+
+// The positions in a BIN file are 1-based, except for string pointers.
+
+func (db *IP2Location) readUint32(pos int64) (uint32, error) {
+	var b [4]byte
+	if _, err := db.f.ReadAt(b[:], pos-1); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// readUint128 reads a little endian 128-bit number as its big endian bytes.
+func (db *IP2Location) readUint128(pos int64) ([16]byte, error) {
+	var b, n [16]byte
+	if _, err := db.f.ReadAt(b[:], pos-1); err != nil {
+		return n, err
+	}
+	for i := range b {
+		n[15-i] = b[i]
+	}
+	return n, nil
+}
+
+func (db *IP2Location) readFloat32(pos int64) (float64, error) {
+	n, err := db.readUint32(pos)
+	return float64(math.Float32frombits(n)), err
+}
+
+func (db *IP2Location) readString(ptr uint32) (string, error) {
+	var n [1]byte
+	if _, err := db.f.ReadAt(n[:], int64(ptr)); err != nil {
+		return "", err
+	}
+	b := make([]byte, n[0])
+	if _, err := db.f.ReadAt(b, int64(ptr)+1); err != nil {
+		return "", err
+	}
+	if s := string(b); s != "-" {
+		return s, nil
+	}
+	return "", nil
+}
+
+// ip2lRow is a matched record: the position of its first column after the
+// range start, and the range itself.
+type ip2lRow struct {
+	columns    int64
+	start, end net.IP
+}
+
+func (db *IP2Location) lookup(ip net.IP) (*ip2lRow, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return db.lookupIPv4(ip4)
+	}
+	return db.lookupIPv6(ip.To16())
+}
+
+func (db *IP2Location) lookupIPv4(ip net.IP) (*ip2lRow, error) {
+	if db.ipv4Count == 0 {
+		return nil, nil
+	}
+	ipno := binary.BigEndian.Uint32(ip)
+	if ipno == math.MaxUint32 {
+		// The last row starts the sentinel range
+		ipno--
+	}
+	low, high := uint32(0), db.ipv4Count
+	if db.ipv4Index > 0 {
+		var err error
+		pos := int64(db.ipv4Index) + int64(ipno>>16)<<3
+		if low, err = db.readUint32(pos); err != nil {
+			return nil, err
+		}
+		if high, err = db.readUint32(pos + 4); err != nil {
+			return nil, err
+		}
+	}
+	colsize := int64(db.dbColumn) * 4
+	for low <= high {
+		mid := (low + high) / 2
+		row := int64(db.ipv4Addr) + int64(mid)*colsize
+		from, err := db.readUint32(row)
+		if err != nil {
+			return nil, err
+		}
+		to, err := db.readUint32(row + colsize)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ipno >= from && ipno < to:
+			start, end := make(net.IP, 4), make(net.IP, 4)
+			binary.BigEndian.PutUint32(start, from)
+			binary.BigEndian.PutUint32(end, to-1)
+			return &ip2lRow{columns: row + 4, start: start, end: end}, nil
+		case ipno < from:
+			if mid == 0 {
+				return nil, nil
+			}
+			high = mid - 1
+		default:
+			low = mid + 1
+		}
+	}
+	return nil, nil
+}
+
+func (db *IP2Location) lookupIPv6(ip net.IP) (*ip2lRow, error) {
+	if db.ipv6Count == 0 || ip == nil {
+		return nil, nil
+	}
+	ipno := new(big.Int).SetBytes(ip)
+	if ipno.Cmp(maxIPv6) == 0 {
+		ipno.Sub(ipno, big.NewInt(1))
+	}
+	low, high := uint32(0), db.ipv6Count
+	if db.ipv6Index > 0 {
+		var err error
+		pos := int64(db.ipv6Index) + int64(binary.BigEndian.Uint16(ip))<<3
+		if low, err = db.readUint32(pos); err != nil {
+			return nil, err
+		}
+		if high, err = db.readUint32(pos + 4); err != nil {
+			return nil, err
+		}
+	}
+	colsize := 16 + int64(db.dbColumn-1)*4
+	for low <= high {
+		mid := (low + high) / 2
+		row := int64(db.ipv6Addr) + int64(mid)*colsize
+		fromBytes, err := db.readUint128(row)
+		if err != nil {
+			return nil, err
+		}
+		toBytes, err := db.readUint128(row + colsize)
+		if err != nil {
+			return nil, err
+		}
+		from := new(big.Int).SetBytes(fromBytes[:])
+		to := new(big.Int).SetBytes(toBytes[:])
+		switch {
+		case ipno.Cmp(from) >= 0 && ipno.Cmp(to) < 0:
+			end := make(net.IP, 16)
+			to.Sub(to, big.NewInt(1)).FillBytes(end)
+			return &ip2lRow{columns: row + 16, start: net.IP(fromBytes[:]), end: end}, nil
+		case ipno.Cmp(from) < 0:
+			if mid == 0 {
+				return nil, nil
+			}
+			high = mid - 1
+		default:
+			low = mid + 1
+		}
+	}
+	return nil, nil
+}
+
+var maxIPv6 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
+// column returns the file position of the column at pos in row.
+func (row *ip2lRow) column(pos uint8) int64 {
+	return row.columns + int64(pos-2)*4
+}
+
+func (row *ip2lRow) network(ip net.IP) *net.IPNet {
+	return iprange.Network(row.start, row.end, ip)
+}
+
+func (db *IP2Location) stringColumn(row *ip2lRow, pos uint8) (string, error) {
+	ptr, err := db.readUint32(row.column(pos))
+	if err != nil {
+		return "", err
+	}
+	return db.readString(ptr)
+}
+
+func (db *IP2Location) Country(ip net.IP) (Country, error) {
+	country := Country{}
+	row, err := db.lookup(ip)
+	if row == nil {
+		return country, err
+	}
+	ptr, err := db.readUint32(row.column(ip2lCountryPosition[db.dbType]))
+	if err != nil {
+		return country, err
+	}
+	if country.ISO, err = db.readString(ptr); err != nil {
+		return country, err
+	}
+	if country.Name, err = db.readString(ptr + 3); err != nil {
+		return country, err
+	}
+	if country.ISO != "" {
+		country.Network = row.network(ip)
+	}
+	return country, nil
+}
+
+func (db *IP2Location) City(ip net.IP) (City, error) {
+	city := City{}
+	row, err := db.lookup(ip)
+	if row == nil {
+		return city, err
+	}
+	for _, f := range []struct {
+		pos uint8
+		dst *string
+	}{
+		{ip2lRegionPosition[db.dbType], &city.RegionName},
+		{ip2lCityPosition[db.dbType], &city.Name},
+		{ip2lZipCodePosition[db.dbType], &city.PostalCode},
+		{ip2lTimezonePosition[db.dbType], &city.Timezone},
+	} {
+		if f.pos == 0 {
+			continue
+		}
+		if *f.dst, err = db.stringColumn(row, f.pos); err != nil {
+			return city, err
+		}
+	}
+	if pos := ip2lLatitudePosition[db.dbType]; pos != 0 {
+		if city.Latitude, err = db.readFloat32(row.column(pos)); err != nil {
+			return city, err
+		}
+	}
+	if pos := ip2lLongitudePosition[db.dbType]; pos != 0 {
+		if city.Longitude, err = db.readFloat32(row.column(pos)); err != nil {
+			return city, err
+		}
+	}
+	if !city.empty() {
+		city.Network = row.network(ip)
+	}
+	return city, nil
+}
+
+// ASN returns nothing, ASNs are only available in the IP2Location ASN CSV
+// files.
+func (db *IP2Location) ASN(ip net.IP) (ASN, error) {
+	return ASN{}, nil
+}
+
+func (db *IP2Location) IsEmpty() bool {
+	return false
+}
+
+// Close closes the database file.
+func (db *IP2Location) Close() error {
+	return db.f.Close()
+}
@@ -0,0 +1,166 @@
+package geo
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// IPinfo reads IPinfo mmdb databases. The field names of the free (country,
+// ASN, Lite) and paid (location, ASN) schemas are recognised, so a single
+// database may answer any combination of lookups.
+type IPinfo struct {
+	db *maxminddb.Reader
+}
+
+// OpenIPinfo opens the IPinfo mmdb file at path.
+func OpenIPinfo(path string) (*IPinfo, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &IPinfo{db: db}, nil
+}
+
+type ipinfoRecord map[string]interface{}
+
+func (r ipinfoRecord) str(keys ...string) string {
+	for _, k := range keys {
+		switch v := r[k].(type) {
+		case nil:
+		case string:
+			if v != "" {
+				return v
+			}
+		default:
+			// Numbers, e.g. an ASN stored as an integer
+			if f := toFloat(v); f != 0 {
+				return strconv.FormatFloat(f, 'f', -1, 64)
+			}
+		}
+	}
+	return ""
+}
+
+func (r ipinfoRecord) float(keys ...string) float64 {
+	for _, k := range keys {
+		switch v := r[k].(type) {
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		case nil:
+		default:
+			return toFloat(v)
+		}
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+func (g *IPinfo) lookup(ip net.IP) (ipinfoRecord, *net.IPNet, error) {
+	var record ipinfoRecord
+	network, ok, err := g.db.LookupNetwork(ip, &record)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+	return record, network, nil
+}
+
+func (g *IPinfo) Country(ip net.IP) (Country, error) {
+	record, network, err := g.lookup(ip)
+	if record == nil {
+		return Country{}, err
+	}
+	country := Country{Network: network}
+	if code := record.str("country_code"); code != "" {
+		// Lite: country is the name
+		country.ISO = code
+		country.Name = record.str("country")
+	} else {
+		country.ISO = record.str("country")
+		country.Name = record.str("country_name")
+	}
+	if code := record.str("continent_code"); code != "" {
+		country.Continent = Place{Name: record.str("continent"), ISO: code}
+	} else {
+		country.Continent = Place{Name: record.str("continent_name"), ISO: record.str("continent")}
+	}
+	if country.empty() {
+		country.Network = nil
+	}
+	return country, nil
+}
+
+func (g *IPinfo) City(ip net.IP) (City, error) {
+	record, network, err := g.lookup(ip)
+	if record == nil {
+		return City{}, err
+	}
+	city := City{
+		Name:       record.str("city"),
+		RegionName: record.str("region"),
+		RegionCode: record.str("region_code"),
+		Latitude:   record.float("latitude", "lat"),
+		Longitude:  record.float("longitude", "lng"),
+		PostalCode: record.str("postal_code", "postal"),
+		Timezone:   record.str("timezone"),
+	}
+	if !city.empty() {
+		city.Network = network
+	}
+	return city, nil
+}
+
+func (g *IPinfo) ASN(ip net.IP) (ASN, error) {
+	record, network, err := g.lookup(ip)
+	if record == nil {
+		return ASN{}, err
+	}
+	asn := ASN{AutonomousSystemOrganization: record.str("as_name", "name")}
+	if n, err := parseASN(record.str("asn")); err == nil {
+		asn.AutonomousSystemNumber = n
+	}
+	if asn.AutonomousSystemNumber != 0 || asn.AutonomousSystemOrganization != "" {
+		asn.Network = network
+	}
+	return asn, nil
+}
+
+func (g *IPinfo) IsEmpty() bool {
+	return false
+}
+
+// Close unmaps the database file.
+func (g *IPinfo) Close() error {
+	return g.db.Close()
+}
+
+// parseASN parses an AS number with or without the AS prefix.
+func parseASN(s string) (uint, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint(n), err
+}
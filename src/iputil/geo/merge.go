@@ -0,0 +1,187 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Source is a Reader with a name that identifies it in the Sources of merged
+// results.
+type Source struct {
+	Name   string
+	Reader Reader
+}
+
+type merged struct {
+	countries []Source
+	cities    []Source
+	asns      []Source
+}
+
+// Merge returns a Reader that consults countries, cities and asns for the
+// respective lookups. Each field of a result is taken from the first source,
+// in order, that has a value for it, and Sources records which source that
+// was. Localized names are taken along with the name, and latitude, longitude
+// and accuracy radius are always taken from the same source. Errors from a
+// source are returned once the remaining sources have been consulted.
+func Merge(countries, cities, asns []Source) Reader {
+	return &merged{countries: countries, cities: cities, asns: asns}
+}
+
+// fill sets *dst to v and records source for field if *dst is not set yet and
+// v is. It reports whether *dst was set.
+func fill[T comparable](sources map[string]string, field, source string, dst *T, v T) bool {
+	var zero T
+	if *dst != zero || v == zero {
+		return false
+	}
+	*dst = v
+	sources[field] = source
+	return true
+}
+
+// fillPlace sets *dst to v and records source for field if *dst is empty and
+// v is not. It reports whether *dst was set.
+func fillPlace(sources map[string]string, field, source string, dst *Place, v Place) bool {
+	if !dst.empty() || v.empty() {
+		return false
+	}
+	*dst = v
+	sources[field] = source
+	return true
+}
+
+// moreSpecific returns the longer of two prefixes containing the same
+// address.
+func moreSpecific(a, b *net.IPNet) *net.IPNet {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	// Compare IPv4 prefixes as their IPv4-mapped equivalent
+	if bOnes+128-bBits > aOnes+128-aBits {
+		return b
+	}
+	return a
+}
+
+func (m *merged) Country(ip net.IP) (Country, error) {
+	country := Country{Sources: make(map[string]string)}
+	var errs []error
+	for _, s := range m.countries {
+		c, err := s.Reader.Country(ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			continue
+		}
+		filled := fill(country.Sources, "Name", s.Name, &country.Name, c.Name)
+		if filled {
+			country.Names = c.Names
+		}
+		filled = fill(country.Sources, "ISO", s.Name, &country.ISO, c.ISO) || filled
+		filled = fill(country.Sources, "IsEU", s.Name, &country.IsEU, c.IsEU) || filled
+		filled = fill(country.Sources, "GeoNameID", s.Name, &country.GeoNameID, c.GeoNameID) || filled
+		filled = fillPlace(country.Sources, "Continent", s.Name, &country.Continent, c.Continent) || filled
+		filled = fillPlace(country.Sources, "RegisteredCountry", s.Name, &country.RegisteredCountry, c.RegisteredCountry) || filled
+		filled = fillPlace(country.Sources, "RepresentedCountry", s.Name, &country.RepresentedCountry, c.RepresentedCountry) || filled
+		if filled {
+			country.Network = moreSpecific(country.Network, c.Network)
+		}
+	}
+	return country, errors.Join(errs...)
+}
+
+func (m *merged) City(ip net.IP) (City, error) {
+	city := City{Sources: make(map[string]string)}
+	var errs []error
+	for _, s := range m.cities {
+		c, err := s.Reader.City(ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			continue
+		}
+		filled := fill(city.Sources, "Name", s.Name, &city.Name, c.Name)
+		if filled {
+			city.Names = c.Names
+		}
+		filled = fill(city.Sources, "GeoNameID", s.Name, &city.GeoNameID, c.GeoNameID) || filled
+		filled = fill(city.Sources, "RegionName", s.Name, &city.RegionName, c.RegionName) || filled
+		filled = fill(city.Sources, "RegionCode", s.Name, &city.RegionCode, c.RegionCode) || filled
+		filled = fill(city.Sources, "PostalCode", s.Name, &city.PostalCode, c.PostalCode) || filled
+		filled = fill(city.Sources, "Timezone", s.Name, &city.Timezone, c.Timezone) || filled
+		filled = fill(city.Sources, "MetroCode", s.Name, &city.MetroCode, c.MetroCode) || filled
+		if len(city.Subdivisions) == 0 && len(c.Subdivisions) > 0 {
+			city.Subdivisions = c.Subdivisions
+			city.Sources["Subdivisions"] = s.Name
+			filled = true
+		}
+		if city.Latitude == 0 && city.Longitude == 0 && (c.Latitude != 0 || c.Longitude != 0) {
+			city.Latitude, city.Longitude = c.Latitude, c.Longitude
+			city.Sources["Latitude"] = s.Name
+			city.Sources["Longitude"] = s.Name
+			if c.AccuracyRadius > 0 {
+				city.AccuracyRadius = c.AccuracyRadius
+				city.Sources["AccuracyRadius"] = s.Name
+			}
+			filled = true
+		}
+		if filled {
+			city.Network = moreSpecific(city.Network, c.Network)
+		}
+	}
+	return city, errors.Join(errs...)
+}
+
+func (m *merged) ASN(ip net.IP) (ASN, error) {
+	asn := ASN{Sources: make(map[string]string)}
+	var errs []error
+	for _, s := range m.asns {
+		a, err := s.Reader.ASN(ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			continue
+		}
+		filled := fill(asn.Sources, "AutonomousSystemNumber", s.Name, &asn.AutonomousSystemNumber, a.AutonomousSystemNumber)
+		filled = fill(asn.Sources, "AutonomousSystemOrganization", s.Name, &asn.AutonomousSystemOrganization, a.AutonomousSystemOrganization) || filled
+		if filled {
+			asn.Network = moreSpecific(asn.Network, a.Network)
+		}
+	}
+	return asn, errors.Join(errs...)
+}
+
+func (m *merged) IsEmpty() bool {
+	for _, sources := range [][]Source{m.countries, m.cities} {
+		for _, s := range sources {
+			if !s.Reader.IsEmpty() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Close closes every source that implements io.Closer, once.
+func (m *merged) Close() error {
+	closed := make(map[Reader]bool)
+	var errs []error
+	for _, sources := range [][]Source{m.countries, m.cities, m.asns} {
+		for _, s := range sources {
+			c, ok := s.Reader.(io.Closer)
+			if !ok || closed[s.Reader] {
+				continue
+			}
+			closed[s.Reader] = true
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type staticReader struct {
+	country Country
+	city    City
+	asn     ASN
+	err     error
+}
+
+func (r *staticReader) Country(net.IP) (Country, error) { return r.country, r.err }
+func (r *staticReader) City(net.IP) (City, error)       { return r.city, r.err }
+func (r *staticReader) ASN(net.IP) (ASN, error)         { return r.asn, r.err }
+func (r *staticReader) IsEmpty() bool {
+	return r.country.empty() && r.city.empty()
+}
+
+func cidr(s string) *net.IPNet {
+	_, n, _ := net.ParseCIDR(s)
+	return n
+}
+
+func TestMerge(t *testing.T) {
+	eu := true
+	commercial := Source{"commercial", &staticReader{
+		country: Country{ISO: "DE", Network: cidr("10.0.0.0/24")},
+		city:    City{Name: "Berlin", Latitude: 52.52, AccuracyRadius: 5, Network: cidr("10.0.0.0/24")},
+	}}
+	free := Source{"free", &staticReader{
+		country: Country{Name: "Germany", ISO: "AT", IsEU: &eu, Network: cidr("10.0.0.0/16")},
+		city: City{Name: "Munich", Latitude: 48.1, Longitude: 11.6, AccuracyRadius: 100, Timezone: "Europe/Berlin",
+			Subdivisions: []Place{{Name: "Bavaria", ISO: "BY"}}, Network: cidr("10.0.0.0/8")},
+		asn: ASN{AutonomousSystemNumber: 64500, Network: cidr("10.0.0.0/12")},
+	}}
+	broken := Source{"broken", &staticReader{err: errors.New("read error")}}
+	asnOnly := Source{"asn", &staticReader{asn: ASN{AutonomousSystemNumber: 64501, AutonomousSystemOrganization: "Example", Network: cidr("10.0.0.0/20")}}}
+
+	r := Merge([]Source{commercial, broken, free}, []Source{commercial, free}, []Source{asnOnly, free})
+	ip := net.ParseIP("10.0.0.1")
+
+	country, err := r.Country(ip)
+	if err == nil || err.Error() != "broken: read error" {
+		t.Errorf("Country error = %v, want broken: read error", err)
+	}
+	want := Country{Name: "Germany", ISO: "DE", IsEU: &eu, Network: cidr("10.0.0.0/24"),
+		Sources: map[string]string{"Name": "free", "ISO": "commercial", "IsEU": "free"}}
+	if !reflect.DeepEqual(country, want) {
+		t.Errorf("Country = %+v, want %+v", country, want)
+	}
+
+	city, err := r.City(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Coordinates are taken together from the first source that has them
+	wantCity := City{Name: "Berlin", Latitude: 52.52, AccuracyRadius: 5, Timezone: "Europe/Berlin",
+		Subdivisions: []Place{{Name: "Bavaria", ISO: "BY"}}, Network: cidr("10.0.0.0/24"),
+		Sources: map[string]string{"Name": "commercial", "Latitude": "commercial", "Longitude": "commercial",
+			"AccuracyRadius": "commercial", "Timezone": "free", "Subdivisions": "free"}}
+	if !reflect.DeepEqual(city, wantCity) {
+		t.Errorf("City = %+v, want %+v", city, wantCity)
+	}
+
+	asn, err := r.ASN(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantASN := ASN{AutonomousSystemNumber: 64501, AutonomousSystemOrganization: "Example", Network: cidr("10.0.0.0/20"),
+		Sources: map[string]string{"AutonomousSystemNumber": "asn", "AutonomousSystemOrganization": "asn"}}
+	if !reflect.DeepEqual(asn, wantASN) {
+		t.Errorf("ASN = %+v, want %+v", asn, wantASN)
+	}
+
+	if r.IsEmpty() {
+		t.Error("IsEmpty() = true, want false")
+	}
+	if !Merge(nil, nil, []Source{asnOnly}).IsEmpty() {
+		t.Error("IsEmpty() = false for ASN only sources, want true")
+	}
+}
+
+func TestMergeMissingRecord(t *testing.T) {
+	primary, err := OpenMMDB(writeMMDB(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary, err := OpenCSV(writeFile(t, "test.csv", "network,country_iso,country_eu\n10.0.0.0/8,DE,true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Merge([]Source{{"mmdb", primary}, {"csv", secondary}}, nil, nil)
+	country, err := r.Country(net.ParseIP("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A source without a record does not tell whether the country is in the EU
+	if country.ISO != "DE" || country.IsEU == nil || !*country.IsEU {
+		t.Errorf("Country = %+v, want DE in the EU", country)
+	}
+	if got := country.Sources["IsEU"]; got != "csv" {
+		t.Errorf("Source of IsEU = %q, want csv", got)
+	}
+}
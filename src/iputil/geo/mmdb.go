@@ -0,0 +1,141 @@
+package geo
+
+import (
+	"math"
+	"net"
+
+	geoip2 "github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDB reads a MaxMind DB file using the GeoIP2/GeoLite2 schema. Country and
+// city lookups return nothing for ASN databases and vice versa.
+type MMDB struct {
+	db *maxminddb.Reader
+}
+
+// OpenMMDB opens the MaxMind DB file at path.
+func OpenMMDB(path string) (*MMDB, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{db: db}, nil
+}
+
+func (m *MMDB) Country(ip net.IP) (Country, error) {
+	country := Country{}
+	var record geoip2.Country
+	network, ok, err := m.db.LookupNetwork(ip, &record)
+	if err != nil {
+		return country, err
+	}
+	if ok {
+		country.Network = network
+	}
+	if c, exists := record.Country.Names["en"]; exists {
+		country.Name = c
+		country.Names = record.Country.Names
+	}
+	if c, exists := record.RegisteredCountry.Names["en"]; exists && country.Name == "" {
+		country.Name = c
+		country.Names = record.RegisteredCountry.Names
+	}
+	if record.Country.IsoCode != "" {
+		country.ISO = record.Country.IsoCode
+	}
+	if record.RegisteredCountry.IsoCode != "" && country.ISO == "" {
+		country.ISO = record.RegisteredCountry.IsoCode
+	}
+	if ok && (country.ISO != "" || record.Country.GeoNameID != 0 || record.RegisteredCountry.GeoNameID != 0) {
+		// Only a country that was found is known to be in or outside the EU
+		isEU := record.Country.IsInEuropeanUnion || record.RegisteredCountry.IsInEuropeanUnion
+		country.IsEU = &isEU
+	}
+	country.GeoNameID = record.Country.GeoNameID
+	country.Continent = place(record.Continent.Names, record.Continent.Code, record.Continent.GeoNameID)
+	country.RegisteredCountry = place(record.RegisteredCountry.Names, record.RegisteredCountry.IsoCode,
+		record.RegisteredCountry.GeoNameID)
+	country.RepresentedCountry = place(record.RepresentedCountry.Names, record.RepresentedCountry.IsoCode,
+		record.RepresentedCountry.GeoNameID)
+	return country, nil
+}
+
+func (m *MMDB) City(ip net.IP) (City, error) {
+	city := City{}
+	var record geoip2.City
+	network, ok, err := m.db.LookupNetwork(ip, &record)
+	if err != nil {
+		return city, err
+	}
+	if ok {
+		city.Network = network
+	}
+	if c, exists := record.City.Names["en"]; exists {
+		city.Name = c
+		city.Names = record.City.Names
+	}
+	city.GeoNameID = record.City.GeoNameID
+	for _, s := range record.Subdivisions {
+		city.Subdivisions = append(city.Subdivisions, place(s.Names, s.IsoCode, s.GeoNameID))
+	}
+	if len(city.Subdivisions) > 0 {
+		city.RegionName = city.Subdivisions[0].Name
+		city.RegionCode = city.Subdivisions[0].ISO
+	}
+	if !math.IsNaN(record.Location.Latitude) {
+		city.Latitude = record.Location.Latitude
+	}
+	if !math.IsNaN(record.Location.Longitude) {
+		city.Longitude = record.Location.Longitude
+	}
+	city.AccuracyRadius = uint(record.Location.AccuracyRadius)
+	// Metro code is US Only https://maxmind.github.io/GeoIP2-dotnet/doc/v2.7.1/html/P_MaxMind_GeoIP2_Model_Location_MetroCode.htm
+	if record.Location.MetroCode > 0 && record.Country.IsoCode == "US" {
+		city.MetroCode = record.Location.MetroCode
+	}
+	if record.Postal.Code != "" {
+		city.PostalCode = record.Postal.Code
+	}
+	if record.Location.TimeZone != "" {
+		city.Timezone = record.Location.TimeZone
+	}
+	return city, nil
+}
+
+// place returns the Place for a record with the given localized names.
+func place(names map[string]string, iso string, geoNameID uint) Place {
+	p := Place{Name: names["en"], ISO: iso, GeoNameID: geoNameID}
+	if len(names) > 0 {
+		p.Names = names
+	}
+	return p
+}
+
+func (m *MMDB) ASN(ip net.IP) (ASN, error) {
+	asn := ASN{}
+	var record geoip2.ASN
+	network, ok, err := m.db.LookupNetwork(ip, &record)
+	if err != nil {
+		return asn, err
+	}
+	if ok {
+		asn.Network = network
+	}
+	if record.AutonomousSystemNumber > 0 {
+		asn.AutonomousSystemNumber = record.AutonomousSystemNumber
+	}
+	if record.AutonomousSystemOrganization != "" {
+		asn.AutonomousSystemOrganization = record.AutonomousSystemOrganization
+	}
+	return asn, nil
+}
+
+func (m *MMDB) IsEmpty() bool {
+	return false
+}
+
+// Close unmaps the database file. The MMDB must not be used afterwards.
+func (m *MMDB) Close() error {
+	return m.db.Close()
+}
@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener opens a database file as a Reader.
+type Opener func(path string) (Reader, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Opener)
+)
+
+func init() {
+	Register("maxmind", func(path string) (Reader, error) { return OpenMMDB(path) })
+	Register("ipinfo", func(path string) (Reader, error) { return OpenIPinfo(path) })
+	Register("ip2location-bin", func(path string) (Reader, error) { return OpenIP2LocationBIN(path) })
+	Register("ip2location-csv", func(path string) (Reader, error) { return OpenIP2LocationCSV(path) })
+	Register("dbip-csv", func(path string) (Reader, error) { return OpenDBIPCSV(path) })
+	Register("csv", func(path string) (Reader, error) { return OpenCSV(path) })
+}
+
+// Register makes a database format available to OpenProvider under name. It
+// panics if a provider with the same name is already registered.
+func Register(name string, open Opener) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, dup := providers[name]; dup {
+		panic("geo: Register called twice for provider " + name)
+	}
+	providers[name] = open
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenProvider opens the database at path with the named provider.
+func OpenProvider(name, path string) (Reader, error) {
+	providersMu.RLock()
+	open, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown geo provider %q (available: %s)", name, strings.Join(Providers(), ", "))
+	}
+	r, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,323 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMMDB writes an IPv4 MaxMind DB that maps every address to record, or
+// that has no record for any address if record is nil.
+// Only string values are supported.
+func writeMMDB(t *testing.T, record map[string]string) string {
+	var b bytes.Buffer
+	if record == nil {
+		// One node whose records both point to no data
+		b.Write([]byte{0, 0, 1, 0, 0, 1})
+	} else {
+		// One node whose records both point to the first data entry
+		b.Write([]byte{0, 0, 17, 0, 0, 17})
+	}
+	b.Write(make([]byte, 16))
+	b.WriteByte(7<<5 | byte(len(record)))
+	for k, v := range record {
+		for _, s := range []string{k, v} {
+			b.WriteByte(2<<5 | byte(len(s)))
+			b.WriteString(s)
+		}
+	}
+	b.WriteString("\xAB\xCD\xEFMaxMind.com")
+	b.WriteByte(7<<5 | 3)
+	for _, m := range []struct {
+		key   string
+		value []byte
+	}{
+		{"node_count", []byte{6<<5 | 1, 1}},
+		{"record_size", []byte{5<<5 | 1, 24}},
+		{"ip_version", []byte{5<<5 | 1, 4}},
+	} {
+		b.WriteByte(2<<5 | byte(len(m.key)))
+		b.WriteString(m.key)
+		b.Write(m.value)
+	}
+	return writeFile(t, "test.mmdb", b.String())
+}
+
+type binRow struct {
+	from                       net.IP
+	iso, country, region, city string
+	lat, lon                   float32
+}
+
+// writeIP2LocationBIN writes a DB5 database (country, region, city, latitude
+// and longitude) without index.
+func writeIP2LocationBIN(t *testing.T, ipv4, ipv6 []binRow) string {
+	const headerSize, columns = 64, 6
+	ipv4Size := 4 * columns
+	ipv6Size := 16 + 4*(columns-1)
+	ipv4Addr := headerSize + 1
+	ipv6Addr := ipv4Addr + (len(ipv4)+1)*ipv4Size
+	stringsAddr := ipv6Addr + (len(ipv6)+1)*ipv6Size
+
+	var strs bytes.Buffer
+	str := func(s string) uint32 {
+		if s == "" {
+			s = "-"
+		}
+		ptr := uint32(stringsAddr - 1 + strs.Len())
+		strs.WriteByte(byte(len(s)))
+		strs.WriteString(s)
+		return ptr
+	}
+	var data bytes.Buffer
+	le := func(v interface{}) { binary.Write(&data, binary.LittleEndian, v) }
+	row := func(r binRow) {
+		// The country name follows 3 bytes after the code
+		le(str(r.iso))
+		if r.iso == "" {
+			strs.WriteByte(0)
+		}
+		str(r.country)
+		le(str(r.region))
+		le(str(r.city))
+		le(math.Float32bits(r.lat))
+		le(math.Float32bits(r.lon))
+	}
+	header := make([]byte, headerSize)
+	header[0], header[1] = 5, columns
+	binary.LittleEndian.PutUint32(header[5:], uint32(len(ipv4)))
+	binary.LittleEndian.PutUint32(header[9:], uint32(ipv4Addr))
+	binary.LittleEndian.PutUint32(header[13:], uint32(len(ipv6)))
+	binary.LittleEndian.PutUint32(header[17:], uint32(ipv6Addr))
+	data.Write(header)
+	for _, r := range append(ipv4, binRow{from: net.ParseIP("255.255.255.255")}) {
+		le(binary.BigEndian.Uint32(r.from.To4()))
+		row(r)
+	}
+	for _, r := range append(ipv6, binRow{from: net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")}) {
+		for i := 15; i >= 0; i-- {
+			data.WriteByte(r.from[i])
+		}
+		row(r)
+	}
+	io.Copy(&data, &strs)
+	return writeFile(t, "test.bin", data.String())
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type lookup struct {
+	ip      string
+	iso     string
+	country string
+	// continent is the continent code
+	continent string
+	city      string
+	region    string
+	lat       float64
+	lon       float64
+	asn       uint
+	asnOrg    string
+	network   string
+}
+
+func TestProviders(t *testing.T) {
+	var tests = []struct {
+		provider string
+		path     string
+		empty    bool
+		lookups  []lookup
+	}{
+		{
+			provider: "csv",
+			path: writeFile(t, "test.csv", "network,continent_code,country_iso,country,city,latitude,longitude,accuracy_radius,asn,asn_org\n"+
+				"10.0.0.0/8,EU,NO,Norway,Oslo,59.91,10.75,20,AS64500,Example\n"+
+				"2001:db8::/32,,SE,Sweden,,,,,,\n"),
+			lookups: []lookup{
+				{ip: "10.1.2.3", iso: "NO", country: "Norway", continent: "EU", city: "Oslo", lat: 59.91, lon: 10.75, asn: 64500, asnOrg: "Example", network: "10.0.0.0/8"},
+				{ip: "2001:db8::1", iso: "SE", country: "Sweden", network: "2001:db8::/32"},
+				{ip: "192.0.2.1"},
+			},
+		},
+		{
+			provider: "csv",
+			path:     writeFile(t, "asn.csv", "start,end,asn,asn_org\n192.0.2.0,192.0.2.127,64501,Example\n"),
+			empty:    true,
+			lookups: []lookup{
+				{ip: "192.0.2.5", asn: 64501, asnOrg: "Example"},
+			},
+		},
+		{
+			provider: "ip2location-csv",
+			path: writeFile(t, "db11.csv", `"0","16777215","-","-","-","-","0.000000","0.000000","-","-"
+"16777216","16777471","AU","Australia","Queensland","Brisbane","-27.467940","153.028090","4000","+10:00"
+"16777472","4294967295","-","-","-","-","0.000000","0.000000","-","-"
+`),
+			lookups: []lookup{
+				{ip: "1.0.0.1", iso: "AU", country: "Australia", region: "Queensland", city: "Brisbane", lat: -27.46794, lon: 153.02809, network: "1.0.0.0/24"},
+				{ip: "8.8.8.8"},
+			},
+		},
+		{
+			// The first rows of an IPv6 file start with both families
+			provider: "ip2location-csv",
+			path: writeFile(t, "db1-ipv6.csv", `"0","281470681743359","-","-"
+"281470681743360","281470698520575","-","-"
+"281470698520576","281470698520831","US","United States of America"
+"281470698520832","281470698521599","CN","China"
+"42540766411282592856903984951653826560","42540766490510755371168322545197776895","SE","Sweden"
+`),
+			lookups: []lookup{
+				{ip: "1.0.0.1", iso: "US", country: "United States of America", network: "1.0.0.0/24"},
+				{ip: "1.0.2.1", iso: "CN", country: "China", network: "1.0.2.0/23"},
+				{ip: "2001:db8::1", iso: "SE", country: "Sweden", network: "2001:db8::/32"},
+				{ip: "::1"},
+			},
+		},
+		{
+			provider: "ip2location-csv",
+			path: writeFile(t, "asn.csv", `"16777216","16777471","1.0.0.0/24","13335","CloudFlare Inc"
+"281470698520576","281470698520831","::ffff:1.0.0.0/120","13335","CloudFlare Inc"
+`),
+			empty: true,
+			lookups: []lookup{
+				{ip: "1.0.0.1", asn: 13335, asnOrg: "CloudFlare Inc"},
+			},
+		},
+		{
+			provider: "dbip-csv",
+			path: writeFile(t, "city.csv", `1.0.0.0,1.0.0.255,OC,AU,Queensland,"South Brisbane",-27.4767,153.017
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,EU,SE,Stockholm,Stockholm,59.3293,18.0686
+`),
+			lookups: []lookup{
+				{ip: "1.0.0.1", iso: "AU", continent: "OC", region: "Queensland", city: "South Brisbane", lat: -27.4767, lon: 153.017, network: "1.0.0.0/24"},
+				{ip: "2001:db8::1", iso: "SE", continent: "EU", region: "Stockholm", city: "Stockholm", lat: 59.3293, lon: 18.0686, network: "2001:db8::/32"},
+			},
+		},
+		{
+			provider: "dbip-csv",
+			path:     writeFile(t, "asn.csv", "1.0.0.0,1.0.0.255,13335,\"Cloudflare, Inc.\"\n"),
+			empty:    true,
+			lookups: []lookup{
+				{ip: "1.0.0.1", asn: 13335, asnOrg: "Cloudflare, Inc."},
+			},
+		},
+		{
+			provider: "ip2location-bin",
+			path: writeIP2LocationBIN(t, []binRow{
+				{from: net.ParseIP("0.0.0.0")},
+				{from: net.ParseIP("1.0.0.0"), iso: "NO", country: "Norway", region: "Oslo", city: "Oslo", lat: 59.9127, lon: 10.7461},
+				{from: net.ParseIP("1.0.1.0")},
+			}, []binRow{
+				{from: net.ParseIP("::")},
+				{from: net.ParseIP("2001:db8::"), iso: "SE", country: "Sweden", region: "Stockholm", city: "Stockholm", lat: 59.3293, lon: 18.0686},
+				{from: net.ParseIP("2001:db9::")},
+			}),
+			lookups: []lookup{
+				{ip: "1.0.0.200", iso: "NO", country: "Norway", region: "Oslo", city: "Oslo", lat: float64(float32(59.9127)), lon: float64(float32(10.7461)), network: "1.0.0.0/24"},
+				{ip: "2001:db8::1", iso: "SE", country: "Sweden", region: "Stockholm", city: "Stockholm", lat: float64(float32(59.3293)), lon: float64(float32(18.0686)), network: "2001:db8::/32"},
+				{ip: "255.255.255.255"},
+				{ip: "8.8.8.8"},
+			},
+		},
+		{
+			provider: "ipinfo",
+			path: writeMMDB(t, map[string]string{
+				"country_code":   "NO",
+				"country":        "Norway",
+				"continent_code": "EU",
+				"continent":      "Europe",
+				"asn":            "AS64500",
+				"as_name":        "Example",
+			}),
+			lookups: []lookup{
+				{ip: "1.2.3.4", iso: "NO", country: "Norway", continent: "EU", asn: 64500, asnOrg: "Example", network: "0.0.0.0/1"},
+			},
+		},
+		{
+			provider: "ipinfo",
+			path: writeMMDB(t, map[string]string{
+				"city":      "Oslo",
+				"region":    "Oslo",
+				"country":   "NO",
+				"latitude":  "59.91273",
+				"longitude": "10.74609",
+			}),
+			lookups: []lookup{
+				{ip: "1.2.3.4", iso: "NO", city: "Oslo", region: "Oslo", lat: 59.91273, lon: 10.74609, network: "0.0.0.0/1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		r, err := OpenProvider(tt.provider, tt.path)
+		if err != nil {
+			t.Errorf("%s: %s", tt.provider, err)
+			continue
+		}
+		if r.IsEmpty() != tt.empty {
+			t.Errorf("%s %s: IsEmpty() = %t, want %t", tt.provider, filepath.Base(tt.path), r.IsEmpty(), tt.empty)
+		}
+		for _, l := range tt.lookups {
+			ip := net.ParseIP(l.ip)
+			country, err := r.Country(ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			city, err := r.City(ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			asn, err := r.ASN(ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			network := ""
+			if country.Network != nil {
+				network = country.Network.String()
+			}
+			got := lookup{l.ip, country.ISO, country.Name, country.Continent.ISO, city.Name, city.RegionName, city.Latitude, city.Longitude,
+				asn.AutonomousSystemNumber, asn.AutonomousSystemOrganization, network}
+			if got != l {
+				t.Errorf("%s %s:\n got %+v\nwant %+v", tt.provider, filepath.Base(tt.path), got, l)
+			}
+		}
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func TestOpenProviderErrors(t *testing.T) {
+	var tests = []struct {
+		provider string
+		path     string
+		err      string
+	}{
+		{"foo", "", `unknown geo provider "foo" (available: csv, dbip-csv, ip2location-bin, ip2location-csv, ipinfo, maxmind)`},
+		{"csv", writeFile(t, "test.csv", "network,foo\n"), `unknown column "foo"`},
+		{"csv", writeFile(t, "test.csv", "country\n"), "header must contain either network or start and end"},
+		{"csv", writeFile(t, "test.csv", "network,asn\n10.0.0.0/8,ASfoo\n"), "test.csv:2: invalid asn"},
+		{"ip2location-csv", writeFile(t, "test.csv", `"1","2","NO","Norway","Oslo"`+"\n"), "unsupported IP2Location CSV with 5 columns"},
+		{"dbip-csv", writeFile(t, "test.csv", "1.0.0.0,1.0.0.255,foo,bar,baz\n"), "unsupported DB-IP CSV with 5 columns"},
+		{"ip2location-bin", writeFile(t, "test.bin", "PK\x03\x04"+strings.Repeat("\x00", 60)), "is a zip archive"},
+		{"ip2location-bin", writeFile(t, "test.bin", strings.Repeat("\x00", 64)), "is not an IP2Location BIN database"},
+	}
+	for _, tt := range tests {
+		_, err := OpenProvider(tt.provider, tt.path)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("OpenProvider(%s) = %v, want error containing %q", tt.provider, err, tt.err)
+		}
+	}
+}
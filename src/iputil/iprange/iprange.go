@@ -0,0 +1,145 @@
+// Package iprange maps IP address ranges to values.
+package iprange
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// key is an address in its 16-byte form. IPv4 addresses are stored
+// IPv4-mapped, so they sort below all other IPv6 addresses but above ::.
+type key [16]byte
+
+func toKey(ip net.IP) (key, bool) {
+	var k key
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return k, false
+	}
+	copy(k[:], ip16)
+	return k, true
+}
+
+func (k key) less(o key) bool {
+	return bytes.Compare(k[:], o[:]) < 0
+}
+
+type entry[T any] struct {
+	start, end key
+	value      T
+}
+
+// Table maps non-overlapping address ranges to values. Ranges are added with
+// Add or AddNetwork and Sort must be called before Lookup. A sorted Table is
+// safe for concurrent lookups.
+type Table[T any] struct {
+	entries []entry[T]
+}
+
+// Add maps the addresses from start to end, inclusive, to v.
+func (t *Table[T]) Add(start, end net.IP, v T) error {
+	s, ok1 := toKey(start)
+	e, ok2 := toKey(end)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	if (start.To4() == nil) != (end.To4() == nil) {
+		return fmt.Errorf("range %s-%s mixes IPv4 and IPv6", start, end)
+	}
+	if e.less(s) {
+		return fmt.Errorf("range %s-%s ends before it starts", start, end)
+	}
+	t.entries = append(t.entries, entry[T]{start: s, end: e, value: v})
+	return nil
+}
+
+// AddNetwork maps all addresses in n to v.
+func (t *Table[T]) AddNetwork(n *net.IPNet, v T) error {
+	start := n.IP.Mask(n.Mask)
+	if start == nil {
+		return fmt.Errorf("invalid network %s", n)
+	}
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^n.Mask[i]
+	}
+	return t.Add(start, end, v)
+}
+
+// Len returns the number of ranges in t.
+func (t *Table[T]) Len() int {
+	return len(t.entries)
+}
+
+// Sort prepares t for lookups.
+func (t *Table[T]) Sort() {
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return t.entries[i].start.less(t.entries[j].start)
+	})
+}
+
+// Lookup returns the value of the range containing ip, and the largest
+// network around ip that lies within that range.
+func (t *Table[T]) Lookup(ip net.IP) (T, *net.IPNet, bool) {
+	var zero T
+	k, ok := toKey(ip)
+	if !ok {
+		return zero, nil, false
+	}
+	// First range starting after ip; the candidate is the one before it
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return k.less(t.entries[i].start)
+	})
+	if i == 0 {
+		return zero, nil, false
+	}
+	e := t.entries[i-1]
+	if e.end.less(k) {
+		return zero, nil, false
+	}
+	return e.value, network(e.start, e.end, k), true
+}
+
+// Network returns the largest network containing ip that lies within the
+// range from start to end, or nil if ip is not in the range.
+func Network(start, end, ip net.IP) *net.IPNet {
+	s, ok1 := toKey(start)
+	e, ok2 := toKey(end)
+	k, ok3 := toKey(ip)
+	if !ok1 || !ok2 || !ok3 || k.less(s) || e.less(k) {
+		return nil
+	}
+	return network(s, e, k)
+}
+
+func network(start, end, ip key) *net.IPNet {
+	bits := 0
+	if net.IP(ip[:]).To4() != nil {
+		// Only consider prefixes within ::ffff:0:0/96
+		bits = 96
+	}
+	for ; bits < 128; bits++ {
+		mask := net.CIDRMask(bits, 128)
+		var first, last key
+		for i := range ip {
+			first[i] = ip[i] & mask[i]
+			last[i] = ip[i] | ^mask[i]
+		}
+		if !first.less(start) && !end.less(last) {
+			break
+		}
+	}
+	return toNet(ip, bits)
+}
+
+func toNet(ip key, bits int) *net.IPNet {
+	mask := net.CIDRMask(bits, 128)
+	n := &net.IPNet{IP: net.IP(ip[:]).Mask(mask), Mask: mask}
+	if ip4 := n.IP.To4(); ip4 != nil && bits >= 96 {
+		n.IP = ip4
+		n.Mask = net.CIDRMask(bits-96, 32)
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package iprange
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	var tbl Table[string]
+	ranges := []struct {
+		start, end, value string
+	}{
+		{"10.0.0.0", "10.0.0.255", "a"},
+		{"1.0.0.0", "1.0.0.9", "b"},
+		{"2001:db8::", "2001:db8::ffff", "c"},
+		{"192.168.1.1", "192.168.1.1", "d"},
+	}
+	for _, r := range ranges {
+		if err := tbl.Add(net.ParseIP(r.start), net.ParseIP(r.end), r.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, n, _ := net.ParseCIDR("172.16.0.0/12")
+	if err := tbl.AddNetwork(n, "e"); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Sort()
+
+	var tests = []struct {
+		ip      string
+		value   string
+		network string
+	}{
+		{"10.0.0.1", "a", "10.0.0.0/24"},
+		{"1.0.0.3", "b", "1.0.0.0/29"},
+		{"1.0.0.9", "b", "1.0.0.8/31"},
+		{"1.0.0.10", "", ""},
+		{"0.0.0.0", "", ""},
+		{"2001:db8::1", "c", "2001:db8::/112"},
+		{"::ffff:10.0.0.5", "a", "10.0.0.0/24"},
+		{"192.168.1.1", "d", "192.168.1.1/32"},
+		{"172.31.255.255", "e", "172.16.0.0/12"},
+		{"2001:db9::", "", ""},
+	}
+	for _, tt := range tests {
+		v, n, ok := tbl.Lookup(net.ParseIP(tt.ip))
+		if ok != (tt.value != "") || v != tt.value {
+			t.Errorf("Lookup(%s) = %q, %t, want %q", tt.ip, v, ok, tt.value)
+			continue
+		}
+		if ok && n.String() != tt.network {
+			t.Errorf("Lookup(%s) network = %s, want %s", tt.ip, n, tt.network)
+		}
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	var tbl Table[int]
+	var tests = []struct {
+		start, end string
+	}{
+		{"10.0.0.2", "10.0.0.1"},
+		{"10.0.0.1", "2001:db8::"},
+		{"10.0.0.1", "foo"},
+	}
+	for _, tt := range tests {
+		if err := tbl.Add(net.ParseIP(tt.start), net.ParseIP(tt.end), 1); err == nil {
+			t.Errorf("Add(%s, %s) succeeded", tt.start, tt.end)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	var tests = []struct {
+		start, end, ip string
+		out            string
+	}{
+		{"0.0.0.0", "255.255.255.255", "8.8.8.8", "0.0.0.0/0"},
+		{"8.8.4.0", "8.8.8.255", "8.8.8.8", "8.8.8.0/24"},
+		{"8.8.4.0", "8.8.8.255", "8.8.5.1", "8.8.4.0/22"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "2001:db8::", "::/0"},
+	}
+	for _, tt := range tests {
+		n := Network(net.ParseIP(tt.start), net.ParseIP(tt.end), net.ParseIP(tt.ip))
+		if n == nil || n.String() != tt.out {
+			t.Errorf("Network(%s, %s, %s) = %v, want %s", tt.start, tt.end, tt.ip, n, tt.out)
+		}
+	}
+	if n := Network(net.ParseIP("10.0.0.0"), net.ParseIP("10.0.0.9"), net.ParseIP("10.0.0.10")); n != nil {
+		t.Errorf("Network outside range = %s, want nil", n)
+	}
+}
@@ -1,15 +1,23 @@
 package iputil
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 )
 
 func LookupAddr(ip net.IP) (string, error) {
-	names, err := net.LookupAddr(ip.String())
+	return LookupAddrContext(context.Background(), net.DefaultResolver, ip)
+}
+
+// LookupAddrContext is LookupAddr using resolver r.
+func LookupAddrContext(ctx context.Context, r *net.Resolver, ip net.IP) (string, error) {
+	names, err := r.LookupAddr(ctx, ip.String())
 	if err != nil || len(names) == 0 {
 		return "", err
 	}
@@ -36,3 +44,68 @@ func ToDecimal(ip net.IP) *big.Int {
 	}
 	return i
 }
+
+// ip4or16 returns the 4 byte form of IPv4 addresses and the 16 byte form of
+// IPv6 addresses.
+func ip4or16(ip net.IP) net.IP {
+	if to4 := ip.To4(); to4 != nil {
+		return to4
+	}
+	return ip.To16()
+}
+
+// ToHex returns ip as a hexadecimal number, e.g. 0x08080808.
+func ToHex(ip net.IP) string {
+	return "0x" + hex.EncodeToString(ip4or16(ip))
+}
+
+// ToOctal returns ip as an octal number with a leading zero, e.g.
+// 01002004010.
+func ToOctal(ip net.IP) string {
+	return "0" + ToDecimal(ip).Text(8)
+}
+
+// ToBinary returns the bits of ip, grouped by octet for IPv4 addresses and by
+// 16 bit group for IPv6 addresses.
+func ToBinary(ip net.IP) string {
+	b := ip4or16(ip)
+	if len(b) == net.IPv4len {
+		groups := make([]string, len(b))
+		for i, octet := range b {
+			groups[i] = fmt.Sprintf("%08b", octet)
+		}
+		return strings.Join(groups, ".")
+	}
+	groups := make([]string, len(b)/2)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("%08b%08b", b[2*i], b[2*i+1])
+	}
+	return strings.Join(groups, ":")
+}
+
+// ToDottedOctal returns the octets of an IPv4 address in octal, e.g.
+// 0010.0010.0010.0010, or an empty string for IPv6 addresses.
+func ToDottedOctal(ip net.IP) string {
+	to4 := ip.To4()
+	if to4 == nil {
+		return ""
+	}
+	return fmt.Sprintf("%04o.%04o.%04o.%04o", to4[0], to4[1], to4[2], to4[3])
+}
+
+// ReversePointer returns the name used for reverse DNS lookups of ip in the
+// in-addr.arpa or ip6.arpa domain.
+func ReversePointer(ip net.IP) string {
+	b := ip4or16(ip)
+	var labels []string
+	if len(b) == net.IPv4len {
+		for i := len(b) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(b[i])))
+		}
+		return strings.Join(labels, ".") + ".in-addr.arpa"
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		labels = append(labels, strconv.FormatUint(uint64(b[i]&0x0f), 16), strconv.FormatUint(uint64(b[i]>>4), 16))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa"
+}
@@ -25,3 +25,34 @@ func TestToDecimal(t *testing.T) {
 		}
 	}
 }
+
+func TestRepresentations(t *testing.T) {
+	var tests = []struct {
+		in                                    string
+		hex, octal, binary, dottedOctal, arpa string
+	}{
+		{"8.8.8.8", "0x08080808", "01002004010", "00001000.00001000.00001000.00001000", "0010.0010.0010.0010", "8.8.8.8.in-addr.arpa"},
+		{"192.0.2.1", "0xc0000201", "030000001001", "11000000.00000000.00000010.00000001", "0300.0000.0002.0001", "1.2.0.192.in-addr.arpa"},
+		{"2001:db8::1", "0x20010db8000000000000000000000001", "0400020667000000000000000000000000000000001",
+			"0010000000000001:0000110110111000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000001",
+			"", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa"},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.in)
+		if out := ToHex(ip); out != tt.hex {
+			t.Errorf("ToHex(%s) = %s, want %s", tt.in, out, tt.hex)
+		}
+		if out := ToOctal(ip); out != tt.octal {
+			t.Errorf("ToOctal(%s) = %s, want %s", tt.in, out, tt.octal)
+		}
+		if out := ToBinary(ip); out != tt.binary {
+			t.Errorf("ToBinary(%s) = %s, want %s", tt.in, out, tt.binary)
+		}
+		if out := ToDottedOctal(ip); out != tt.dottedOctal {
+			t.Errorf("ToDottedOctal(%s) = %s, want %s", tt.in, out, tt.dottedOctal)
+		}
+		if out := ReversePointer(ip); out != tt.arpa {
+			t.Errorf("ReversePointer(%s) = %s, want %s", tt.in, out, tt.arpa)
+		}
+	}
+}
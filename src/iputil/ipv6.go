@@ -0,0 +1,88 @@
+package iputil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+)
+
+// IPv6 transition mechanisms that embed an IPv4 address in an IPv6 address.
+const (
+	NAT64     = "nat64"
+	SixToFour = "6to4"
+	Teredo    = "teredo"
+)
+
+// IPv6Info describes what can be decoded from an IPv6 address.
+type IPv6Info struct {
+	// Transition is the mechanism embedding EmbeddedIPv4, if any
+	Transition   string
+	EmbeddedIPv4 net.IP
+	// TeredoServer and TeredoPort are the Teredo server and the external
+	// port of the client, whose external address is EmbeddedIPv4
+	TeredoServer net.IP
+	TeredoPort   uint16
+	// MAC is the hardware address an EUI-64 interface identifier was derived
+	// from, and MACVendor the organization its OUI is assigned to, if the
+	// built-in OUI table has it (see LookupOUI)
+	MAC       net.HardwareAddr
+	MACVendor string
+	// Privacy is set for addresses whose interface identifier looks random,
+	// such as temporary (RFC 8981) or stable privacy (RFC 7217) addresses
+	Privacy bool
+}
+
+var (
+	nat64Prefix     = []byte{0, 0x64, 0xff, 0x9b, 0, 0, 0, 0, 0, 0, 0, 0}
+	sixToFourPrefix = []byte{0x20, 0x02}
+	teredoPrefix    = []byte{0x20, 0x01, 0, 0}
+)
+
+// AnalyzeIPv6 decodes the IPv6 address ip. It returns false if ip is not an
+// IPv6 address. IPv4-mapped addresses are IPv4 addresses, as net.ParseIP
+// cannot tell them apart.
+func AnalyzeIPv6(ip net.IP) (IPv6Info, bool) {
+	var info IPv6Info
+	if len(ip) != net.IPv6len || ip.To4() != nil {
+		return info, false
+	}
+	switch {
+	case bytes.HasPrefix(ip, nat64Prefix):
+		info.Transition = NAT64
+		info.EmbeddedIPv4 = net.IP(ip[12:16]).To16()
+		return info, true
+	case bytes.HasPrefix(ip, teredoPrefix):
+		// The client address and port are stored inverted so that NATs do
+		// not rewrite them
+		info.Transition = Teredo
+		info.TeredoServer = net.IP(ip[4:8]).To16()
+		info.TeredoPort = ^binary.BigEndian.Uint16(ip[10:12])
+		client := make(net.IP, net.IPv4len)
+		for i := range client {
+			client[i] = ^ip[12+i]
+		}
+		info.EmbeddedIPv4 = client.To16()
+		return info, true
+	case bytes.HasPrefix(ip, sixToFourPrefix):
+		info.Transition = SixToFour
+		info.EmbeddedIPv4 = net.IP(ip[2:6]).To16()
+	}
+	iid := ip[8:16]
+	if iid[3] == 0xff && iid[4] == 0xfe {
+		// EUI-64 inserts ff:fe in the middle of the MAC and inverts its
+		// universal/local bit
+		info.MAC = net.HardwareAddr{iid[0] ^ 0x02, iid[1], iid[2], iid[5], iid[6], iid[7]}
+		info.MACVendor = LookupOUI(info.MAC)
+	} else if ip[0]&0xe0 == 0x20 {
+		// Manually configured and DHCPv6 assigned interface identifiers
+		// tend to contain zero groups, e.g. ::1 or ::2:100
+		info.Privacy = true
+		for i := 0; i < len(iid); i += 2 {
+			if iid[i] == 0 && iid[i+1] == 0 {
+				info.Privacy = false
+				break
+			}
+		}
+	}
+	return info, true
+}
@@ -0,0 +1,62 @@
+package iputil
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeIPv6(t *testing.T) {
+	mac := func(s string) net.HardwareAddr {
+		m, err := net.ParseMAC(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	var tests = []struct {
+		in  net.IP
+		out IPv6Info
+		ok  bool
+	}{
+		{net.IP{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 192, 0, 2, 1}, IPv6Info{}, false},
+		{net.ParseIP("64:ff9b::808:808"), IPv6Info{Transition: NAT64, EmbeddedIPv4: net.ParseIP("8.8.8.8")}, true},
+		{net.ParseIP("2002:c000:22d::1"), IPv6Info{Transition: SixToFour, EmbeddedIPv4: net.ParseIP("192.0.2.45")}, true},
+		{net.ParseIP("2001:0:4136:e378:8000:63bf:3fff:fdd2"), IPv6Info{Transition: Teredo, EmbeddedIPv4: net.ParseIP("192.0.2.45"),
+			TeredoServer: net.ParseIP("65.54.227.120"), TeredoPort: 40000}, true},
+		{net.ParseIP("fe80::21b:21ff:fe12:3456"), IPv6Info{MAC: mac("00:1b:21:12:34:56"), MACVendor: "Intel Corporate"}, true},
+		{net.ParseIP("2001:db8::5054:ff:fe12:3456"), IPv6Info{MAC: mac("52:54:00:12:34:56")}, true},
+		{net.ParseIP("2001:db8:1:2:a1b2:c3d4:e5f6:1789"), IPv6Info{Privacy: true}, true},
+		{net.ParseIP("2001:db8:1:2::100"), IPv6Info{}, true},
+		{net.ParseIP("fd00::a1b2:c3d4:e5f6:1789"), IPv6Info{}, true},
+		{net.IP{192, 0, 2, 1}, IPv6Info{}, false},
+	}
+	for _, tt := range tests {
+		out, ok := AnalyzeIPv6(tt.in)
+		if ok != tt.ok || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("AnalyzeIPv6(%s) = %+v, %t, want %+v, %t", tt.in, out, ok, tt.out, tt.ok)
+		}
+	}
+}
+
+func TestLookupOUI(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"00:50:56:01:02:03", "VMware, Inc."},
+		{"b8:27:eb:01:02:03", "Raspberry Pi Foundation"},
+		{"00:1d:0f:01:02:03", "TP-LINK TECHNOLOGIES CO.,LTD."},
+		{"02:50:56:01:02:03", ""},
+		{"ff:ff:ff:ff:ff:ff", ""},
+	}
+	for _, tt := range tests {
+		mac, err := net.ParseMAC(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := LookupOUI(mac); out != tt.out {
+			t.Errorf("LookupOUI(%s) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
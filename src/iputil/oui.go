@@ -0,0 +1,56 @@
+package iputil
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/csv"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ouiTable is a built-in table of the OUIs of major vendors, gzipped in the
+// format of the IEEE MA-L registry (https://standards-oui.ieee.org/oui/oui.csv).
+// It does not cover the full registry; go generate replaces it with the
+// assignments and organization names of every registry entry.
+//
+//go:generate go run oui_gen.go
+//go:embed oui.csv.gz
+var ouiTable []byte
+
+var (
+	ouiOnce    sync.Once
+	ouiVendors map[[3]byte]string
+)
+
+func loadOUIs() {
+	ouiVendors = make(map[[3]byte]string)
+	gz, err := gzip.NewReader(bytes.NewReader(ouiTable))
+	if err != nil {
+		panic(err)
+	}
+	records, err := csv.NewReader(gz).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	for _, record := range records[1:] {
+		b, err := hex.DecodeString(record[1])
+		if err != nil || len(b) != 3 {
+			continue
+		}
+		ouiVendors[[3]byte{b[0], b[1], b[2]}] = strings.TrimSpace(record[2])
+	}
+}
+
+// LookupOUI returns the organization the OUI of mac is assigned to, or an
+// empty string if it is unknown or mac is locally administered. OUIs of
+// vendors missing from the built-in table are unknown.
+func LookupOUI(mac net.HardwareAddr) string {
+	if len(mac) < 3 || mac[0]&0x02 != 0 {
+		return ""
+	}
+	ouiOnce.Do(loadOUIs)
+	return ouiVendors[[3]byte{mac[0], mac[1], mac[2]}]
+}
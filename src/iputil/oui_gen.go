@@ -0,0 +1,61 @@
+//go:build ignore
+
+// This program downloads the IEEE MA-L registry and writes the assignments
+// and organization names to oui.csv.gz, which is embedded by oui.go. Run it
+// with go generate.
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+)
+
+const registryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+func main() {
+	resp, err := http.Get(registryURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("%s: %s", registryURL, resp.Status)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(records) < 2 || len(records[0]) < 3 || records[0][1] != "Assignment" {
+		log.Fatalf("%s: unexpected format", registryURL)
+	}
+	header, records := records[0][:3], records[1:]
+	sort.Slice(records, func(i, j int) bool { return records[i][1] < records[j][1] })
+
+	f, err := os.Create("oui.csv.gz")
+	if err != nil {
+		log.Fatal(err)
+	}
+	gz, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	w := csv.NewWriter(gz)
+	w.Write(header)
+	for _, record := range records {
+		// Addresses are not needed and make up most of the registry
+		w.Write(record[:3])
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %d assignments to oui.csv.gz\n", len(records))
+}
@@ -0,0 +1,110 @@
+package iputil
+
+import (
+	"math/big"
+	"net"
+	"strings"
+)
+
+// ParseIP parses s as an IP address. In addition to the forms accepted by
+// net.ParseIP, it accepts addresses in brackets or with a zone index, which is
+// dropped, IPv4 addresses in the forms accepted by inet_aton(3), such as 8.8
+// or 0010.0010.0010.0010, and addresses written as a single decimal, octal or
+// hexadecimal number. Hexadecimal numbers of more than 8 digits are IPv6
+// addresses, as are other numbers that do not fit in 32 bits. ParseIP returns
+// nil if s is not a valid address.
+func ParseIP(s string) net.IP {
+	s = unwrapIP(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if s == "" || strings.Contains(s, ":") {
+		return nil
+	}
+	if !strings.Contains(s, ".") {
+		return parseNumber(s)
+	}
+	return parseInetAton(s)
+}
+
+// ParseIPStrict parses s as an IP address in the dotted or colon notation of
+// net.ParseIP, in brackets or with a zone index like ParseIP. Unlike ParseIP,
+// it rejects numbers and the shortened forms of inet_aton(3), so that it can
+// tell addresses from other paths such as /123.
+func ParseIPStrict(s string) net.IP {
+	return net.ParseIP(unwrapIP(s))
+}
+
+// unwrapIP removes surrounding space and brackets and the zone index of s.
+func unwrapIP(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	if i := strings.IndexByte(s, '%'); i > 0 && strings.Contains(s, ":") {
+		s = s[:i]
+	}
+	return s
+}
+
+// parseUint parses a number in C notation: hexadecimal with a 0x prefix,
+// octal with a leading zero or decimal. It also returns the number of digits.
+func parseUint(s string) (*big.Int, int, bool) {
+	base := 10
+	switch {
+	case len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		s, base = s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+	for _, c := range s {
+		// SetString would accept signs
+		if c == '+' || c == '-' {
+			return nil, 0, false
+		}
+	}
+	n, ok := new(big.Int).SetString(s, base)
+	if base == 16 {
+		return n, len(s), ok
+	}
+	return n, 0, ok
+}
+
+func parseNumber(s string) net.IP {
+	n, hexDigits, ok := parseUint(s)
+	if !ok {
+		return nil
+	}
+	switch {
+	case n.BitLen() <= 32 && hexDigits <= 2*net.IPv4len:
+		return net.IP(n.FillBytes(make([]byte, net.IPv4len))).To16()
+	case n.BitLen() <= 128:
+		return net.IP(n.FillBytes(make([]byte, net.IPv6len)))
+	}
+	return nil
+}
+
+// parseInetAton parses an IPv4 address of up to four dotted numbers, where
+// the last number fills the remaining bytes, e.g. 127.1 is 127.0.0.1.
+func parseInetAton(s string) net.IP {
+	parts := strings.Split(s, ".")
+	if len(parts) > net.IPv4len {
+		return nil
+	}
+	ip := make(net.IP, net.IPv4len)
+	for i, part := range parts {
+		n, _, ok := parseUint(part)
+		if !ok {
+			return nil
+		}
+		size := 1
+		if i == len(parts)-1 {
+			size = net.IPv4len - i
+		}
+		if n.BitLen() > 8*size {
+			return nil
+		}
+		n.FillBytes(ip[i : i+size])
+	}
+	return ip.To16()
+}
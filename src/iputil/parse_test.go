@@ -0,0 +1,82 @@
+package iputil
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"8.8.8.8", "8.8.8.8"},
+		{" 2001:db8::1 ", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[fe80::1%25]", "fe80::1"},
+		{"134744072", "8.8.8.8"},
+		{"0x08080808", "8.8.8.8"},
+		{"0X8080808", "8.8.8.8"},
+		{"01002004010", "8.8.8.8"},
+		{"0x20010db8000000000000000000000001", "2001:db8::1"},
+		{"0x00000000000000000000000000000001", "::1"},
+		{"4294967296", "::1:0:0"},
+		{"8.8", "8.0.0.8"},
+		{"127.1", "127.0.0.1"},
+		{"10.1.258", "10.1.1.2"},
+		{"0010.0010.0010.0010", "8.8.8.8"},
+		{"0x7f.0.0.1", "127.0.0.1"},
+		{"", "<nil>"},
+		{"foo", "<nil>"},
+		{"-1", "<nil>"},
+		{"1_000", "<nil>"},
+		{"08.8.8.8", "<nil>"},
+		{"256.1.1.1", "<nil>"},
+		{"1.2.3.4.5", "<nil>"},
+		{"1..2", "<nil>"},
+		{"8.8.", "<nil>"},
+		{"%eth0", "<nil>"},
+		{"0x1000000000000000000000000000000000", "<nil>"},
+	}
+	for _, tt := range tests {
+		if out := ParseIP(tt.in).String(); out != tt.out {
+			t.Errorf("ParseIP(%q) = %s, want %s", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestParseIPStrict(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"8.8.8.8", "8.8.8.8"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"0", "<nil>"},
+		{"134744072", "<nil>"},
+		{"0x08080808", "<nil>"},
+		{"10.1", "<nil>"},
+		{"0010.0010.0010.0010", "<nil>"},
+	}
+	for _, tt := range tests {
+		if out := ParseIPStrict(tt.in).String(); out != tt.out {
+			t.Errorf("ParseIPStrict(%q) = %s, want %s", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestParseIPRoundTrip(t *testing.T) {
+	for _, s := range []string{"8.8.8.8", "2001:db8::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"} {
+		ip := net.ParseIP(s)
+		for _, form := range []string{ToHex(ip), ToOctal(ip), ToDecimal(ip).String(), ToDottedOctal(ip)} {
+			if form == "" {
+				continue
+			}
+			if out := ParseIP(form); !out.Equal(ip) {
+				t.Errorf("ParseIP(%q) = %s, want %s", form, out, ip)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package subnet calculates the properties of IP networks and splits, widens
+// and aggregates them.
+package subnet
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a network in CIDR notation. Host bits are cleared, the prefix
+// length may be written as an IPv4 netmask, e.g. 10.0.0.0/255.255.255.0, and
+// an address without a prefix length is a network of that address alone.
+func Parse(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	addr, prefix, hasPrefix := strings.Cut(s, "/")
+	ip := net.ParseIP(strings.Trim(addr, "[]"))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid network: %s", s)
+	}
+	size := bitLen(ip)
+	ones := size
+	if hasPrefix {
+		if mask := net.ParseIP(prefix).To4(); mask != nil && size == 32 {
+			var bits int
+			if ones, bits = net.IPMask(mask).Size(); bits == 0 {
+				return nil, fmt.Errorf("invalid netmask: %s", prefix)
+			}
+		} else {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n < 0 || n > size {
+				return nil, fmt.Errorf("invalid prefix length: %s", prefix)
+			}
+			ones = n
+		}
+	}
+	return network(ip, ones), nil
+}
+
+// bitLen returns the number of bits of addresses of the same family as ip.
+func bitLen(ip net.IP) int {
+	if ip.To4() != nil {
+		return 8 * net.IPv4len
+	}
+	return 8 * net.IPv6len
+}
+
+func network(ip net.IP, ones int) *net.IPNet {
+	size := bitLen(ip)
+	if size == 32 {
+		ip = ip.To4()
+	}
+	mask := net.CIDRMask(ones, size)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+func toInt(ip net.IP) *big.Int {
+	if to4 := ip.To4(); to4 != nil {
+		return new(big.Int).SetBytes(to4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func fromInt(i *big.Int, size int) net.IP {
+	return net.IP(i.FillBytes(make([]byte, size/8)))
+}
+
+// Size returns the number of addresses in n.
+func Size(n *net.IPNet) *big.Int {
+	ones, size := n.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(size-ones))
+}
+
+// Last returns the last address in n, which is the broadcast address of IPv4
+// networks.
+func Last(n *net.IPNet) net.IP {
+	first := n.IP.Mask(n.Mask)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^n.Mask[i]
+	}
+	return last
+}
+
+// Info holds the properties of a network.
+type Info struct {
+	Network *net.IPNet
+	// Broadcast is nil for IPv6 networks and IPv4 networks without a
+	// broadcast address (/31 and /32)
+	Broadcast net.IP
+	Netmask   net.IP
+	Wildcard  net.IP
+	// FirstHost and LastHost delimit the addresses that can be assigned to
+	// hosts: all but the network and broadcast address of IPv4 networks up to
+	// a /30, and every address otherwise
+	FirstHost net.IP
+	LastHost  net.IP
+	Addresses *big.Int
+	Hosts     *big.Int
+}
+
+// Describe returns the properties of n.
+func Describe(n *net.IPNet) Info {
+	ones, size := n.Mask.Size()
+	info := Info{
+		Network:   n,
+		Netmask:   net.IP(n.Mask),
+		Wildcard:  make(net.IP, len(n.Mask)),
+		FirstHost: n.IP.Mask(n.Mask),
+		LastHost:  Last(n),
+		Addresses: Size(n),
+	}
+	for i, b := range n.Mask {
+		info.Wildcard[i] = ^b
+	}
+	info.Hosts = new(big.Int).Set(info.Addresses)
+	if size == 32 && ones <= 30 {
+		info.Broadcast = info.LastHost
+		info.FirstHost = fromInt(new(big.Int).Add(toInt(info.FirstHost), big.NewInt(1)), size)
+		info.LastHost = fromInt(new(big.Int).Sub(toInt(info.LastHost), big.NewInt(1)), size)
+		info.Hosts.Sub(info.Hosts, big.NewInt(2))
+	}
+	return info
+}
+
+// Contains reports whether n contains ip. IPv4 networks do not contain IPv6
+// addresses, and vice versa.
+func Contains(n *net.IPNet, ip net.IP) bool {
+	return bitLen(n.IP) == bitLen(ip) && n.Contains(ip)
+}
+
+// Split divides n into count networks of equal size. count must be a power of
+// two.
+func Split(n *net.IPNet, count int) ([]*net.IPNet, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid number of networks: %d", count)
+	}
+	if count&(count-1) != 0 {
+		return nil, fmt.Errorf("number of networks must be a power of two: %d", count)
+	}
+	ones, size := n.Mask.Size()
+	extra := 0
+	for 1<<extra < count {
+		extra++
+	}
+	if ones+extra > size {
+		return nil, fmt.Errorf("cannot split %s into %d networks", n, count)
+	}
+	step := new(big.Int).Lsh(big.NewInt(1), uint(size-ones-extra))
+	start := toInt(n.IP)
+	networks := make([]*net.IPNet, 1<<extra)
+	for i := range networks {
+		networks[i] = network(fromInt(start, size), ones+extra)
+		start.Add(start, step)
+	}
+	return networks, nil
+}
+
+// Supernet returns the network with the given prefix length that contains n.
+func Supernet(n *net.IPNet, length int) (*net.IPNet, error) {
+	if ones, _ := n.Mask.Size(); length < 0 || length >= ones {
+		return nil, fmt.Errorf("invalid prefix length for supernet of %s: %d", n, length)
+	}
+	return network(n.IP, length), nil
+}
+
+type span struct {
+	size       int
+	start, end *big.Int
+}
+
+// Aggregate returns the smallest list of networks covering exactly the
+// addresses of networks, merging overlapping and adjacent ones. IPv4 networks
+// come before IPv6 networks.
+func Aggregate(networks []*net.IPNet) []*net.IPNet {
+	spans := make([]span, len(networks))
+	for i, n := range networks {
+		_, size := n.Mask.Size()
+		spans[i] = span{size, toInt(n.IP.Mask(n.Mask)), toInt(Last(n))}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].size != spans[j].size {
+			return spans[i].size < spans[j].size
+		}
+		return spans[i].start.Cmp(spans[j].start) < 0
+	})
+	var merged []span
+	for _, s := range spans {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			next := new(big.Int).Add(last.end, big.NewInt(1))
+			if last.size == s.size && s.start.Cmp(next) <= 0 {
+				if s.end.Cmp(last.end) > 0 {
+					last.end = s.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, s)
+	}
+	var result []*net.IPNet
+	for _, s := range merged {
+		result = append(result, spanNetworks(s)...)
+	}
+	return result
+}
+
+// spanNetworks returns the largest networks that cover s, in order.
+func spanNetworks(s span) []*net.IPNet {
+	var networks []*net.IPNet
+	start := new(big.Int).Set(s.start)
+	for start.Cmp(s.end) <= 0 {
+		// The network is limited by the alignment of its start and by the
+		// addresses remaining in the span
+		hostBits := s.size
+		if start.Sign() != 0 {
+			hostBits = int(start.TrailingZeroBits())
+		}
+		remaining := new(big.Int).Sub(s.end, start)
+		remaining.Add(remaining, big.NewInt(1))
+		if limit := remaining.BitLen() - 1; hostBits > limit {
+			hostBits = limit
+		}
+		networks = append(networks, network(fromInt(start, s.size), s.size-hostBits))
+		start.Add(start, new(big.Int).Lsh(big.NewInt(1), uint(hostBits)))
+	}
+	return networks
+}
@@ -0,0 +1,145 @@
+package subnet
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+		err bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/24", "10.1.2.0/24", false},
+		{"10.1.2.3/255.255.0.0", "10.1.0.0/16", false},
+		{"192.0.2.1", "192.0.2.1/32", false},
+		{"2001:db8::1/48", "2001:db8::/48", false},
+		{"[2001:db8::]/32", "2001:db8::/32", false},
+		{"10.0.0.0/33", "", true},
+		{"10.0.0.0/255.0.255.0", "", true},
+		{"2001:db8::/255.255.0.0", "", true},
+		{"foo/8", "", true},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("Parse(%q) error = %v, want error %t", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && n.String() != tt.out {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, n, tt.out)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	var tests = []struct {
+		in                                                string
+		broadcast, netmask, wildcard, firstHost, lastHost string
+		addresses, hosts                                  string
+	}{
+		{"192.168.1.0/24", "192.168.1.255", "255.255.255.0", "0.0.0.255", "192.168.1.1", "192.168.1.254", "256", "254"},
+		{"10.0.0.0/31", "<nil>", "255.255.255.254", "0.0.0.1", "10.0.0.0", "10.0.0.1", "2", "2"},
+		{"10.0.0.1/32", "<nil>", "255.255.255.255", "0.0.0.0", "10.0.0.1", "10.0.0.1", "1", "1"},
+		{"2001:db8::/64", "<nil>", "ffff:ffff:ffff:ffff::", "::ffff:ffff:ffff:ffff", "2001:db8::", "2001:db8::ffff:ffff:ffff:ffff", "18446744073709551616", "18446744073709551616"},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := Describe(n)
+		out := []string{info.Broadcast.String(), info.Netmask.String(), info.Wildcard.String(), info.FirstHost.String(),
+			info.LastHost.String(), info.Addresses.String(), info.Hosts.String()}
+		want := []string{tt.broadcast, tt.netmask, tt.wildcard, tt.firstHost, tt.lastHost, tt.addresses, tt.hosts}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("Describe(%s) = %v, want %v", tt.in, out, want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	n, _ := Parse("10.0.0.0/8")
+	for ip, want := range map[string]bool{"10.1.2.3": true, "11.0.0.1": false, "::ffff:10.0.0.1": true, "::a00:1": false} {
+		if got := Contains(n, net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s, %s) = %t, want %t", n, ip, got, want)
+		}
+	}
+}
+
+func networkStrings(networks []*net.IPNet) []string {
+	var s []string
+	for _, n := range networks {
+		s = append(s, n.String())
+	}
+	return s
+}
+
+func TestSplit(t *testing.T) {
+	var tests = []struct {
+		in    string
+		count int
+		out   []string
+	}{
+		{"10.0.0.0/24", 4, []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/26"}},
+		{"10.0.0.0/24", 3, nil},
+		{"10.0.0.0/24", 1, []string{"10.0.0.0/24"}},
+		{"2001:db8::/32", 2, []string{"2001:db8::/33", "2001:db8:8000::/33"}},
+		{"10.0.0.0/31", 4, nil},
+		{"10.0.0.0/24", 0, nil},
+	}
+	for _, tt := range tests {
+		n, _ := Parse(tt.in)
+		out, err := Split(n, tt.count)
+		if (err != nil) != (tt.out == nil) {
+			t.Errorf("Split(%s, %d) error = %v", tt.in, tt.count, err)
+			continue
+		}
+		if s := networkStrings(out); !reflect.DeepEqual(s, tt.out) {
+			t.Errorf("Split(%s, %d) = %v, want %v", tt.in, tt.count, s, tt.out)
+		}
+	}
+}
+
+func TestSupernet(t *testing.T) {
+	n, _ := Parse("10.1.2.0/24")
+	if s, err := Supernet(n, 16); err != nil || s.String() != "10.1.0.0/16" {
+		t.Errorf("Supernet(%s, 16) = %v, %v, want 10.1.0.0/16", n, s, err)
+	}
+	for _, length := range []int{-1, 24, 25} {
+		if _, err := Supernet(n, length); err == nil {
+			t.Errorf("Supernet(%s, %d) succeeded", n, length)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	var tests = []struct {
+		in  []string
+		out []string
+	}{
+		{[]string{"10.0.0.0/25", "10.0.0.128/25"}, []string{"10.0.0.0/24"}},
+		{[]string{"10.0.1.0/24", "10.0.0.0/24", "10.0.0.64/26"}, []string{"10.0.0.0/23"}},
+		{[]string{"10.0.0.0/24", "10.0.1.0/25"}, []string{"10.0.0.0/24", "10.0.1.0/25"}},
+		{[]string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30"}, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30"}},
+		{[]string{"10.0.0.0/30", "10.0.0.4/31", "10.0.0.6/32"}, []string{"10.0.0.0/30", "10.0.0.4/31", "10.0.0.6/32"}},
+		{[]string{"2001:db8:1::/48", "10.0.0.0/8", "2001:db8::/48"}, []string{"10.0.0.0/8", "2001:db8::/47"}},
+		{[]string{"0.0.0.0/1", "128.0.0.0/1"}, []string{"0.0.0.0/0"}},
+	}
+	for _, tt := range tests {
+		var networks []*net.IPNet
+		for _, s := range tt.in {
+			n, err := Parse(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			networks = append(networks, n)
+		}
+		if out := networkStrings(Aggregate(networks)); !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("Aggregate(%v) = %v, want %v", tt.in, out, tt.out)
+		}
+	}
+}
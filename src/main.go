@@ -5,11 +5,22 @@
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	// Local times need the time zone database, which minimal images lack
+	_ "time/tzdata"
 
+	"github.com/apimgr/echoip/src/bot"
+	"github.com/apimgr/echoip/src/cloud"
 	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iplist"
 	"github.com/apimgr/echoip/src/iputil"
+	"github.com/apimgr/echoip/src/iputil/geo"
+	"github.com/apimgr/echoip/src/overrides"
 	"github.com/apimgr/echoip/src/paths"
+	"github.com/apimgr/echoip/src/rir"
 	"github.com/apimgr/echoip/src/scheduler"
 	"github.com/apimgr/echoip/src/server"
 )
@@ -32,6 +43,253 @@ func (f *multiValueFlag) Set(v string) error {
 	return nil
 }
 
+// splitNameValue splits a name=value flag argument.
+func splitNameValue(v string) (string, string, error) {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" || value == "" {
+		return "", "", fmt.Errorf("invalid value %q: expected name=value", v)
+	}
+	return name, value, nil
+}
+
+// configureGeoIPSources applies the -geoip-url and -geoip-checksum flags.
+func configureGeoIPSources(m *geoip.Manager, urls, checksums multiValueFlag) error {
+	sources := make(map[string]*geoip.Source)
+	var names []string
+	source := func(name string) *geoip.Source {
+		src, ok := sources[name]
+		if !ok {
+			src = &geoip.Source{}
+			sources[name] = src
+			names = append(names, name)
+		}
+		return src
+	}
+	for _, v := range urls {
+		name, u, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		src := source(name)
+		src.URLs = append(src.URLs, u)
+	}
+	for _, v := range checksums {
+		name, u, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		source(name).ChecksumURL = u
+	}
+	for _, name := range names {
+		src := sources[name]
+		if len(src.URLs) == 0 {
+			return fmt.Errorf("checksum configured for %s without -geoip-url", name)
+		}
+		if err := m.SetSource(name, *src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureMaxMind applies the -maxmind-edition flags.
+func configureMaxMind(m *geoip.Manager, mm geoip.MaxMind, editions multiValueFlag) error {
+	for _, v := range editions {
+		role, edition, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		if err := m.UseMaxMind(mm, role, edition); err != nil {
+			return err
+		}
+		log.Printf("Downloading %s database from MaxMind edition %s", role, edition)
+	}
+	return nil
+}
+
+// configureIPLists adds the defaults and the lists given as name=url for each
+// kind. A name that is given again adds a mirror, and giving the name of a
+// default list replaces its URL. Scores given as name=score replace those of
+// the lists; blocklists default to iplist.DefaultBlocklistScore.
+func configureIPLists(m *iplist.Manager, defaults []iplist.List, flags map[iplist.Kind]multiValueFlag, scores multiValueFlag) error {
+	lists := defaults
+	index := func(name string) int {
+		for i, l := range lists {
+			if l.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	configured := make(map[string]bool)
+	for _, kind := range iplist.Kinds() {
+		for _, v := range flags[kind] {
+			name, u, err := splitNameValue(v)
+			if err != nil {
+				return err
+			}
+			i := index(name)
+			if i < 0 {
+				l := iplist.List{Name: name, Kind: kind}
+				if kind == iplist.Blocklist {
+					l.Score = iplist.DefaultBlocklistScore
+				}
+				lists = append(lists, l)
+				i = len(lists) - 1
+			} else if lists[i].Kind != kind {
+				return fmt.Errorf("list %s configured as %s and %s", name, lists[i].Kind, kind)
+			}
+			if !configured[name] {
+				lists[i].Source = geoip.Source{}
+				configured[name] = true
+			}
+			lists[i].Source.URLs = append(lists[i].Source.URLs, u)
+		}
+	}
+	for _, v := range scores {
+		name, value, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		i := index(name)
+		if i < 0 {
+			return fmt.Errorf("score configured for unknown list %s", name)
+		}
+		score, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid score of list %s: %s", name, value)
+		}
+		lists[i].Score = score
+	}
+	for _, l := range lists {
+		if err := m.Add(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureCloud adds the default feeds and the feeds given as provider=url or
+// provider=path, the latter being read from disk instead of downloaded. The
+// feeds given for a provider replace its default feeds.
+func configureCloud(m *cloud.Manager, defaults []cloud.Feed, feeds multiValueFlag) error {
+	configured := make(map[string]bool)
+	var added []cloud.Feed
+	for _, v := range feeds {
+		provider, location, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		f := cloud.Feed{Provider: provider}
+		if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+			f.Source.URLs = []string{location}
+		} else {
+			f.File = location
+		}
+		configured[provider] = true
+		added = append(added, f)
+	}
+	for _, f := range defaults {
+		if configured[f.Provider] {
+			continue
+		}
+		if err := m.Add(f); err != nil {
+			return err
+		}
+	}
+	for _, f := range added {
+		if err := m.Add(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureRIR adds the default registries and the statistics files given as
+// name=url or name=path, the latter being read from disk instead of
+// downloaded. A name that is given again adds a mirror, and giving the name of
+// a default registry replaces its URL.
+func configureRIR(m *rir.Manager, defaults []rir.Registry, sources multiValueFlag) error {
+	registries := defaults
+	configured := make(map[string]bool)
+	for _, v := range sources {
+		name, location, err := splitNameValue(v)
+		if err != nil {
+			return err
+		}
+		i := -1
+		for j, reg := range registries {
+			if reg.Name == name {
+				i = j
+			}
+		}
+		if i < 0 {
+			registries = append(registries, rir.Registry{Name: name})
+			i = len(registries) - 1
+		}
+		reg := &registries[i]
+		if !configured[name] {
+			reg.Source, reg.File = geoip.Source{}, ""
+			configured[name] = true
+		}
+		if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+			reg.Source.URLs = append(reg.Source.URLs, location)
+		} else if reg.File == "" {
+			reg.File = location
+		} else {
+			return fmt.Errorf("several files configured for registry %s", name)
+		}
+	}
+	for _, reg := range registries {
+		if err := m.Add(reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overridesInterval is how often the overrides file is checked for changes.
+const overridesInterval = 10 * time.Second
+
+// geoIPSource is the -geo value that refers to the downloaded GeoIP databases.
+const geoIPSource = "geoip"
+
+// openGeoSources opens the geo databases given by specs, each of which is
+// either provider=path or geoIPSource for managed. Databases already in opened
+// are reused, so that a database listed for several lookups is opened once.
+func openGeoSources(opened map[string]geo.Source, managed geo.Reader, specs ...multiValueFlag) ([]geo.Source, error) {
+	var sources []geo.Source
+	seen := make(map[string]bool)
+	for _, list := range specs {
+		for _, spec := range list {
+			if seen[spec] {
+				continue
+			}
+			seen[spec] = true
+			s, ok := opened[spec]
+			if !ok {
+				if spec == geoIPSource {
+					s = geo.Source{Name: geoIPSource, Reader: managed}
+				} else {
+					provider, path, err := splitNameValue(spec)
+					if err != nil {
+						return nil, err
+					}
+					r, err := geo.OpenProvider(provider, path)
+					if err != nil {
+						return nil, err
+					}
+					log.Printf("Using %s geo database %s", provider, path)
+					s = geo.Source{Name: filepath.Base(path), Reader: r}
+				}
+				opened[spec] = s
+			}
+			sources = append(sources, s)
+		}
+	}
+	return sources, nil
+}
+
 func init() {
 	log.SetPrefix("echoip: ")
 	log.SetFlags(log.Lshortfile)
@@ -45,13 +303,53 @@ func main() {
 	portLookup := flag.Bool("p", false, "Enable port lookup")
 	template := flag.String("t", "src/server/templates", "Path to template dir")
 	cacheSize := flag.Int("C", 0, "Size of response cache. Set to 0 to disable")
+	batchLimit := flag.Int("b", server.DefaultBatchLimit, "Maximum number of IPs per batch lookup")
 	profile := flag.Bool("P", false, "Enables profiling handlers")
 	sponsor := flag.Bool("s", false, "Show sponsor logo")
 	showVersion := flag.Bool("version", false, "Show version information")
 	showStatus := flag.Bool("status", false, "Check server status (for health checks)")
 
+	downloadProxy := flag.String("download-proxy", "", "HTTP proxy URL for downloads (default: proxy environment variables)")
+	downloadCA := flag.String("download-ca", "", "PEM file with additional CA certificates for downloads")
+	downloadTimeout := flag.Duration("download-timeout", 10*time.Minute, "Timeout for a single download")
+	maxmindAccount := flag.String("maxmind-account", "", "MaxMind account ID (default $MAXMIND_ACCOUNT_ID)")
+	maxmindLicenseKey := flag.String("maxmind-license-key", "", "MaxMind license key (default $MAXMIND_LICENSE_KEY)")
+	maxmindURL := flag.String("maxmind-url", geoip.DefaultMaxMindURL, "Base URL of the MaxMind download service")
+	lookupBogons := flag.Bool("lookup-bogons", false, "Look up addresses that are not globally reachable in the geo databases")
+	overridesFile := flag.String("overrides", "", "YAML, JSON or CSV file with geo data and tags for networks, taking precedence over the geo databases")
+	defaultIPLists := flag.Bool("ip-lists", false, "Download the default Tor exit, VPN and hosting lists and report the addresses on them")
+	defaultBlocklists := flag.Bool("blocklists", false, "Download the Spamhaus DROP blocklists and report the addresses on them")
+	ipListInterval := flag.Duration("ip-list-interval", time.Hour, "How often to refresh the Tor exit, VPN, hosting and blocklists")
+	defaultCloudFeeds := flag.Bool("cloud-ranges", false, "Download the AWS, Google Cloud, Oracle Cloud and Cloudflare IP ranges and report the cloud provider of addresses")
+	cloudInterval := flag.Duration("cloud-interval", 24*time.Hour, "How often to refresh the cloud provider IP ranges")
+	verifyBots := flag.Bool("verify-bots", false, "Verify search engine and crawler addresses with their published IP ranges and reverse DNS")
+	botInterval := flag.Duration("bot-interval", 24*time.Hour, "How often to refresh the published crawler IP ranges")
+	rirStats := flag.Bool("rir-stats", false, "Download the delegation statistics of ARIN, RIPE NCC, APNIC, LACNIC and AFRINIC and report the registry and allocation of addresses")
+	rirInterval := flag.Duration("rir-interval", 24*time.Hour, "How often to refresh the RIR delegation statistics")
+
 	var headers multiValueFlag
 	flag.Var(&headers, "H", "Header to trust for remote IP, if present (e.g. X-Real-IP)")
+	var geoipURLs, geoipChecksums multiValueFlag
+	flag.Var(&geoipURLs, "geoip-url", "Download URL for a GeoIP database as name=url, repeat for mirrors (e.g. asn=https://mirror/asn.mmdb)")
+	flag.Var(&geoipChecksums, "geoip-checksum", "SHA-256 checksum URL for a GeoIP database as name=url")
+	var geoDBs, geoCountryDBs, geoCityDBs, geoASNDBs multiValueFlag
+	flag.Var(&geoDBs, "geo", "Geo database as provider=path, or "+geoIPSource+" for the downloaded GeoIP databases. Repeat to fill missing fields from later databases (providers: "+strings.Join(geo.Providers(), ", ")+")")
+	flag.Var(&geoCountryDBs, "geo-country", "Geo database to consult before the -geo databases for country lookups")
+	flag.Var(&geoCityDBs, "geo-city", "Geo database to consult before the -geo databases for city lookups")
+	flag.Var(&geoASNDBs, "geo-asn", "Geo database to consult before the -geo databases for ASN lookups")
+	var maxmindEditions multiValueFlag
+	flag.Var(&maxmindEditions, "maxmind-edition", "MaxMind edition to download for a database role as role=edition, where role is city, country or asn (e.g. city=GeoIP2-City)")
+	var torLists, vpnLists, hostingLists multiValueFlag
+	flag.Var(&torLists, "tor-list", "Tor exit list to download as name=url, repeat for mirrors")
+	flag.Var(&vpnLists, "vpn-list", "VPN list to download as name=url, repeat for mirrors")
+	flag.Var(&hostingLists, "hosting-list", "Hosting provider list to download as name=url, repeat for mirrors")
+	var blocklists, ipListScores multiValueFlag
+	flag.Var(&blocklists, "blocklist", "Blocklist to download as name=url, repeat for mirrors (e.g. firehol-level1=https://iplists.firehol.org/files/firehol_level1.netset)")
+	flag.Var(&ipListScores, "ip-list-score", "Reputation score from 0 to 100 of addresses on a list as name=score (default 100 for blocklists, 0 otherwise)")
+	var cloudFeeds multiValueFlag
+	flag.Var(&cloudFeeds, "cloud-feed", "Cloud provider IP range feed as provider=url or provider=path, repeat for more feeds (providers with known formats: aws, gcp, azure, oracle; others are CIDR lists)")
+	var rirSources multiValueFlag
+	flag.Var(&rirSources, "rir-source", "RIR delegated-extended statistics file as name=url or name=path, repeat URLs for mirrors (e.g. ripencc=/srv/delegated-ripencc-extended-latest)")
 	flag.Parse()
 
 	// Handle --version
@@ -86,33 +384,171 @@ func main() {
 	log.Printf("🚀 echoip %s (commit: %s, built: %s)", Version, Commit, BuildDate)
 	log.Println("🌐 IPv6 support enabled - server will accept both IPv4 and IPv6 connections")
 
-	// Initialize GeoIP manager
-	geoMgr := geoip.NewManager(*dataDir)
-	if err := geoMgr.Initialize(); err != nil {
-		log.Printf("⚠️  Failed to initialize GeoIP: %v", err)
-		log.Println("⚠️  Server will continue without GeoIP support")
-	} else {
-		log.Println("✅ GeoIP databases loaded (4 files, ~103MB)")
+	var r geo.Reader
+	cache := server.NewCache(*cacheSize)
+	// The downloaded GeoIP databases are used unless other geo databases are
+	// configured without listing them
+	var geoSpecs []string
+	for _, specs := range []multiValueFlag{geoDBs, geoCountryDBs, geoCityDBs, geoASNDBs} {
+		geoSpecs = append(geoSpecs, specs...)
 	}
-
-	// Initialize scheduler for GeoIP updates
-	sched := scheduler.New()
-	sched.AddTask("geoip-update", "0 3 * * 0", func() error {
-		log.Println("📅 Running scheduled GeoIP database update...")
-		return geoMgr.Update()
+	useGeoIP := len(geoSpecs) == 0
+	for _, spec := range geoSpecs {
+		if spec == geoIPSource {
+			useGeoIP = true
+		}
+	}
+	downloader, err := geoip.NewDownloader(geoip.DownloadOptions{
+		Timeout: *downloadTimeout,
+		Proxy:   *downloadProxy,
+		CAFile:  *downloadCA,
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	sched := scheduler.New()
 	sched.Start()
 	defer sched.Stop()
+	if useGeoIP {
+		// Initialize GeoIP manager
+		geoMgr := geoip.NewManager(*dataDir)
+		geoMgr.SetDownloader(downloader)
+		if *maxmindAccount == "" {
+			*maxmindAccount = os.Getenv("MAXMIND_ACCOUNT_ID")
+		}
+		if *maxmindLicenseKey == "" {
+			*maxmindLicenseKey = os.Getenv("MAXMIND_LICENSE_KEY")
+		}
+		mm := geoip.MaxMind{AccountID: *maxmindAccount, LicenseKey: *maxmindLicenseKey, BaseURL: *maxmindURL}
+		if err := configureMaxMind(geoMgr, mm, maxmindEditions); err != nil {
+			log.Fatal(err)
+		}
+		if err := configureGeoIPSources(geoMgr, geoipURLs, geoipChecksums); err != nil {
+			log.Fatal(err)
+		}
+		if err := geoMgr.Initialize(); err != nil {
+			log.Printf("⚠️  Failed to initialize GeoIP: %v", err)
+			log.Println("⚠️  Server will continue without GeoIP support")
+		} else {
+			log.Println("✅ GeoIP databases loaded")
+		}
+
+		// Schedule GeoIP updates
+		sched.AddTask("geoip-update", "0 3 * * 0", func() error {
+			log.Println("📅 Running scheduled GeoIP database update...")
+			return geoMgr.Update()
+		})
+
+		r = geoMgr.Reader()
+		geoMgr.OnUpdate(cache.Clear)
+	}
+	if len(geoSpecs) > 0 {
+		opened := make(map[string]geo.Source)
+		countries, err := openGeoSources(opened, r, geoCountryDBs, geoDBs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cities, err := openGeoSources(opened, r, geoCityDBs, geoDBs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		asns, err := openGeoSources(opened, r, geoASNDBs, geoDBs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r = geo.Merge(countries, cities, asns)
+	}
 
-	r := geoMgr.Reader()
-	cache := server.NewCache(*cacheSize)
 	srv := server.New(r, cache, *profile)
 	srv.IPHeaders = headers
+	srv.BatchLimit = *batchLimit
 	if _, err := os.Stat(*template); err == nil {
 		srv.Template = *template
 	} else {
 		log.Printf("Not configuring default handler: Template not found: %s", *template)
 	}
+	if *overridesFile != "" {
+		ov, err := overrides.Load(*overridesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Using overrides from %s", *overridesFile)
+		ov.OnUpdate(cache.Clear)
+		stop := ov.Watch(overridesInterval)
+		defer stop()
+		srv.LookupOverride = ov.Lookup
+	}
+	listMgr := iplist.NewManager(*dataDir, downloader)
+	var defaultLists []iplist.List
+	if *defaultIPLists {
+		defaultLists = append(defaultLists, iplist.DefaultLists()...)
+	}
+	if *defaultBlocklists {
+		defaultLists = append(defaultLists, iplist.DefaultBlocklists()...)
+	}
+	ipLists := map[iplist.Kind]multiValueFlag{iplist.Tor: torLists, iplist.VPN: vpnLists, iplist.Hosting: hostingLists, iplist.Blocklist: blocklists}
+	if err := configureIPLists(listMgr, defaultLists, ipLists, ipListScores); err != nil {
+		log.Fatal(err)
+	}
+	if len(listMgr.Lists()) > 0 {
+		if err := listMgr.Initialize(); err != nil {
+			log.Printf("⚠️  Failed to load IP lists: %v", err)
+		}
+		listMgr.OnUpdate(cache.Clear)
+		sched.AddTask("ip-lists-update", fmt.Sprintf("@every %s", *ipListInterval), listMgr.Update)
+		srv.LookupLists = listMgr.Lookup
+	}
+	cloudMgr := cloud.NewManager(*dataDir, downloader)
+	var defaultFeeds []cloud.Feed
+	if *defaultCloudFeeds {
+		defaultFeeds = cloud.DefaultFeeds()
+	}
+	if err := configureCloud(cloudMgr, defaultFeeds, cloudFeeds); err != nil {
+		log.Fatal(err)
+	}
+	if len(cloudMgr.Feeds()) > 0 {
+		if err := cloudMgr.Initialize(); err != nil {
+			log.Printf("⚠️  Failed to load cloud IP ranges: %v", err)
+		}
+		cloudMgr.OnUpdate(cache.Clear)
+		sched.AddTask("cloud-ranges-update", fmt.Sprintf("@every %s", *cloudInterval), cloudMgr.Update)
+		srv.LookupCloud = cloudMgr.Lookup
+	}
+	if *lookupBogons {
+		log.Println("Enabling geo lookups for bogon addresses")
+		srv.LookupBogons = true
+	}
+	rirMgr := rir.NewManager(*dataDir, downloader)
+	var defaultRegistries []rir.Registry
+	if *rirStats {
+		defaultRegistries = rir.DefaultRegistries()
+	}
+	if err := configureRIR(rirMgr, defaultRegistries, rirSources); err != nil {
+		log.Fatal(err)
+	}
+	if len(rirMgr.Registries()) > 0 {
+		if err := rirMgr.Initialize(); err != nil {
+			log.Printf("⚠️  Failed to load RIR delegations: %v", err)
+		}
+		rirMgr.OnUpdate(cache.Clear)
+		sched.AddTask("rir-update", fmt.Sprintf("@every %s", *rirInterval), rirMgr.Update)
+		srv.LookupRIR = rirMgr.Lookup
+	}
+	if *verifyBots {
+		log.Println("Enabling bot verification")
+		verifier := bot.NewVerifier(*dataDir, downloader, nil)
+		for _, b := range bot.DefaultBots() {
+			if err := verifier.Add(b); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := verifier.Initialize(); err != nil {
+			log.Printf("⚠️  Failed to load crawler IP ranges: %v", err)
+		}
+		verifier.OnUpdate(cache.Clear)
+		sched.AddTask("bot-ranges-update", fmt.Sprintf("@every %s", *botInterval), verifier.Update)
+		srv.LookupBot = verifier.Verify
+	}
 	if *reverseLookup {
 		log.Println("Enabling reverse lookup")
 		srv.LookupAddr = iputil.LookupAddr
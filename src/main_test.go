@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/apimgr/echoip/src/cloud"
+	"github.com/apimgr/echoip/src/iplist"
+	"github.com/apimgr/echoip/src/rir"
+)
 
 func TestMultiValueFlagString(t *testing.T) {
 	var xmvf = []struct {
@@ -40,3 +48,124 @@ func TestMultiValueFlagString(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigureIPLists(t *testing.T) {
+	m := iplist.NewManager(t.TempDir(), nil)
+	flags := map[iplist.Kind]multiValueFlag{
+		iplist.Tor:       {"tor-exits=https://mirror1/tor", "tor-exits=https://mirror2/tor"},
+		iplist.Hosting:   {"own=https://lists/hosting"},
+		iplist.Blocklist: {"firehol=https://lists/firehol"},
+	}
+	scores := multiValueFlag{"tor-exits=30", "spamhaus-drop-v6=90"}
+	defaults := append(iplist.DefaultLists(), iplist.DefaultBlocklists()...)
+	if err := configureIPLists(m, defaults, flags, scores); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range m.Lists() {
+		got = append(got, fmt.Sprintf("%s %s %d %v", l.Name, l.Kind, l.Score, l.Source.URLs))
+	}
+	want := []string{
+		"tor-exits tor 30 [https://mirror1/tor https://mirror2/tor]",
+		"x4bnet-vpn vpn 0 [https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/vpn/ipv4.txt]",
+		"x4bnet-datacenter hosting 0 [https://raw.githubusercontent.com/X4BNet/lists_vpn/main/output/datacenter/ipv4.txt]",
+		"spamhaus-drop blocklist 100 [https://www.spamhaus.org/drop/drop_v4.json]",
+		"spamhaus-drop-v6 blocklist 90 [https://www.spamhaus.org/drop/drop_v6.json]",
+		"own hosting 0 [https://lists/hosting]",
+		"firehol blocklist 100 [https://lists/firehol]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected lists %q, got %q", want, got)
+	}
+
+	for _, tt := range []struct {
+		flags  map[iplist.Kind]multiValueFlag
+		scores multiValueFlag
+	}{
+		{map[iplist.Kind]multiValueFlag{iplist.VPN: {"tor-exits=https://lists/vpn"}}, nil},
+		{map[iplist.Kind]multiValueFlag{iplist.VPN: {"https://lists/vpn"}}, nil},
+		{nil, multiValueFlag{"unknown=50"}},
+		{nil, multiValueFlag{"tor-exits=high"}},
+		{nil, multiValueFlag{"tor-exits=101"}},
+	} {
+		if err := configureIPLists(iplist.NewManager(t.TempDir(), nil), iplist.DefaultLists(), tt.flags, tt.scores); err == nil {
+			t.Errorf("Expected error for %v and scores %v", tt.flags, tt.scores)
+		}
+	}
+}
+
+func TestConfigureCloud(t *testing.T) {
+	m := cloud.NewManager(t.TempDir(), nil)
+	feeds := multiValueFlag{
+		"cloudflare=https://mirror/ips-v4",
+		"azure=/srv/ServiceTags_Public.json",
+		"digitalocean=https://digitalocean.com/geo/google.csv",
+	}
+	if err := configureCloud(m, cloud.DefaultFeeds(), feeds); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range m.Feeds() {
+		got = append(got, fmt.Sprintf("%s %v %s", f.Provider, f.Source.URLs, f.File))
+	}
+	want := []string{
+		"aws [https://ip-ranges.amazonaws.com/ip-ranges.json] ",
+		"gcp [https://www.gstatic.com/ipranges/cloud.json] ",
+		"oracle [https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json] ",
+		"cloudflare [https://mirror/ips-v4] ",
+		"azure [] /srv/ServiceTags_Public.json",
+		"digitalocean [https://digitalocean.com/geo/google.csv] ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected feeds %q, got %q", want, got)
+	}
+
+	for _, feeds := range []multiValueFlag{
+		{"https://ip-ranges.amazonaws.com/ip-ranges.json"},
+		{"Amazon Web Services=https://ip-ranges.amazonaws.com/ip-ranges.json"},
+		{"aws="},
+	} {
+		if err := configureCloud(cloud.NewManager(t.TempDir(), nil), nil, feeds); err == nil {
+			t.Errorf("Expected error for %v", feeds)
+		}
+	}
+}
+
+func TestConfigureRIR(t *testing.T) {
+	m := rir.NewManager(t.TempDir(), nil)
+	sources := multiValueFlag{
+		"ripencc=/srv/delegated-ripencc-extended-latest",
+		"arin=https://mirror1/arin",
+		"arin=https://mirror2/arin",
+		"nro=https://ftp.ripe.net/pub/stats/ripencc/nro-stats/latest/nro-delegated-stats",
+	}
+	if err := configureRIR(m, rir.DefaultRegistries(), sources); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, reg := range m.Registries() {
+		got = append(got, fmt.Sprintf("%s %v %s", reg.Name, reg.Source.URLs, reg.File))
+	}
+	want := []string{
+		"arin [https://mirror1/arin https://mirror2/arin] ",
+		"ripencc [] /srv/delegated-ripencc-extended-latest",
+		"apnic [https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest] ",
+		"lacnic [https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest] ",
+		"afrinic [https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest] ",
+		"nro [https://ftp.ripe.net/pub/stats/ripencc/nro-stats/latest/nro-delegated-stats] ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected registries %q, got %q", want, got)
+	}
+
+	for _, sources := range []multiValueFlag{
+		{"https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest"},
+		{"arin=/srv/arin", "arin=/srv/arin2"},
+		{"arin=/srv/arin", "arin=https://mirror/arin"},
+		{"ARIN=/srv/arin"},
+	} {
+		if err := configureRIR(rir.NewManager(t.TempDir(), nil), nil, sources); err == nil {
+			t.Errorf("Expected error for %v", sources)
+		}
+	}
+}
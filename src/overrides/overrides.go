@@ -0,0 +1,319 @@
+// Package overrides annotates networks with geo data and custom tags that take
+// precedence over the geo databases.
+package overrides
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Override is the data configured for a network. Fields that are not set
+// leave the results of the geo databases unchanged. Field names follow the
+// JSON API.
+type Override struct {
+	Network    string            `yaml:"network"`
+	Country    string            `yaml:"country"`
+	CountryISO string            `yaml:"country_iso"`
+	CountryEU  *bool             `yaml:"country_eu"`
+	RegionName string            `yaml:"region_name"`
+	RegionCode string            `yaml:"region_code"`
+	City       string            `yaml:"city"`
+	PostalCode string            `yaml:"zip_code"`
+	Latitude   float64           `yaml:"latitude"`
+	Longitude  float64           `yaml:"longitude"`
+	Timezone   string            `yaml:"time_zone"`
+	ASN        ASN               `yaml:"asn"`
+	ASNOrg     string            `yaml:"asn_org"`
+	Tags       map[string]string `yaml:"tags"`
+}
+
+// ASN is an autonomous system number, written as 64500 or AS64500.
+type ASN uint
+
+func (a *ASN) UnmarshalYAML(n *yaml.Node) error {
+	v := strings.TrimPrefix(strings.ToUpper(n.Value), "AS")
+	asn, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid asn: %s", n.Value)
+	}
+	*a = ASN(asn)
+	return nil
+}
+
+// merge fills the fields of o that are not set from other.
+func (o *Override) merge(other Override) {
+	for _, f := range []struct{ dst, v *string }{
+		{&o.Country, &other.Country},
+		{&o.CountryISO, &other.CountryISO},
+		{&o.RegionName, &other.RegionName},
+		{&o.RegionCode, &other.RegionCode},
+		{&o.City, &other.City},
+		{&o.PostalCode, &other.PostalCode},
+		{&o.Timezone, &other.Timezone},
+		{&o.ASNOrg, &other.ASNOrg},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.v
+		}
+	}
+	if o.CountryEU == nil {
+		o.CountryEU = other.CountryEU
+	}
+	// Coordinates are always taken together
+	if o.Latitude == 0 && o.Longitude == 0 {
+		o.Latitude, o.Longitude = other.Latitude, other.Longitude
+	}
+	if o.ASN == 0 {
+		o.ASN = other.ASN
+	}
+	for k, v := range other.Tags {
+		if _, ok := o.Tags[k]; !ok {
+			if o.Tags == nil {
+				o.Tags = make(map[string]string)
+			}
+			o.Tags[k] = v
+		}
+	}
+}
+
+// table holds overrides by prefix length, so that the most specific override
+// is found first. Networks are keyed by their 16 byte address.
+type table struct {
+	lengths  []int
+	networks map[int]map[[16]byte]Override
+}
+
+func newTable(overrides []Override) (*table, error) {
+	t := &table{networks: make(map[int]map[[16]byte]Override)}
+	for _, o := range overrides {
+		_, n, err := net.ParseCIDR(o.Network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %q", o.Network)
+		}
+		ones, bits := n.Mask.Size()
+		length := ones + 128 - bits
+		o.Network = n.String()
+		var key [16]byte
+		copy(key[:], n.IP.To16())
+		networks, ok := t.networks[length]
+		if !ok {
+			networks = make(map[[16]byte]Override)
+			t.networks[length] = networks
+			t.lengths = append(t.lengths, length)
+		}
+		if _, ok := networks[key]; ok {
+			return nil, fmt.Errorf("duplicate network: %s", o.Network)
+		}
+		networks[key] = o
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	return t, nil
+}
+
+// lookup combines the overrides of all networks containing ip. Fields are
+// taken from the most specific network that sets them.
+func (t *table) lookup(ip net.IP) (Override, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return Override{}, false
+	}
+	var (
+		o     Override
+		found bool
+	)
+	for _, length := range t.lengths {
+		var key [16]byte
+		copy(key[:], ip.Mask(net.CIDRMask(length, 128)))
+		match, ok := t.networks[length][key]
+		if !ok {
+			continue
+		}
+		if !found {
+			o.Network = match.Network
+			found = true
+		}
+		o.merge(match)
+	}
+	return o, found
+}
+
+// File holds the overrides loaded from a YAML, JSON or CSV file, chosen by
+// its extension.
+type File struct {
+	path     string
+	current  atomic.Pointer[table]
+	mu       sync.Mutex
+	modTime  time.Time
+	onUpdate []func()
+}
+
+// Load reads the overrides in path.
+func Load(path string) (*File, error) {
+	f := &File{path: path}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Lookup returns the override for ip and whether there is one.
+func (f *File) Lookup(ip net.IP) (Override, bool) {
+	return f.current.Load().lookup(ip)
+}
+
+// OnUpdate registers fn to be called after the overrides have been reloaded,
+// e.g. to invalidate cached lookups.
+func (f *File) OnUpdate(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onUpdate = append(f.onUpdate, fn)
+}
+
+// Reload reads the file again if it has been modified since it was last read
+// and reports whether it was. The current overrides are kept if the file
+// cannot be loaded.
+func (f *File) Reload() (bool, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fi.ModTime().Equal(f.modTime) && f.current.Load() != nil {
+		return false, nil
+	}
+	// A file that fails to load is not read again until it changes
+	f.modTime = fi.ModTime()
+	overrides, err := readFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	t, err := newTable(overrides)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", f.path, err)
+	}
+	reloaded := f.current.Swap(t) != nil
+	if reloaded {
+		for _, fn := range f.onUpdate {
+			fn()
+		}
+	}
+	return reloaded, nil
+}
+
+// Watch reloads the file every interval when it has changed, until stop is
+// called.
+func (f *File) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				reloaded, err := f.Reload()
+				if err != nil {
+					log.Printf("Failed to reload overrides: %v", err)
+				} else if reloaded {
+					log.Printf("Reloaded overrides from %s", f.path)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func readFile(path string) ([]Override, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var overrides []Override
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		// JSON is a subset of YAML
+		dec := yaml.NewDecoder(file)
+		dec.KnownFields(true)
+		if err := dec.Decode(&overrides); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".csv":
+		if overrides, err = readCSV(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type: %s", path, ext)
+	}
+	return overrides, nil
+}
+
+// readCSV reads overrides from CSV with a header row naming the columns.
+// Columns that are not Override fields are tags. Each row is decoded as YAML
+// so that values are parsed the same way as in YAML files.
+func readCSV(r io.Reader) ([]Override, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	var overrides []Override
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		doc := &yaml.Node{Kind: yaml.MappingNode}
+		tags := &yaml.Node{Kind: yaml.MappingNode}
+		for i, v := range row {
+			name := strings.TrimSpace(header[i])
+			if v == "" || name == "tags" {
+				continue
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Value: name, Line: line}
+			value := &yaml.Node{Kind: yaml.ScalarNode, Value: v, Line: line}
+			if overrideFields[name] {
+				doc.Content = append(doc.Content, key, value)
+			} else {
+				value.Tag = "!!str"
+				tags.Content = append(tags.Content, key, value)
+			}
+		}
+		if len(tags.Content) > 0 {
+			doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "tags"}, tags)
+		}
+		var o Override
+		if err := doc.Decode(&o); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// overrideFields holds the names of the Override fields other than tags.
+var overrideFields = map[string]bool{
+	"network": true, "country": true, "country_iso": true, "country_eu": true,
+	"region_name": true, "region_code": true, "city": true, "zip_code": true,
+	"latitude": true, "longitude": true, "time_zone": true, "asn": true, "asn_org": true,
+}
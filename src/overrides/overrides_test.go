@@ -0,0 +1,144 @@
+package overrides
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlOverrides = `
+- network: 10.0.0.0/8
+  country: Norway
+  country_iso: "NO"
+  country_eu: false
+  asn: AS64500
+  asn_org: Example Corp
+  tags:
+    owner: network-team
+    env: corp
+- network: 10.1.0.0/16
+  city: Oslo
+  latitude: 59.91
+  longitude: 10.75
+  tags:
+    env: lab
+- network: 2001:db8::/32
+  country_iso: SE
+`
+
+func TestLookup(t *testing.T) {
+	eu := false
+	corp := Override{Network: "10.0.0.0/8", Country: "Norway", CountryISO: "NO", CountryEU: &eu, ASN: 64500,
+		ASNOrg: "Example Corp", Tags: map[string]string{"owner": "network-team", "env": "corp"}}
+	lab := Override{Network: "10.1.0.0/16", Country: "Norway", CountryISO: "NO", CountryEU: &eu, City: "Oslo",
+		Latitude: 59.91, Longitude: 10.75, ASN: 64500, ASNOrg: "Example Corp",
+		Tags: map[string]string{"owner": "network-team", "env": "lab"}}
+	csvOverrides := "network,country,country_iso,country_eu,city,latitude,longitude,asn,asn_org,owner,env\n" +
+		"10.0.0.0/8,Norway,NO,false,,,,AS64500,Example Corp,network-team,corp\n" +
+		"10.1.0.0/16,,,,Oslo,59.91,10.75,,,,lab\n" +
+		"2001:db8::/32,,SE,,,,,,,,\n"
+	jsonOverrides := `[
+		{"network": "10.0.0.0/8", "country": "Norway", "country_iso": "NO", "country_eu": false, "asn": 64500,
+		 "asn_org": "Example Corp", "tags": {"owner": "network-team", "env": "corp"}},
+		{"network": "10.1.0.0/16", "city": "Oslo", "latitude": 59.91, "longitude": 10.75, "tags": {"env": "lab"}},
+		{"network": "2001:db8::/32", "country_iso": "SE"}
+	]`
+	for _, file := range []struct{ name, content string }{
+		{"overrides.yaml", yamlOverrides},
+		{"overrides.json", jsonOverrides},
+		{"overrides.csv", csvOverrides},
+	} {
+		f, err := Load(writeFile(t, file.name, file.content))
+		if err != nil {
+			t.Fatalf("%s: %v", file.name, err)
+		}
+		var tests = []struct {
+			ip    string
+			out   Override
+			found bool
+		}{
+			{"10.2.0.1", corp, true},
+			{"10.1.2.3", lab, true},
+			{"2001:db8::1", Override{Network: "2001:db8::/32", CountryISO: "SE"}, true},
+			{"192.0.2.1", Override{}, false},
+		}
+		for _, tt := range tests {
+			out, found := f.Lookup(net.ParseIP(tt.ip))
+			if found != tt.found || !reflect.DeepEqual(out, tt.out) {
+				t.Errorf("%s: Lookup(%s) = %+v, %t, want %+v, %t", file.name, tt.ip, out, found, tt.out, tt.found)
+			}
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"bad.yaml", "- network: 10.0.0.0/33\n", `invalid network: "10.0.0.0/33"`},
+		{"dup.yaml", "- network: 10.0.0.0/8\n- network: 10.0.0.1/8\n", "duplicate network: 10.0.0.0/8"},
+		{"typo.yaml", "- network: 10.0.0.0/8\n  contry: Norway\n", "field contry not found"},
+		{"asn.csv", "network,asn\n10.0.0.0/8,ASX\n", "line 2: invalid asn: ASX"},
+		{"overrides.txt", "", "unsupported file type: .txt"},
+	}
+	for _, tt := range tests {
+		_, err := Load(writeFile(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Load(%s) = %v, want error containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "overrides.yaml", "- network: 10.0.0.0/8\n  city: Oslo\n")
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := 0
+	f.OnUpdate(func() { updates++ })
+	if reloaded, err := f.Reload(); reloaded || err != nil {
+		t.Errorf("Reload() = %t, %v for unchanged file, want false, nil", reloaded, err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(path, []byte("- network: 10.0.0.0/8\n  city: Bergen\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, later, later)
+	if reloaded, err := f.Reload(); !reloaded || err != nil {
+		t.Errorf("Reload() = %t, %v for changed file, want true, nil", reloaded, err)
+	}
+	if o, _ := f.Lookup(ip); o.City != "Bergen" || updates != 1 {
+		t.Errorf("City = %q after %d updates, want Bergen after 1", o.City, updates)
+	}
+
+	// Invalid files keep the current overrides
+	if err := os.WriteFile(path, []byte("- network: invalid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if _, err := f.Reload(); err == nil {
+		t.Error("Reload() succeeded for invalid file")
+	}
+	if o, _ := f.Lookup(ip); o.City != "Bergen" {
+		t.Errorf("City = %q after failed reload, want Bergen", o.City)
+	}
+}
@@ -0,0 +1,212 @@
+// Package rir looks up the Regional Internet Registry delegation of
+// addresses in the registries' delegated-extended statistics files, which
+// are downloaded from configurable URLs and refreshed periodically, or read
+// from local files.
+package rir
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iputil/iprange"
+	"github.com/apimgr/echoip/src/iputil/subnet"
+)
+
+// Delegation describes the delegation of a range of addresses by a registry.
+type Delegation struct {
+	// Registry is the registry as named in its statistics, e.g. ripencc.
+	Registry string
+	// Country is the ISO 3166 code of the country the holder of the range
+	// is in, if any.
+	Country string
+	// Date is the date of the delegation as YYYY-MM-DD, if known.
+	Date string
+	// Status is allocated, assigned, available or reserved.
+	Status string
+}
+
+// Registry describes the statistics file of a registry and where to get it
+// from.
+type Registry struct {
+	// Name names the file of the registry in the data directory.
+	Name string
+	// Source is where to download the file from.
+	Source geoip.Source
+	// File, if set, is a local copy of the file that is read instead of
+	// downloading it. It is reloaded when it changes.
+	File string
+}
+
+// DefaultRegistries returns the delegated-extended statistics of ARIN, RIPE
+// NCC, APNIC, LACNIC and AFRINIC.
+func DefaultRegistries() []Registry {
+	return []Registry{
+		{Name: "arin", Source: geoip.Source{URLs: []string{"https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest"}}},
+		{Name: "ripencc", Source: geoip.Source{URLs: []string{"https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest"}}},
+		{Name: "apnic", Source: geoip.Source{URLs: []string{"https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest"}}},
+		{Name: "lacnic", Source: geoip.Source{URLs: []string{"https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest"}}},
+		{Name: "afrinic", Source: geoip.Source{URLs: []string{"https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest"}}},
+	}
+}
+
+// Parse reads a delegated or delegated-extended statistics file into t. The
+// version and summary lines are skipped, as are ASN records. IPv4 records
+// give the number of addresses in the range and IPv6 records its prefix
+// length.
+func Parse(r io.Reader, t *iprange.Table[Delegation]) error {
+	records := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		if _, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			// Version line
+			continue
+		}
+		if len(fields) == 6 && fields[5] == "summary" {
+			continue
+		}
+		if len(fields) < 7 {
+			return fmt.Errorf("line %d: expected at least 7 fields", line)
+		}
+		var start, end net.IP
+		switch fields[2] {
+		case "ipv4":
+			start = net.ParseIP(fields[3]).To4()
+			count, err := strconv.ParseUint(fields[4], 10, 32)
+			if start == nil || err != nil || count == 0 {
+				return fmt.Errorf("line %d: invalid IPv4 range %s+%s", line, fields[3], fields[4])
+			}
+			last := uint64(binary.BigEndian.Uint32(start)) + count - 1
+			if last > 0xffffffff {
+				return fmt.Errorf("line %d: invalid IPv4 range %s+%s", line, fields[3], fields[4])
+			}
+			end = make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(end, uint32(last))
+		case "ipv6":
+			n, err := subnet.Parse(fields[3] + "/" + fields[4])
+			if err != nil || n.IP.To4() != nil {
+				return fmt.Errorf("line %d: invalid IPv6 range %s/%s", line, fields[3], fields[4])
+			}
+			start, end = n.IP, subnet.Last(n)
+		default:
+			continue
+		}
+		d := Delegation{
+			Registry: fields[0],
+			Country:  strings.ToUpper(fields[1]),
+			Date:     parseDate(fields[5]),
+			Status:   strings.ToLower(fields[6]),
+		}
+		if d.Country == "ZZ" {
+			d.Country = ""
+		}
+		if err := t.Add(start, end, d); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		records++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if records == 0 {
+		return fmt.Errorf("no delegations found")
+	}
+	t.Sort()
+	return nil
+}
+
+// parseDate converts a YYYYMMDD date to YYYY-MM-DD. Missing and invalid
+// dates, such as the 00000000 of ranges delegated before records were kept,
+// are empty.
+func parseDate(s string) string {
+	d, err := time.Parse("20060102", s)
+	if err != nil {
+		return ""
+	}
+	return d.Format("2006-01-02")
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+func loadFile(file string) (*iprange.Table[Delegation], error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &iprange.Table[Delegation]{}
+	if err := Parse(f, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Manager downloads statistics files to a data directory and looks up
+// addresses in them. The embedded FileSet initializes, updates and reloads the
+// files.
+type Manager struct {
+	*geoip.FileSet[*iprange.Table[Delegation]]
+	dir        string
+	registries []Registry
+}
+
+// NewManager creates a Manager storing statistics files in the rir
+// subdirectory of dataDir. Files are downloaded with downloader.
+func NewManager(dataDir string, downloader *geoip.Downloader) *Manager {
+	return &Manager{
+		FileSet: geoip.NewFileSet[*iprange.Table[Delegation]](downloader),
+		dir:     filepath.Join(dataDir, "rir"),
+	}
+}
+
+// Add configures a registry. Registries are consulted in the order they were
+// added.
+func (m *Manager) Add(reg Registry) error {
+	if !validName.MatchString(reg.Name) {
+		return fmt.Errorf("invalid registry name: %q", reg.Name)
+	}
+	if (reg.File == "") == (len(reg.Source.URLs) == 0) {
+		return fmt.Errorf("registry %s needs either URLs or a file", reg.Name)
+	}
+	for _, other := range m.registries {
+		if other.Name == reg.Name {
+			return fmt.Errorf("duplicate registry: %s", reg.Name)
+		}
+	}
+	m.registries = append(m.registries, reg)
+	spec := geoip.FileSpec{Name: "delegations of " + reg.Name, File: reg.File}
+	if reg.File == "" {
+		spec.File, spec.Source = filepath.Join(m.dir, reg.Name+".txt"), reg.Source
+	}
+	m.FileSet.Add(spec, loadFile)
+	return nil
+}
+
+// Registries returns the configured registries.
+func (m *Manager) Registries() []Registry {
+	return m.registries
+}
+
+// Lookup returns the delegation of ip from the first registry that has one.
+func (m *Manager) Lookup(ip net.IP) (Delegation, bool) {
+	for _, t := range m.Values() {
+		if d, _, ok := t.Lookup(ip); ok {
+			return d, true
+		}
+	}
+	return Delegation{}, false
+}
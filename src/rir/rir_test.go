@@ -0,0 +1,121 @@
+package rir
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/echoip/src/geoip"
+	"github.com/apimgr/echoip/src/iputil/iprange"
+)
+
+const ripeStats = `2|ripencc|1760659199|4|19830705|20251016|+0200
+ripencc|*|asn|*|1|summary
+ripencc|*|ipv4|*|2|summary
+ripencc|*|ipv6|*|1|summary
+ripencc|FR|asn|3215|1|19930901|allocated|d6e0f9cd-6c8c-4bd1-8a6b-8f6a2d64b3c1
+ripencc|FR|ipv4|2.0.0.0|1048576|20100712|allocated|d6e0f9cd-6c8c-4bd1-8a6b-8f6a2d64b3c1
+ripencc|GB|ipv4|5.62.88.0|768|20120607|assigned|9d5e5a3c-f2a1-4c1e-9d55-3f6d4d2b2a11
+ripencc|NL|ipv6|2001:610::|32|19990819|allocated|3c7b2f3e-0b4c-4f0e-9a77-2e4f7d9e1c55
+`
+
+const arinStats = `2.3|arin|1760659199|3|19700101|20251016|-0400
+arin|*|ipv4|*|2|summary
+arin|US|ipv4|3.0.0.0|16777216|20170803|allocated|e5e3b8a1-4b1e-4d8e-9c2f-6f1a2b3c4d5e
+arin||ipv4|23.128.0.0|65536||reserved|
+`
+
+func TestParse(t *testing.T) {
+	var delegations iprange.Table[Delegation]
+	if err := Parse(strings.NewReader(ripeStats), &delegations); err != nil {
+		t.Fatal(err)
+	}
+	if err := Parse(strings.NewReader(arinStats), &delegations); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		ip   string
+		want Delegation
+		ok   bool
+	}{
+		{"2.15.255.255", Delegation{"ripencc", "FR", "2010-07-12", "allocated"}, true},
+		{"2.16.0.0", Delegation{}, false},
+		{"5.62.90.255", Delegation{"ripencc", "GB", "2012-06-07", "assigned"}, true},
+		{"5.62.91.0", Delegation{}, false},
+		{"2001:610:1::1", Delegation{"ripencc", "NL", "1999-08-19", "allocated"}, true},
+		{"2001:611::1", Delegation{}, false},
+		{"3.5.140.1", Delegation{"arin", "US", "2017-08-03", "allocated"}, true},
+		{"23.128.1.1", Delegation{"arin", "", "", "reserved"}, true},
+	}
+	for _, tt := range tests {
+		got, _, ok := delegations.Lookup(net.ParseIP(tt.ip))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%s) = %+v, %t, want %+v, %t", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"<html>Not found</html>\n",
+		"2|ripencc|1760659199|1|19830705|20251016|+0200\nripencc|*|ipv4|*|0|summary\n",
+		"ripencc|FR|ipv4|2.0.0.0|0|20100712|allocated\n",
+		"ripencc|FR|ipv4|255.255.255.0|512|20100712|allocated\n",
+		"ripencc|NL|ipv6|2001:610::|129|19990819|allocated\n",
+	} {
+		if err := Parse(strings.NewReader(in), &iprange.Table[Delegation]{}); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	dir := t.TempDir()
+	ripe := filepath.Join(dir, "delegated-ripencc-extended-latest")
+	arin := filepath.Join(dir, "delegated-arin-extended-latest")
+	for file, stats := range map[string]string{ripe: ripeStats, arin: arinStats} {
+		if err := os.WriteFile(file, []byte(stats), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewManager(t.TempDir(), nil)
+	for _, reg := range []Registry{
+		{Name: "ripencc", File: ripe},
+		{Name: "arin", File: arin},
+	} {
+		if err := m.Add(reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, reg := range []Registry{
+		{Name: "arin", File: arin},
+		{Name: "../etc", File: arin},
+		{Name: "lacnic"},
+		{Name: "lacnic", File: arin, Source: geoip.Source{URLs: []string{"http://rir.invalid/lacnic"}}},
+	} {
+		if err := m.Add(reg); err == nil {
+			t.Errorf("Add(%+v) succeeded, want error", reg)
+		}
+	}
+	if err := m.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		ip   string
+		want Delegation
+	}{
+		{"2.0.0.1", Delegation{"ripencc", "FR", "2010-07-12", "allocated"}},
+		{"3.0.0.1", Delegation{"arin", "US", "2017-08-03", "allocated"}},
+	} {
+		if got, ok := m.Lookup(net.ParseIP(tt.ip)); got != tt.want || !ok {
+			t.Errorf("Lookup(%s) = %+v, %t, want %+v", tt.ip, got, ok, tt.want)
+		}
+	}
+	if _, ok := m.Lookup(net.ParseIP("192.0.2.1")); ok {
+		t.Error("Lookup(192.0.2.1) found a delegation")
+	}
+}
@@ -2,6 +2,7 @@
 
 import (
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -9,7 +10,7 @@
 // Task represents a scheduled task
 type Task struct {
 	Name     string
-	Schedule string // Cron-like: "0 3 * * 0" = Sunday 3:00 AM
+	Schedule string // Cron-like: "0 3 * * 0" = Sunday 3:00 AM, or "@every 1h"
 	Fn       func() error
 	nextRun  time.Time
 	running  bool
@@ -40,7 +41,7 @@ func (s *Scheduler) AddTask(name, schedule string, fn func() error) {
 		Name:     name,
 		Schedule: schedule,
 		Fn:       fn,
-		nextRun:  calculateNextRun(schedule),
+		nextRun:  calculateNextRun(schedule, time.Now()),
 	}
 
 	s.tasks = append(s.tasks, task)
@@ -99,7 +100,7 @@ func (s *Scheduler) runTask(task *Task) {
 	defer func() {
 		s.mu.Lock()
 		task.running = false
-		task.nextRun = calculateNextRun(task.Schedule)
+		task.nextRun = calculateNextRun(task.Schedule, time.Now())
 		s.mu.Unlock()
 	}()
 
@@ -112,10 +113,15 @@ func (s *Scheduler) runTask(task *Task) {
 	}
 }
 
-// calculateNextRun calculates the next run time based on cron schedule
-// Simplified version - supports weekly schedules like "0 3 * * 0"
-func calculateNextRun(schedule string) time.Time {
-	now := time.Now()
+// calculateNextRun calculates the next run time after now based on cron schedule
+// Simplified version - supports weekly schedules like "0 3 * * 0" and fixed
+// intervals like "@every 1h"
+func calculateNextRun(schedule string, now time.Time) time.Time {
+	if v, ok := strings.CutPrefix(schedule, "@every "); ok {
+		if interval, err := time.ParseDuration(v); err == nil && interval > 0 {
+			return now.Add(interval)
+		}
+	}
 
 	// Parse schedule (simplified for weekly: "0 3 * * 0" = Sunday 3 AM)
 	// For now, if contains "* * 0", it's weekly on Sunday
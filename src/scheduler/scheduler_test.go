@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestCalculateNextRun(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2025, 10, 15, 12, 30, 0, 0, time.UTC)
+	week := now.Add(7 * 24 * time.Hour)
+	var tests = []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"@every 1h", now.Add(time.Hour)},
+		{"@every 90m", now.Add(90 * time.Minute)},
+		{"@every 1h30m", now.Add(90 * time.Minute)},
+		{"@every 24h", now.Add(24 * time.Hour)},
+		{"@every 1s", now.Add(time.Second)},
+		// Invalid intervals fall back to the default of a week
+		{"@every 0s", week},
+		{"@every 0", week},
+		{"@every -1h", week},
+		{"@every 1h garbage", week},
+		{"@every 1h ", week},
+		{"@every", week},
+		{"@every ", week},
+		{"@every1h", week},
+		{"@every 1d", week},
+		{"every 1h", week},
+		// Weekly on Sunday at 3:00
+		{"0 3 * * 0", time.Date(2025, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{"", week},
+	}
+	for _, tt := range tests {
+		if got := calculateNextRun(tt.schedule, now); !got.Equal(tt.want) {
+			t.Errorf("calculateNextRun(%q) = %s, want %s", tt.schedule, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateNextRunSunday(t *testing.T) {
+	var tests = []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 10, 19, 2, 59, 0, 0, time.UTC), time.Date(2025, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 10, 19, 3, 0, 0, 0, time.UTC), time.Date(2025, 10, 26, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 10, 18, 23, 0, 0, 0, time.UTC), time.Date(2025, 10, 19, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := calculateNextRun("0 3 * * 0", tt.now); !got.Equal(tt.want) {
+			t.Errorf("calculateNextRun at %s = %s, want %s", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTasks(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	s := New()
+	ran := make(chan string, 2)
+	s.AddTask("hourly", "@every 1h", func() error { ran <- "hourly"; return nil })
+	s.AddTask("daily", "@every 24h", func() error { ran <- "daily"; return nil })
+	start := s.tasks[0].nextRun.Add(-time.Hour)
+
+	// Only tasks whose interval has passed run, and they are rescheduled
+	// after running
+	s.checkTasks(start.Add(30 * time.Minute))
+	s.checkTasks(start.Add(61 * time.Minute))
+	select {
+	case name := <-ran:
+		if name != "hourly" {
+			t.Errorf("Expected hourly task to run, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Hourly task did not run")
+	}
+	select {
+	case name := <-ran:
+		t.Errorf("Unexpected run of %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
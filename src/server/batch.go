@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iputil"
+)
+
+const (
+	ndjsonMediaType = "application/x-ndjson"
+
+	// DefaultBatchLimit is the maximum number of addresses accepted by a
+	// single batch lookup when Server.BatchLimit is not set.
+	DefaultBatchLimit = 1000
+
+	// maxBatchItemSize bounds the request body relative to the batch limit.
+	// It comfortably fits a quoted, bracketed IPv6 address with a zone.
+	maxBatchItemSize = 128
+)
+
+// BatchResult is a single entry of a batch lookup. Query holds the address
+// as it was submitted, and exactly one of Response and Error is set.
+type BatchResult struct {
+	Query string `json:"query"`
+	*Response
+	Error string `json:"error,omitempty"`
+}
+
+// batchQuery is an entry of a batch request. Entries that cannot be looked
+// up, such as JSON values that are not strings, carry the error of their
+// result.
+type batchQuery struct {
+	text string
+	err  string
+}
+
+// batchReader yields the addresses of a batch request one at a time, so that
+// large batches can be processed without reading the whole body first.
+type batchReader interface {
+	Next() (batchQuery, bool, error)
+}
+
+type jsonBatchReader struct {
+	dec     *json.Decoder
+	started bool
+}
+
+func (b *jsonBatchReader) Next() (batchQuery, bool, error) {
+	if !b.started {
+		t, err := b.dec.Token()
+		if err != nil {
+			return batchQuery{}, false, err
+		}
+		if d, ok := t.(json.Delim); !ok || d != '[' {
+			return batchQuery{}, false, fmt.Errorf("expected JSON array of IP addresses")
+		}
+		b.started = true
+	}
+	if !b.dec.More() {
+		return batchQuery{}, false, nil
+	}
+	var raw json.RawMessage
+	if err := b.dec.Decode(&raw); err != nil {
+		return batchQuery{}, false, err
+	}
+	var query string
+	if err := json.Unmarshal(raw, &query); err != nil {
+		return batchQuery{text: string(raw), err: "expected IP address string"}, true, nil
+	}
+	return batchQuery{text: query}, true, nil
+}
+
+type textBatchReader struct {
+	scanner *bufio.Scanner
+}
+
+func (b *textBatchReader) Next() (batchQuery, bool, error) {
+	for b.scanner.Scan() {
+		line := strings.TrimSpace(b.scanner.Text())
+		if line != "" {
+			return batchQuery{text: line}, true, nil
+		}
+	}
+	return batchQuery{}, false, b.scanner.Err()
+}
+
+// newBatchReader picks a JSON or newline-delimited reader for the request
+// body. JSON is used when requested via Content-Type or when the body starts
+// with an array.
+func newBatchReader(r *http.Request, body io.Reader) batchReader {
+	br := bufio.NewReader(body)
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), jsonMediaType)
+	if !isJSON {
+		for {
+			c, err := br.ReadByte()
+			if err != nil {
+				break
+			}
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				continue
+			}
+			br.UnreadByte()
+			isJSON = c == '['
+			break
+		}
+	}
+	if isJSON {
+		return &jsonBatchReader{dec: json.NewDecoder(br)}
+	}
+	return &textBatchReader{scanner: bufio.NewScanner(br)}
+}
+
+func (s *Server) batchLimit() int {
+	if s.BatchLimit > 0 {
+		return s.BatchLimit
+	}
+	return DefaultBatchLimit
+}
+
+// batchConcurrency bounds the number of addresses of a batch that are looked
+// up at the same time, as reverse DNS lookups can be slow.
+const batchConcurrency = 8
+
+// batchError is the final line of a streamed batch that failed after results
+// have been written.
+type batchError struct {
+	Error string `json:"error"`
+}
+
+// batchResult looks up query as a single lookup requested by r would.
+func (s *Server) batchResult(query batchQuery, r *http.Request) BatchResult {
+	if query.err != "" {
+		return BatchResult{Query: query.text, Error: query.err}
+	}
+	ip := iputil.ParseIP(query.text)
+	if ip == nil {
+		return BatchResult{Query: query.text, Error: "invalid IP address"}
+	}
+	response := s.lookupIP(ip, allLookups)
+	s.prepareResponse(&response, r)
+	return BatchResult{Query: query.text, Response: &response}
+}
+
+// lookupBatch looks up the addresses read from br concurrently and passes the
+// results to emit in the order of the addresses. It returns the error of br,
+// an error if the batch exceeds limit, or the first error of emit.
+func (s *Server) lookupBatch(br batchReader, limit int, r *http.Request, emit func(BatchResult) error) error {
+	// Lookups are pending while in the buffer of pending or awaited below,
+	// which bounds their number, and pending keeps the order of the results
+	pending := make(chan chan BatchResult, batchConcurrency-1)
+	done := make(chan struct{})
+	defer close(done)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		for n := 0; ; n++ {
+			query, ok, err := br.Next()
+			if err == nil && ok && n == limit {
+				err = fmt.Errorf("batch exceeds limit of %d addresses", limit)
+			}
+			if err != nil || !ok {
+				readErr <- err
+				return
+			}
+			result := make(chan BatchResult, 1)
+			select {
+			case pending <- result:
+			case <-done:
+				readErr <- nil
+				return
+			}
+			go func() { result <- s.batchResult(query, r) }()
+		}
+	}()
+	for result := range pending {
+		if err := emit(<-result); err != nil {
+			return err
+		}
+	}
+	return <-readErr
+}
+
+func wantsNDJSON(r *http.Request) bool {
+	switch r.URL.Query().Get("stream") {
+	case "1", "true":
+		return true
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), ndjsonMediaType)
+}
+
+// BatchHandler handles POST /api/v1/ip/batch. The body is either a JSON array
+// of addresses or one address per line. Invalid addresses produce an error
+// entry instead of failing the whole batch.
+func (s *Server) BatchHandler(w http.ResponseWriter, r *http.Request) *appError {
+	limit := s.batchLimit()
+	body := http.MaxBytesReader(w, r.Body, int64(limit)*maxBatchItemSize)
+	br := newBatchReader(r, body)
+	if wantsNDJSON(r) {
+		return s.streamBatch(w, r, br, limit)
+	}
+	results := []BatchResult{}
+	err := s.lookupBatch(br, limit, r, func(result BatchResult) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return internalServerError(err).AsJSON()
+	}
+	w.Header().Set("Content-Type", jsonMediaType)
+	w.Write(b)
+	return nil
+}
+
+// streamBatch writes one JSON object per line as soon as each address has
+// been looked up. Errors that occur before the first line fail the request as
+// they do without streaming, while later ones are reported as a final line
+// carrying only an error.
+func (s *Server) streamBatch(w http.ResponseWriter, r *http.Request, br batchReader, limit int) *appError {
+	flusher, _ := w.(http.Flusher)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	written := false
+	writeLine := func(v interface{}) error {
+		buf.Reset()
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		if !written {
+			w.Header().Set("Content-Type", ndjsonMediaType)
+			written = true
+		}
+		w.Write(buf.Bytes())
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	var encodeErr error
+	err := s.lookupBatch(br, limit, r, func(result BatchResult) error {
+		encodeErr = writeLine(result)
+		return encodeErr
+	})
+	if encodeErr != nil {
+		return internalServerError(encodeErr).AsJSON()
+	}
+	if err != nil && !written {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	if err != nil {
+		if err := writeLine(batchError{Error: err.Error()}); err != nil {
+			return internalServerError(err).AsJSON()
+		}
+	}
+	return nil
+}
@@ -14,6 +14,8 @@ type Cache struct {
 	entries   map[uint64]*list.Element
 	values    *list.List
 	evictions uint64
+	// generation counts the calls of Clear
+	generation uint64
 }
 
 type CacheStats struct {
@@ -39,13 +41,27 @@ func key(ip net.IP) uint64 {
 	return h.Sum64()
 }
 
-func (c *Cache) Set(ip net.IP, resp Response) {
+// Generation returns the current generation of the cache, which changes when
+// the cache is cleared.
+func (c *Cache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// Set caches resp for ip if the cache is still at generation, i.e. it has not
+// been cleared since resp was looked up. Otherwise resp may stem from data that
+// has since changed and is dropped.
+func (c *Cache) Set(ip net.IP, resp Response, generation uint64) {
 	if c.capacity == 0 {
 		return
 	}
 	k := key(ip)
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
 	minEvictions := len(c.entries) - c.capacity + 1
 	if minEvictions > 0 { // At or above capacity. Shrink the cache
 		evicted := 0
@@ -77,6 +93,15 @@ func (c *Cache) Get(ip net.IP) (Response, bool) {
 	return r.Value.(Response), true
 }
 
+// Clear removes all entries, e.g. after the geo databases have changed.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[uint64]*list.Element)
+	c.values.Init()
+	c.generation++
+}
+
 func (c *Cache) Resize(capacity int) error {
 	if capacity < 0 {
 		return fmt.Errorf("invalid capacity: %d\n", capacity)
@@ -24,7 +24,7 @@ func TestCacheCapacity(t *testing.T) {
 			ip := net.ParseIP(fmt.Sprintf("192.0.2.%d", i))
 			r := Response{IP: ip}
 			responses = append(responses, r)
-			c.Set(ip, r)
+			c.Set(ip, r, 0)
 		}
 		if got := len(c.entries); got != tt.size {
 			t.Errorf("#%d: len(entries) = %d, want %d", i, got, tt.size)
@@ -49,8 +49,8 @@ func TestCacheDuplicate(t *testing.T) {
 	c := NewCache(10)
 	ip := net.ParseIP("192.0.2.1")
 	response := Response{IP: ip}
-	c.Set(ip, response)
-	c.Set(ip, response)
+	c.Set(ip, response, 0)
+	c.Set(ip, response, 0)
 	want := 1
 	if got := len(c.entries); got != want {
 		t.Errorf("want %d entries, got %d", want, got)
@@ -65,7 +65,7 @@ func TestCacheResize(t *testing.T) {
 	for i := 1; i <= 20; i++ {
 		ip := net.ParseIP(fmt.Sprintf("192.0.2.%d", i))
 		r := Response{IP: ip}
-		c.Set(ip, r)
+		c.Set(ip, r, 0)
 	}
 	if got, want := len(c.entries), 10; got != want {
 		t.Errorf("want %d entries, got %d", want, got)
@@ -80,8 +80,37 @@ func TestCacheResize(t *testing.T) {
 		t.Errorf("want %d evictions, got %d", want, got)
 	}
 	r := Response{IP: net.ParseIP("192.0.2.42")}
-	c.Set(r.IP, r)
+	c.Set(r.IP, r, 0)
 	if got, want := len(c.entries), 5; got != want {
 		t.Errorf("want %d entries, got %d", want, got)
 	}
 }
+
+func TestCacheClear(t *testing.T) {
+	c := NewCache(10)
+	for i := 1; i <= 5; i++ {
+		ip := net.ParseIP(fmt.Sprintf("192.0.2.%d", i))
+		c.Set(ip, Response{IP: ip}, 0)
+	}
+	c.Clear()
+	if got, want := len(c.entries), 0; got != want {
+		t.Errorf("want %d entries, got %d", want, got)
+	}
+	if got, want := c.values.Len(), 0; got != want {
+		t.Errorf("want %d values, got %d", want, got)
+	}
+	if _, ok := c.Get(net.ParseIP("192.0.2.1")); ok {
+		t.Errorf("Get(192.0.2.1) = (_, %t), want (_, %t)", ok, !ok)
+	}
+
+	// Responses looked up before the cache was cleared are not cached
+	ip := net.ParseIP("192.0.2.1")
+	c.Set(ip, Response{IP: ip}, 0)
+	if _, ok := c.Get(ip); ok {
+		t.Error("Set cached a response of a previous generation")
+	}
+	c.Set(ip, Response{IP: ip}, c.Generation())
+	if _, ok := c.Get(ip); !ok {
+		t.Error("Set did not cache a response of the current generation")
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/echoip/src/country"
+)
+
+// countryInfoFields holds the Response fields with metadata about the country
+// of the address. They are only included on request to keep responses short.
+var countryInfoFields = map[string]bool{
+	"country_flag":        true,
+	"country_iso3":        true,
+	"country_iso_numeric": true,
+	"country_capital":     true,
+	"country_tld":         true,
+	"currency":            true,
+	"currency_name":       true,
+	"currency_symbol":     true,
+	"calling_code":        true,
+	"languages":           true,
+}
+
+// wantCountryInfo reports whether responses to r should include the country
+// metadata fields, requested with country_info=true or by selecting one of
+// them.
+func wantCountryInfo(r *http.Request) bool {
+	return wantOptional(r, "country_info", countryInfoFields)
+}
+
+// setCountryInfo sets the country metadata fields of r. They are left empty if
+// the country is unknown.
+func (r *Response) setCountryInfo() {
+	c, ok := country.Lookup(r.CountryISO)
+	if !ok {
+		return
+	}
+	r.CountryFlag = c.Flag
+	r.CountryISO3 = c.Alpha3
+	r.CountryNumeric = c.Numeric
+	r.CountryCapital = c.Capital
+	r.CountryTLD = c.TLD
+	r.Currency = c.Currency
+	r.CurrencyName = c.CurrencyName
+	r.CurrencySymbol = c.CurrencySymbol
+	r.CallingCode = c.CallingCode
+	r.Languages = c.Languages
+}
+
+// CountryHandler handles /api/v1/country/{code} requests with the metadata of
+// the country with the given alpha-2, alpha-3 or numeric ISO 3166 code.
+func (s *Server) CountryHandler(w http.ResponseWriter, r *http.Request) *appError {
+	code := strings.TrimPrefix(r.URL.Path, "/api/v1/country/")
+	c, ok := country.Lookup(code)
+	if !ok {
+		err := fmt.Errorf("unknown country: %s", code)
+		return notFound(err).WithMessage(err.Error()).AsJSON()
+	}
+	return writeFormatted(w, r, c)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/echoip/src/overrides"
+)
+
+func TestCountryInfo(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupOverride = func(ip net.IP) (overrides.Override, bool) {
+		if ip.Equal(net.ParseIP("1.3.3.7")) {
+			return overrides.Override{Network: "1.3.3.0/24", CountryISO: "DE"}, true
+		}
+		return overrides.Override{}, false
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	germany := "{\n  \"country_iso\": \"DE\",\n  \"country_flag\": \"🇩🇪\",\n  \"country_iso3\": \"DEU\",\n  \"country_iso_numeric\": \"276\",\n  \"country_capital\": \"Berlin\",\n  \"country_tld\": \".de\",\n  \"currency\": \"EUR\",\n  \"currency_name\": \"Euro\",\n  \"currency_symbol\": \"€\",\n  \"calling_code\": \"+49\",\n  \"languages\": [\n    \"de\"\n  ]\n}"
+	var tests = []struct {
+		url  string
+		out  string
+		code int
+	}{
+		{"/1.3.3.7?fields=country_iso,country_flag,country_iso3,country_iso_numeric,country_capital,country_tld,currency,currency_name,currency_symbol,calling_code,languages", germany, 200},
+		{"/1.3.3.7?fields=country_iso,currency&country_info=false", "{\n  \"country_iso\": \"DE\",\n  \"currency\": \"EUR\"\n}", 200},
+		{"/json?fields=country_iso,currency", "{\n  \"country_iso\": \"EB\"\n}", 200},
+		{"/api/v1/calling-code?ip=1.3.3.7", "+49\n", 200},
+		{"/currency?ip=1.3.3.7", "EUR\n", 200},
+		{"/api/v1/country/de", "{\n  \"iso\": \"DE\",\n  \"iso3\": \"DEU\",\n  \"iso_numeric\": \"276\",\n  \"name\": \"Germany\",\n  \"flag\": \"🇩🇪\",\n  \"capital\": \"Berlin\",\n  \"currency\": \"EUR\",\n  \"currency_name\": \"Euro\",\n  \"currency_symbol\": \"€\",\n  \"calling_code\": \"+49\",\n  \"languages\": [\n    \"de\"\n  ],\n  \"tld\": \".de\"\n}", 200},
+		{"/api/v1/country/JPN?fields=name,currency", "{\n  \"name\": \"Japan\",\n  \"currency\": \"JPY\"\n}", 200},
+		{"/api/v1/country/840?format=sh&fields=calling_code", "ECHOIP_CALLING_CODE='+1'\n", 200},
+		{"/api/v1/country/ZZ", "{\n  \"status\": 404,\n  \"error\": \"unknown country: ZZ\"\n}", 404},
+	}
+	for _, tt := range tests {
+		out, status, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.code {
+			t.Errorf("Expected %d for %s, got %d", tt.code, tt.url, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+
+	// Without a selection, the fields are only included on request
+	out, _, err := httpGet(s.URL+"/1.3.3.7", jsonMediaType, "curl/7.2.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withInfo, _, err := httpGet(s.URL+"/1.3.3.7?country_info=true", jsonMediaType, "curl/7.2.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "currency") || !strings.Contains(withInfo, "\"currency\": \"EUR\"") {
+		t.Errorf("Expected currency only with country_info=true, got %q and %q", out, withInfo)
+	}
+}
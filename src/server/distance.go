@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iputil"
+	"github.com/apimgr/echoip/src/iputil/geo"
+)
+
+const kmPerMile = 1.609344
+
+// Location is an end point of a distance calculation, given as an address or
+// as coordinates.
+type Location struct {
+	Query      string  `json:"query"`
+	IP         net.IP  `json:"ip,omitempty"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	City       string  `json:"city,omitempty"`
+	Country    string  `json:"country,omitempty"`
+	CountryISO string  `json:"country_iso,omitempty"`
+}
+
+// DistanceResponse holds the great-circle distance between two locations and
+// the initial bearing, in degrees clockwise from north, from one to the other.
+type DistanceResponse struct {
+	From       Location `json:"from"`
+	To         Location `json:"to"`
+	DistanceKm float64  `json:"distance_km"`
+	DistanceMi float64  `json:"distance_mi"`
+	Bearing    float64  `json:"bearing"`
+}
+
+// parseCoordinates parses a location written as latitude,longitude.
+func parseCoordinates(s string) (lat, lon float64, ok bool) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err1 != nil || err2 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// locate resolves query, an address or coordinates, to a location.
+func (s *Server) locate(query string, langs []string) (Location, error) {
+	if lat, lon, ok := parseCoordinates(query); ok {
+		return Location{Query: query, Latitude: lat, Longitude: lon}, nil
+	}
+	ip := iputil.ParseIP(query)
+	if ip == nil {
+		return Location{}, fmt.Errorf("invalid IP address or coordinates: %s", query)
+	}
+	response := s.lookupIP(ip, countryLookup|cityLookup)
+	if response.Latitude == 0 && response.Longitude == 0 {
+		return Location{}, fmt.Errorf("no location for %s", ip)
+	}
+	response.localize(langs)
+	return Location{
+		Query:      query,
+		IP:         ip,
+		Latitude:   response.Latitude,
+		Longitude:  response.Longitude,
+		City:       response.City,
+		Country:    response.Country,
+		CountryISO: response.CountryISO,
+	}, nil
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+// DistanceHandler handles /api/v1/distance requests. The from and to query
+// parameters are addresses or coordinates written as latitude,longitude; from
+// defaults to the address of the client.
+func (s *Server) DistanceHandler(w http.ResponseWriter, r *http.Request) *appError {
+	q := r.URL.Query()
+	to := q.Get("to")
+	if to == "" {
+		err := fmt.Errorf("missing to parameter")
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	from := q.Get("from")
+	if from == "" {
+		ip, err := ipFromRequest(s.IPHeaders, r, false)
+		if err != nil {
+			return badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		from = ip.String()
+	}
+	langs := requestLanguages(r)
+	var response DistanceResponse
+	for _, l := range []struct {
+		query string
+		dst   *Location
+	}{{from, &response.From}, {to, &response.To}} {
+		location, err := s.locate(l.query, langs)
+		if err != nil {
+			return badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		*l.dst = location
+	}
+	km := geo.Distance(response.From.Latitude, response.From.Longitude, response.To.Latitude, response.To.Longitude)
+	response.DistanceKm = round(km, 3)
+	response.DistanceMi = round(km/kmPerMile, 3)
+	response.Bearing = round(geo.Bearing(response.From.Latitude, response.From.Longitude, response.To.Latitude, response.To.Longitude), 2)
+	return writeFormatted(w, r, response)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDistanceHandler(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupBogons = false
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url    string
+		out    string
+		status int
+	}{
+		{"/api/v1/distance?from=1.3.3.7&to=59.9139,10.7522", "{\n  \"from\": {\n    \"query\": \"1.3.3.7\",\n    \"ip\": \"1.3.3.7\",\n    \"latitude\": 63.416667,\n    \"longitude\": 10.416667,\n    \"city\": \"Bornyasherk\",\n    \"country\": \"Elbonia\",\n    \"country_iso\": \"EB\"\n  },\n  \"to\": {\n    \"query\": \"59.9139,10.7522\",\n    \"latitude\": 59.9139,\n    \"longitude\": 10.7522\n  },\n  \"distance_km\": 389.891,\n  \"distance_mi\": 242.267,\n  \"bearing\": 177.25\n}", 200},
+		{"/api/v1/distance?from=1.3.3.7&to=1.1.1.1&fields=distance_km,bearing", "{\n  \"distance_km\": 0,\n  \"bearing\": 0\n}", 200},
+		{"/api/v1/distance?from=1.3.3.7&to=59.9139,10.7522&format=csv&fields=from,distance_mi", "from_query,from_ip,from_latitude,from_longitude,from_city,from_country,from_country_iso,distance_mi\n1.3.3.7,1.3.3.7,63.416667,10.416667,Bornyasherk,Elbonia,EB,242.267\n", 200},
+		{"/api/v1/distance?from=1.3.3.7", "{\n  \"status\": 400,\n  \"error\": \"missing to parameter\"\n}", 400},
+		{"/api/v1/distance?to=1.3.3.7", "{\n  \"status\": 400,\n  \"error\": \"no location for 127.0.0.1\"\n}", 400},
+		{"/api/v1/distance?from=1.3.3.7&to=91,0", "{\n  \"status\": 400,\n  \"error\": \"invalid IP address or coordinates: 91,0\"\n}", 400},
+	}
+	for _, tt := range tests {
+		out, status, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %s, got %d", tt.status, tt.url, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iputil/geo"
+)
+
+// lookups is a set of the expensive operations needed to fill a Response.
+type lookups uint8
+
+const (
+	countryLookup lookups = 1 << iota
+	cityLookup
+	asnLookup
+	hostnameLookup
+	botLookup
+
+	allLookups = countryLookup | cityLookup | asnLookup | hostnameLookup | botLookup
+)
+
+// fieldLookups maps Response fields, by JSON name, to the lookups that
+// provide them. Fields that are not listed are computed from the address
+// alone.
+var fieldLookups = map[string]lookups{
+	"network":                 countryLookup | cityLookup | asnLookup,
+	"country":                 countryLookup,
+	"country_iso":             countryLookup,
+	"country_eu":              countryLookup,
+	"country_geoname_id":      countryLookup,
+	"country_flag":            countryLookup,
+	"country_iso3":            countryLookup,
+	"country_iso_numeric":     countryLookup,
+	"country_capital":         countryLookup,
+	"country_tld":             countryLookup,
+	"currency":                countryLookup,
+	"currency_name":           countryLookup,
+	"currency_symbol":         countryLookup,
+	"calling_code":            countryLookup,
+	"languages":               countryLookup,
+	"continent":               countryLookup,
+	"continent_code":          countryLookup,
+	"registered_country":      countryLookup,
+	"registered_country_iso":  countryLookup,
+	"represented_country":     countryLookup,
+	"represented_country_iso": countryLookup,
+	"region_name":             cityLookup,
+	"region_code":             cityLookup,
+	"subdivisions":            cityLookup,
+	"subdivision_codes":       cityLookup,
+	"metro_code":              cityLookup,
+	"zip_code":                cityLookup,
+	"city":                    cityLookup,
+	"city_geoname_id":         cityLookup,
+	"latitude":                cityLookup,
+	"longitude":               cityLookup,
+	"accuracy_radius":         cityLookup,
+	"time_zone":               cityLookup,
+	"local_time":              cityLookup,
+	"utc_offset":              cityLookup,
+	"time_zone_abbreviation":  cityLookup,
+	"is_dst":                  cityLookup,
+	"next_transition":         cityLookup,
+	"asn":                     asnLookup,
+	"asn_org":                 asnLookup,
+	"hostname":                hostnameLookup,
+	"bot_verified":            botLookup,
+	"bot_name":                botLookup,
+}
+
+// listFields holds the Response fields set from the lists of LookupLists.
+var listFields = map[string]bool{
+	"is_tor_exit":      true,
+	"is_vpn":           true,
+	"is_hosting":       true,
+	"is_blocklisted":   true,
+	"reputation_score": true,
+	"ip_lists":         true,
+}
+
+// cloudFields holds the Response fields set from the ranges of LookupCloud.
+var cloudFields = map[string]bool{
+	"cloud_provider": true,
+	"cloud_region":   true,
+	"cloud_service":  true,
+}
+
+// rirFields holds the Response fields set from the delegations of LookupRIR.
+var rirFields = map[string]bool{
+	"registry":          true,
+	"allocated_country": true,
+	"allocation_date":   true,
+	"allocation_status": true,
+}
+
+// responseFields holds the JSON names of all Response fields, in order.
+var responseFields = jsonFieldNames(reflect.TypeOf(Response{}))
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func isResponseField(name string) bool {
+	for _, f := range responseFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedFields returns the field names given in the fields query parameter,
+// or nil if all fields should be included.
+func selectedFields(r *http.Request) []string {
+	if r.URL == nil {
+		return nil
+	}
+	var names []string
+	for _, v := range r.URL.Query()["fields"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// requestedLookups returns the lookups needed for the fields selected in r.
+func requestedLookups(r *http.Request) (lookups, error) {
+	names := selectedFields(r)
+	if names == nil {
+		return allLookups, nil
+	}
+	var want lookups
+	for _, name := range names {
+		if !isResponseField(name) {
+			return 0, fmt.Errorf("unknown field: %s", name)
+		}
+		want |= fieldLookups[name]
+	}
+	return want, nil
+}
+
+// filterFields keeps the top-level fields named in names, preserving their
+// original order.
+func filterFields(fields []field, names []string) []field {
+	var filtered []field
+	for _, f := range fields {
+		for _, name := range names {
+			if f.Key == name {
+				filtered = append(filtered, f)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// cliFields returns the Response fields that are served as plain text by
+// /{field} and /api/v1/{field}. Fields that depend on a disabled lookup are
+// left out. Fields of the geo databases are always included, as databases
+// may be loaded after the routes are registered.
+func (s *Server) cliFields() []string {
+	var names []string
+	for _, name := range responseFields {
+		want := fieldLookups[name]
+		switch {
+		case name == "ip" || name == "user_agent" || name == "sources" || name == "tags":
+			// Served by CLIHandler, not part of the lookup and not plain text
+			// respectively
+			continue
+		case want&hostnameLookup != 0 && s.LookupAddr == nil:
+			continue
+		case want&botLookup != 0 && s.LookupBot == nil:
+			continue
+		case listFields[name] && s.LookupLists == nil:
+			continue
+		case cloudFields[name] && s.LookupCloud == nil:
+			continue
+		case rirFields[name] && s.LookupRIR == nil:
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// fieldPath returns the URL path segment for a field, e.g. country-iso for
+// country_iso.
+func fieldPath(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// fieldValue returns the plain text representation of the named field of v,
+// or an empty string if the field is not set.
+func fieldValue(v interface{}, name string) (string, error) {
+	fields, err := toFields(v)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fields {
+		if f.Key == name {
+			return scalarString(f.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// Response fields for the geo fields reported in the Sources of geo results
+var (
+	countrySourceFields = map[string][]string{
+		"Name":               {"country"},
+		"ISO":                {"country_iso"},
+		"IsEU":               {"country_eu"},
+		"GeoNameID":          {"country_geoname_id"},
+		"Continent":          {"continent", "continent_code"},
+		"RegisteredCountry":  {"registered_country", "registered_country_iso"},
+		"RepresentedCountry": {"represented_country", "represented_country_iso"},
+	}
+	citySourceFields = map[string][]string{
+		"Name":           {"city"},
+		"GeoNameID":      {"city_geoname_id"},
+		"RegionName":     {"region_name"},
+		"RegionCode":     {"region_code"},
+		"Subdivisions":   {"subdivisions", "subdivision_codes"},
+		"MetroCode":      {"metro_code"},
+		"PostalCode":     {"zip_code"},
+		"Latitude":       {"latitude"},
+		"Longitude":      {"longitude"},
+		"AccuracyRadius": {"accuracy_radius"},
+		"Timezone":       {"time_zone"},
+	}
+	asnSourceFields = map[string][]string{
+		"AutonomousSystemNumber":       {"asn"},
+		"AutonomousSystemOrganization": {"asn_org"},
+	}
+)
+
+// geoSources maps Response fields to the geo source that supplied them, or
+// returns nil if the geo reader does not report sources.
+func geoSources(country geo.Country, city geo.City, asn geo.ASN) map[string]string {
+	sources := make(map[string]string)
+	for _, s := range []struct {
+		sources map[string]string
+		fields  map[string][]string
+	}{
+		{country.Sources, countrySourceFields},
+		{city.Sources, citySourceFields},
+		{asn.Sources, asnSourceFields},
+	} {
+		for field, source := range s.sources {
+			for _, name := range s.fields[field] {
+				sources[name] = source
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	return sources
+}
+
+// responseSources returns the part of sources that should be included in the
+// response to r: nothing unless requested with sources=true or by selecting
+// the sources field, and only the selected fields if there is a selection.
+func responseSources(r *http.Request, sources map[string]string) map[string]string {
+	if !wantSources(r) {
+		return nil
+	}
+	names := selectedFields(r)
+	if names == nil {
+		return sources
+	}
+	selected := make(map[string]string)
+	for _, name := range names {
+		if source, ok := sources[name]; ok {
+			selected[name] = source
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	return selected
+}
+
+// wantSources reports whether responses to r should include the sources of
+// their geo fields.
+func wantSources(r *http.Request) bool {
+	if r.URL == nil {
+		return false
+	}
+	if v, err := strconv.ParseBool(r.URL.Query().Get("sources")); err == nil && v {
+		return true
+	}
+	for _, name := range selectedFields(r) {
+		if name == "sources" {
+			return true
+		}
+	}
+	return false
+}
+
+// wantOptional reports whether responses to r should include a group of
+// optional fields, requested with the boolean query parameter param or by
+// selecting one of fields.
+func wantOptional(r *http.Request, param string, fields map[string]bool) bool {
+	if r.URL == nil {
+		return false
+	}
+	if v, err := strconv.ParseBool(r.URL.Query().Get(param)); err == nil && v {
+		return true
+	}
+	for _, name := range selectedFields(r) {
+		if fields[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apimgr/echoip/src/iputil/geo"
+)
+
+// countingDb records which databases were consulted.
+type countingDb struct {
+	testDb
+	countries, cities, asns int
+}
+
+func (t *countingDb) Country(ip net.IP) (geo.Country, error) {
+	t.countries++
+	return t.testDb.Country(ip)
+}
+
+func (t *countingDb) City(ip net.IP) (geo.City, error) {
+	t.cities++
+	return t.testDb.City(ip)
+}
+
+func (t *countingDb) ASN(ip net.IP) (geo.ASN, error) {
+	t.asns++
+	return t.testDb.ASN(ip)
+}
+
+func TestFieldSelection(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	var tests = []struct {
+		url                     string
+		out                     string
+		status                  int
+		countries, cities, asns int
+		hostnames               int
+	}{
+		{"/json?fields=ip,country_iso,asn", "{\n  \"ip\": \"127.0.0.1\",\n  \"country_iso\": \"EB\",\n  \"asn\": \"AS59795\"\n}", 200, 1, 0, 1, 0},
+		{"/1.3.3.7?fields=asn_org,ip", "{\n  \"ip\": \"1.3.3.7\",\n  \"asn_org\": \"Hosting4Real\"\n}", 200, 0, 0, 1, 0},
+		{"/api/v1/ip/1.3.3.7?fields=hostname&format=sh", "ECHOIP_HOSTNAME='localhost'\n", 200, 0, 0, 0, 1},
+		{"/json?fields=user_agent", "{\n  \"user_agent\": {\n    \"product\": \"curl\",\n    \"version\": \"7.2.6.0\",\n    \"raw_value\": \"curl/7.2.6.0\"\n  }\n}", 200, 0, 0, 0, 0},
+		{"/json?fields=city&fields=time_zone", "{\n  \"city\": \"Bornyasherk\",\n  \"time_zone\": \"Europe/Bornyasherk\"\n}", 200, 0, 1, 0, 0},
+		{"/json?fields=ip,foo", "{\n  \"status\": 400,\n  \"error\": \"unknown field: foo\"\n}", 400, 0, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		db := &countingDb{}
+		hostnames := 0
+		srv := testServer()
+		srv.gr = db
+		srv.LookupAddr = func(ip net.IP) (string, error) {
+			hostnames++
+			return lookupAddr(ip)
+		}
+		s := httptest.NewServer(srv.Handler())
+		out, status, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %s, got %d", tt.status, tt.url, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+		if db.countries != tt.countries || db.cities != tt.cities || db.asns != tt.asns || hostnames != tt.hostnames {
+			t.Errorf("Expected %d/%d/%d/%d country/city/asn/hostname lookups for %s, got %d/%d/%d/%d", tt.countries, tt.cities, tt.asns, tt.hostnames, tt.url, db.countries, db.cities, db.asns, hostnames)
+		}
+	}
+}
+
+func TestFieldLookupsAreResponseFields(t *testing.T) {
+	for name := range fieldLookups {
+		if !isResponseField(name) {
+			t.Errorf("%s is not a Response field", name)
+		}
+	}
+}
+
+func TestGeoSources(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = geo.Merge(
+		[]geo.Source{{Name: "free", Reader: &testDb{}}},
+		[]geo.Source{{Name: "commercial", Reader: &testDb{}}},
+		[]geo.Source{{Name: "asn", Reader: &testDb{}}},
+	)
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	withSources := "{\n  \"country\": \"Elbonia\",\n  \"asn\": \"AS59795\",\n  \"sources\": {\n    \"asn\": \"asn\",\n    \"country\": \"free\"\n  }\n}"
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/json?fields=country,asn", "{\n  \"country\": \"Elbonia\",\n  \"asn\": \"AS59795\"\n}"},
+		{"/json?fields=country,asn&sources=true", withSources},
+		{"/1.3.3.7?fields=country,asn,sources", withSources},
+		{"/json?fields=city,time_zone,sources&format=yaml", "city: \"Bornyasherk\"\ntime_zone: \"Europe/Bornyasherk\"\nsources:\n  city: \"commercial\"\n  time_zone: \"commercial\"\n"},
+		{"/json?fields=sources", "{}"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	xmlMediaType  = "application/xml"
+	yamlMediaType = "application/yaml"
+	csvMediaType  = "text/csv"
+	tomlMediaType = "application/toml"
+	shMediaType   = "text/x-shellscript"
+)
+
+// format renders a response body in a particular media type.
+type format struct {
+	name        string
+	mediaType   string
+	aliases     []string
+	encode      func(io.Writer, []field) error
+	contentType string
+}
+
+var formats = []*format{
+	{name: "json", mediaType: jsonMediaType, contentType: jsonMediaType},
+	{name: "xml", mediaType: xmlMediaType, aliases: []string{"text/xml"}, encode: encodeXML, contentType: xmlMediaType},
+	{name: "yaml", mediaType: yamlMediaType, aliases: []string{"application/x-yaml", "text/yaml", "text/x-yaml"}, encode: encodeYAML, contentType: yamlMediaType},
+	{name: "csv", mediaType: csvMediaType, encode: encodeCSV, contentType: csvMediaType},
+	{name: "toml", mediaType: tomlMediaType, encode: encodeTOML, contentType: tomlMediaType},
+	{name: "sh", mediaType: shMediaType, aliases: []string{"application/x-sh"}, encode: encodeShell, contentType: textMediaType},
+}
+
+var jsonFormat = formats[0]
+
+func formatByName(name string) *format {
+	for _, f := range formats {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func formatByMediaType(mediaType string) *format {
+	for _, f := range formats {
+		if f.mediaType == mediaType {
+			return f
+		}
+		for _, alias := range f.aliases {
+			if alias == mediaType {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// acceptedFormat returns the format preferred by the Accept header, or nil
+// if the most preferred media types are not formats we know. Only the media
+// types sharing the highest quality value are considered, so that browsers
+// listing application/xml as a fallback still get the default format.
+func acceptedFormat(accept string) *format {
+	ranges := qualityValues(accept)
+	for _, mr := range ranges {
+		if mr.q < ranges[0].q || mr.q <= 0 {
+			break
+		}
+		if f := formatByMediaType(mr.value); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// responseFormat selects the format for r from the format query parameter
+// or the Accept header, defaulting to JSON.
+func responseFormat(r *http.Request) (*format, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		if f := formatByName(strings.ToLower(name)); f != nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("unsupported format: %s", name)
+	}
+	if f := acceptedFormat(r.Header.Get("Accept")); f != nil {
+		return f, nil
+	}
+	return jsonFormat, nil
+}
+
+// formatMatcher matches requests asking for a structured format other than
+// JSON, which has its own route.
+func formatMatcher(r *http.Request) bool {
+	if r.URL.Query().Get("format") != "" {
+		return true
+	}
+	f := acceptedFormat(r.Header.Get("Accept"))
+	return f != nil && f != jsonFormat
+}
+
+// writeFormatted writes v in the format requested by r, limited to the fields
+// selected by the fields query parameter.
+func writeFormatted(w http.ResponseWriter, r *http.Request, v interface{}) *appError {
+	f, err := responseFormat(r)
+	if err != nil {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	names := selectedFields(r)
+	if names != nil && wantSources(r) {
+		names = append(names, "sources")
+	}
+	var b []byte
+	if f.encode == nil && names == nil {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		var fields []field
+		fields, err = toFields(v)
+		if err == nil {
+			if names != nil {
+				fields = filterFields(fields, names)
+			}
+			encode := f.encode
+			if encode == nil {
+				encode = encodeJSON
+			}
+			var buf bytes.Buffer
+			err = encode(&buf, fields)
+			b = buf.Bytes()
+		}
+	}
+	if err != nil {
+		return internalServerError(err).AsJSON()
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Write(b)
+	return nil
+}
+
+// field is a key and value of an object in the order of its JSON encoding.
+// Value is a string, json.Number, bool, nil, a nested []field or an
+// []interface{} of scalar values.
+type field struct {
+	Key   string
+	Value interface{}
+}
+
+// toFields converts v to an ordered list of fields using its JSON encoding,
+// so that field names and omitempty behave the same for every format.
+func toFields(v interface{}) ([]field, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return decodeObject(dec)
+}
+
+func decodeObject(dec *json.Decoder) ([]field, error) {
+	var fields []field
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v", t)
+		}
+		value, err := decodeValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field{key, value})
+	}
+	_, err := dec.Token()
+	return fields, err
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case json.Delim:
+		if t == '{' {
+			return decodeObject(dec)
+		}
+		values := []interface{}{}
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		_, err := dec.Token()
+		return values, err
+	default:
+		return t, nil
+	}
+}
+
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		// Arrays are rendered as a comma separated list of their values in
+		// formats without arrays
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = scalarString(value)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// flatten joins nested keys with an underscore.
+func flatten(prefix string, fields []field) []field {
+	var flat []field
+	for _, f := range fields {
+		key := f.Key
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := f.Value.([]field); ok {
+			flat = append(flat, flatten(key, nested)...)
+			continue
+		}
+		flat = append(flat, field{key, f.Value})
+	}
+	return flat
+}
+
+// encodeJSON writes fields as indented JSON, matching json.MarshalIndent.
+func encodeJSON(w io.Writer, fields []field) error {
+	var compact bytes.Buffer
+	if err := writeJSONObject(&compact, fields); err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	_, err := indented.WriteTo(w)
+	return err
+}
+
+func writeJSONObject(buf *bytes.Buffer, fields []field) error {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		if nested, ok := f.Value.([]field); ok {
+			if err := writeJSONObject(buf, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func encodeXML(w io.Writer, fields []field) error {
+	io.WriteString(w, xml.Header)
+	io.WriteString(w, "<response>\n")
+	if err := writeXMLFields(w, fields, "  "); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</response>\n")
+	return err
+}
+
+// xmlName matches keys that can be used as element names as they are.
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// xmlTags returns the start and end tag of an element for key. Keys that are
+// not valid element names, such as those of tags, are written as the name
+// attribute of a tag element.
+func xmlTags(key string) (string, string) {
+	if xmlName.MatchString(key) {
+		return "<" + key + ">", "</" + key + ">"
+	}
+	var name bytes.Buffer
+	xml.EscapeText(&name, []byte(key))
+	return `<tag name="` + name.String() + `">`, "</tag>"
+}
+
+func writeXMLFields(w io.Writer, fields []field, indent string) error {
+	for _, f := range fields {
+		start, end := xmlTags(f.Key)
+		if nested, ok := f.Value.([]field); ok {
+			fmt.Fprintf(w, "%s%s\n", indent, start)
+			if err := writeXMLFields(w, nested, indent+"  "); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s%s\n", indent, end)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s", indent, start)
+		if err := xml.EscapeText(w, []byte(scalarString(f.Value))); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", end)
+	}
+	return nil
+}
+
+func encodeYAML(w io.Writer, fields []field) error {
+	writeYAMLFields(w, fields, "")
+	return nil
+}
+
+func writeYAMLFields(w io.Writer, fields []field, indent string) {
+	for _, f := range fields {
+		if nested, ok := f.Value.([]field); ok {
+			fmt.Fprintf(w, "%s%s:\n", indent, yamlKey(f.Key))
+			writeYAMLFields(w, nested, indent+"  ")
+			continue
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", indent, yamlKey(f.Key), yamlScalar(f.Value))
+	}
+}
+
+// bareKey matches keys that need no quoting in YAML and TOML.
+var bareKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// yamlReserved matches plain scalars that YAML 1.1 reads as booleans or null
+// rather than strings.
+var yamlReserved = regexp.MustCompile(`^(?i:y|yes|n|no|true|false|on|off|null)$`)
+
+func yamlKey(key string) string {
+	if bareKey.MatchString(key) && !yamlReserved.MatchString(key) {
+		return key
+	}
+	return yamlScalar(key)
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		// Double quoted YAML strings use the same escapes as JSON
+		b, _ := json.Marshal(v)
+		return string(b)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = yamlScalar(value)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return scalarString(v)
+}
+
+func encodeTOML(w io.Writer, fields []field) error {
+	writeTOMLTable(w, "", fields)
+	return nil
+}
+
+func writeTOMLTable(w io.Writer, name string, fields []field) {
+	var tables []field
+	for _, f := range fields {
+		if nested, ok := f.Value.([]field); ok {
+			tables = append(tables, field{f.Key, nested})
+			continue
+		}
+		if f.Value == nil {
+			// TOML has no null value
+			continue
+		}
+		fmt.Fprintf(w, "%s = %s\n", tomlKey(f.Key), tomlScalar(f.Value))
+	}
+	for _, t := range tables {
+		key := tomlKey(t.Key)
+		if name != "" {
+			key = name + "." + key
+		}
+		fmt.Fprintf(w, "\n[%s]\n", key)
+		writeTOMLTable(w, key, t.Value.([]field))
+	}
+}
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return tomlScalar(key)
+}
+
+func tomlScalar(v interface{}) string {
+	if n, ok := v.(json.Number); ok {
+		// TOML integers are limited to 64 bits, which excludes decimal IPv6
+		// addresses
+		if _, err := n.Int64(); err == nil {
+			return n.String()
+		}
+		if _, err := n.Float64(); err == nil && strings.ContainsAny(n.String(), ".eE") {
+			return n.String()
+		}
+		return strconv.Quote(n.String())
+	}
+	switch v := v.(type) {
+	case string:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = tomlScalar(value)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return scalarString(v)
+}
+
+func encodeCSV(w io.Writer, fields []field) error {
+	flat := flatten("", fields)
+	header := make([]string, len(flat))
+	row := make([]string, len(flat))
+	for i, f := range flat {
+		header[i] = f.Key
+		row[i] = scalarString(f.Value)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.Write(row)
+	cw.Flush()
+	return cw.Error()
+}
+
+// shellPrefix keeps the variables of shell output from overriding variables
+// such as HOSTNAME or PATH when they are evaluated.
+const shellPrefix = "ECHOIP_"
+
+// encodeShell writes ECHOIP_KEY='value' lines suitable for eval in a POSIX
+// shell.
+func encodeShell(w io.Writer, fields []field) error {
+	for _, f := range flatten("", fields) {
+		name := shellName(f.Key)
+		if name == "" {
+			continue
+		}
+		value := strings.ReplaceAll(scalarString(f.Value), "'", `'\''`)
+		fmt.Fprintf(w, "%s%s='%s'\n", shellPrefix, name, value)
+	}
+	return nil
+}
+
+// shellName converts key to the part of a variable name following
+// shellPrefix by dropping the characters that are not allowed in one. It
+// returns an empty name if none is left.
+func shellName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return -1
+	}, key)
+	return name
+}
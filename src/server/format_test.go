@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptedFormat(t *testing.T) {
+	browserAccept := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"*/*", ""},
+		{jsonMediaType, "json"},
+		{"text/xml", "xml"},
+		{"application/x-yaml; charset=utf-8", "yaml"},
+		{"text/csv;q=0.5, application/toml", "toml"},
+		{"text/html, text/csv", "csv"},
+		{browserAccept, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if f := acceptedFormat(tt.in); f != nil {
+			got = f.name
+		}
+		if got != tt.out {
+			t.Errorf("Expected %q, got %q for %q", tt.out, got, tt.in)
+		}
+	}
+}
+
+func TestFormatHandlers(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = &networkDb{}
+	s := httptest.NewServer(srv.Handler())
+
+	var tests = []struct {
+		url             string
+		acceptMediaType string
+		out             string
+		status          int
+	}{
+		{s.URL + "/?format=sh", "", "ECHOIP_IP='127.0.0.1'\nECHOIP_IP_DECIMAL='2130706433'\nECHOIP_IP_HEX='0x7f000001'\nECHOIP_IP_OCTAL='017700000001'\nECHOIP_IP_BINARY='01111111.00000000.00000000.00000001'\nECHOIP_IP_DOTTED_OCTAL='0177.0000.0000.0001'\nECHOIP_REVERSE_POINTER='1.0.0.127.in-addr.arpa'\nECHOIP_IP_VERSION='4'\nECHOIP_CATEGORY='loopback'\nECHOIP_IS_PRIVATE='false'\nECHOIP_IS_BOGON='true'\nECHOIP_NETWORK='127.0.0.0/24'\nECHOIP_COUNTRY='Elbonia'\nECHOIP_COUNTRY_ISO='EB'\nECHOIP_COUNTRY_EU='false'\nECHOIP_REGION_NAME='North Elbonia'\nECHOIP_REGION_CODE='1234'\nECHOIP_METRO_CODE='1234'\nECHOIP_ZIP_CODE='1234'\nECHOIP_CITY='Bornyasherk'\nECHOIP_LATITUDE='63.416667'\nECHOIP_LONGITUDE='10.416667'\nECHOIP_TIME_ZONE='Europe/Bornyasherk'\nECHOIP_ASN='AS59795'\nECHOIP_ASN_ORG='Hosting4Real'\nECHOIP_HOSTNAME='localhost'\nECHOIP_USER_AGENT_PRODUCT='curl'\nECHOIP_USER_AGENT_VERSION='7.2.6.0'\nECHOIP_USER_AGENT_RAW_VALUE='curl/7.2.6.0'\n", 200},
+		{s.URL + "/1.3.3.7", csvMediaType, "ip,ip_decimal,ip_hex,ip_octal,ip_binary,ip_dotted_octal,reverse_pointer,ip_version,category,is_private,is_bogon,network,country,country_iso,country_eu,region_name,region_code,metro_code,zip_code,city,latitude,longitude,time_zone,asn,asn_org,hostname\n1.3.3.7,16974599,0x01030307,0100601407,00000001.00000011.00000011.00000111,0001.0003.0003.0007,7.3.3.1.in-addr.arpa,4,public,false,false,127.0.0.0/24,Elbonia,EB,false,North Elbonia,1234,1234,1234,Bornyasherk,63.416667,10.416667,Europe/Bornyasherk,AS59795,Hosting4Real,localhost\n", 200},
+		{s.URL + "/json", "application/yaml", "ip: \"127.0.0.1\"\nip_decimal: 2130706433\nip_hex: \"0x7f000001\"\nip_octal: \"017700000001\"\nip_binary: \"01111111.00000000.00000000.00000001\"\nip_dotted_octal: \"0177.0000.0000.0001\"\nreverse_pointer: \"1.0.0.127.in-addr.arpa\"\nip_version: 4\ncategory: \"loopback\"\nis_private: false\nis_bogon: true\nnetwork: \"127.0.0.0/24\"\ncountry: \"Elbonia\"\ncountry_iso: \"EB\"\ncountry_eu: false\nregion_name: \"North Elbonia\"\nregion_code: \"1234\"\nmetro_code: 1234\nzip_code: \"1234\"\ncity: \"Bornyasherk\"\nlatitude: 63.416667\nlongitude: 10.416667\ntime_zone: \"Europe/Bornyasherk\"\nasn: \"AS59795\"\nasn_org: \"Hosting4Real\"\nhostname: \"localhost\"\nuser_agent:\n  product: \"curl\"\n  version: \"7.2.6.0\"\n  raw_value: \"curl/7.2.6.0\"\n", 200},
+		{s.URL + "/api/v1/ip/::1?format=toml", "", "ip = \"::1\"\nip_decimal = 1\nip_hex = \"0x00000000000000000000000000000001\"\nip_octal = \"01\"\nip_binary = \"0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000001\"\nreverse_pointer = \"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa\"\nip_version = 6\ncategory = \"loopback\"\nis_private = false\nis_bogon = true\nnetwork = \"127.0.0.0/24\"\ncountry = \"Elbonia\"\ncountry_iso = \"EB\"\ncountry_eu = false\nregion_name = \"North Elbonia\"\nregion_code = \"1234\"\nmetro_code = 1234\nzip_code = \"1234\"\ncity = \"Bornyasherk\"\nlatitude = 63.416667\nlongitude = 10.416667\ntime_zone = \"Europe/Bornyasherk\"\nasn = \"AS59795\"\nasn_org = \"Hosting4Real\"\nhostname = \"localhost\"\n\n[user_agent]\nproduct = \"curl\"\nversion = \"7.2.6.0\"\nraw_value = \"curl/7.2.6.0\"\n", 200},
+		{s.URL + "/8000::?format=toml", "", "ip = \"8000::\"\nip_decimal = \"170141183460469231731687303715884105728\"\nip_hex = \"0x80000000000000000000000000000000\"\nip_octal = \"02000000000000000000000000000000000000000000\"\nip_binary = \"1000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000\"\nreverse_pointer = \"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.ip6.arpa\"\nip_version = 6\ncategory = \"reserved\"\nis_private = false\nis_bogon = true\nnetwork = \"127.0.0.0/24\"\ncountry = \"Elbonia\"\ncountry_iso = \"EB\"\ncountry_eu = false\nregion_name = \"North Elbonia\"\nregion_code = \"1234\"\nmetro_code = 1234\nzip_code = \"1234\"\ncity = \"Bornyasherk\"\nlatitude = 63.416667\nlongitude = 10.416667\ntime_zone = \"Europe/Bornyasherk\"\nasn = \"AS59795\"\nasn_org = \"Hosting4Real\"\nhostname = \"localhost\"\n", 200},
+		{s.URL + "/1.3.3.7", "text/xml", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<response>\n  <ip>1.3.3.7</ip>\n  <ip_decimal>16974599</ip_decimal>\n  <ip_hex>0x01030307</ip_hex>\n  <ip_octal>0100601407</ip_octal>\n  <ip_binary>00000001.00000011.00000011.00000111</ip_binary>\n  <ip_dotted_octal>0001.0003.0003.0007</ip_dotted_octal>\n  <reverse_pointer>7.3.3.1.in-addr.arpa</reverse_pointer>\n  <ip_version>4</ip_version>\n  <category>public</category>\n  <is_private>false</is_private>\n  <is_bogon>false</is_bogon>\n  <network>127.0.0.0/24</network>\n  <country>Elbonia</country>\n  <country_iso>EB</country_iso>\n  <country_eu>false</country_eu>\n  <region_name>North Elbonia</region_name>\n  <region_code>1234</region_code>\n  <metro_code>1234</metro_code>\n  <zip_code>1234</zip_code>\n  <city>Bornyasherk</city>\n  <latitude>63.416667</latitude>\n  <longitude>10.416667</longitude>\n  <time_zone>Europe/Bornyasherk</time_zone>\n  <asn>AS59795</asn>\n  <asn_org>Hosting4Real</asn_org>\n  <hostname>localhost</hostname>\n</response>\n", 200},
+		{s.URL + "/?format=foo", "", "{\n  \"status\": 400,\n  \"error\": \"unsupported format: foo\"\n}", 400},
+	}
+
+	for _, tt := range tests {
+		out, status, err := httpGet(tt.url, tt.acceptMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %s, got %d", tt.status, tt.url, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestShellQuoting(t *testing.T) {
+	r := Response{City: "Val d'Or"}
+	fields, err := toFields(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := encodeShell(&out, fields); err != nil {
+		t.Fatal(err)
+	}
+	want := "ECHOIP_IP=''\nECHOIP_IP_DECIMAL=''\nECHOIP_IP_VERSION='0'\nECHOIP_CATEGORY=''\nECHOIP_IS_PRIVATE='false'\nECHOIP_IS_BOGON='false'\nECHOIP_CITY='Val d'\\''Or'\n"
+	if out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+}
+
+func TestHostileKeys(t *testing.T) {
+	r := Response{Tags: map[string]string{"$(id)": "a", "a b": "b", "x></tag><y": "c"}}
+	fields, err := toFields(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		encode func(io.Writer, []field) error
+		want   string
+	}{
+		{encodeShell, "ECHOIP_TAGS_ID='a'\nECHOIP_TAGS_AB='b'\nECHOIP_TAGS_XTAGY='c'\n"},
+		{encodeXML, "  <tags>\n    <tag name=\"$(id)\">a</tag>\n    <tag name=\"a b\">b</tag>\n    <tag name=\"x&gt;&lt;/tag&gt;&lt;y\">c</tag>\n  </tags>\n</response>\n"},
+		{encodeYAML, "tags:\n  \"$(id)\": \"a\"\n  \"a b\": \"b\"\n  \"x\\u003e\\u003c/tag\\u003e\\u003cy\": \"c\"\n"},
+		{encodeTOML, "[tags]\n\"$(id)\" = \"a\"\n\"a b\" = \"b\"\n\"x\\u003e\\u003c/tag\\u003e\\u003cy\" = \"c\"\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := tt.encode(&out, fields); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(out.String(), tt.want) {
+			t.Errorf("Expected output ending in %q, got %q", tt.want, out.String())
+		}
+	}
+}
+
+func TestYAMLReservedWords(t *testing.T) {
+	r := Response{Tags: map[string]string{"No": "off", "null": "~", "on": "yes", "only": "y"}}
+	fields, err := toFields(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := encodeYAML(&out, fields); err != nil {
+		t.Fatal(err)
+	}
+	want := "tags:\n  \"No\": \"off\"\n  \"null\": \"~\"\n  \"on\": \"yes\"\n  only: \"y\"\n"
+	if !strings.HasSuffix(out.String(), want) {
+		t.Errorf("Expected output ending in %q, got %q", want, out.String())
+	}
+}
@@ -11,14 +11,20 @@
 
 	"net/http/pprof"
 
+	"github.com/apimgr/echoip/src/cloud"
+	"github.com/apimgr/echoip/src/iplist"
 	"github.com/apimgr/echoip/src/iputil"
 	"github.com/apimgr/echoip/src/iputil/geo"
+	"github.com/apimgr/echoip/src/overrides"
+	"github.com/apimgr/echoip/src/rir"
 	"github.com/apimgr/echoip/src/useragent"
 
+	"math"
 	"math/big"
 	"net"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 const (
@@ -27,34 +33,141 @@
 )
 
 type Server struct {
-	Template   string
-	IPHeaders  []string
-	LookupAddr func(net.IP) (string, error)
-	LookupPort func(net.IP, uint64) error
-	cache      *Cache
-	gr         geo.Reader
-	profile    bool
-	Sponsor    bool
+	Template       string
+	IPHeaders      []string
+	LookupAddr     func(net.IP) (string, error)
+	LookupPort     func(net.IP, uint64) error
+	LookupOverride func(net.IP) (overrides.Override, bool)
+	LookupLists    func(net.IP) []iplist.Match
+	LookupCloud    func(net.IP) (cloud.Range, bool)
+	LookupBot      func(net.IP, string) (string, bool)
+	LookupRIR      func(net.IP) (rir.Delegation, bool)
+	LookupBogons   bool
+	BatchLimit     int
+	cache          *Cache
+	clock          func() time.Time
+	gr             geo.Reader
+	profile        bool
+	Sponsor        bool
 }
 
 type Response struct {
-	IP         net.IP               `json:"ip"`
-	IPDecimal  *big.Int             `json:"ip_decimal"`
-	Country    string               `json:"country,omitempty"`
-	CountryISO string               `json:"country_iso,omitempty"`
-	CountryEU  *bool                `json:"country_eu,omitempty"`
-	RegionName string               `json:"region_name,omitempty"`
-	RegionCode string               `json:"region_code,omitempty"`
-	MetroCode  uint                 `json:"metro_code,omitempty"`
-	PostalCode string               `json:"zip_code,omitempty"`
-	City       string               `json:"city,omitempty"`
-	Latitude   float64              `json:"latitude,omitempty"`
-	Longitude  float64              `json:"longitude,omitempty"`
-	Timezone   string               `json:"time_zone,omitempty"`
-	ASN        string               `json:"asn,omitempty"`
-	ASNOrg     string               `json:"asn_org,omitempty"`
-	Hostname   string               `json:"hostname,omitempty"`
-	UserAgent  *useragent.UserAgent `json:"user_agent,omitempty"`
+	IP                    net.IP               `json:"ip"`
+	IPDecimal             *big.Int             `json:"ip_decimal"`
+	IPHex                 string               `json:"ip_hex,omitempty"`
+	IPOctal               string               `json:"ip_octal,omitempty"`
+	IPBinary              string               `json:"ip_binary,omitempty"`
+	IPDottedOctal         string               `json:"ip_dotted_octal,omitempty"`
+	ReversePointer        string               `json:"reverse_pointer,omitempty"`
+	IPVersion             int                  `json:"ip_version"`
+	Category              string               `json:"category"`
+	IsPrivate             bool                 `json:"is_private"`
+	IsBogon               bool                 `json:"is_bogon"`
+	IsTorExit             *bool                `json:"is_tor_exit,omitempty"`
+	IsVPN                 *bool                `json:"is_vpn,omitempty"`
+	IsHosting             *bool                `json:"is_hosting,omitempty"`
+	IsBlocklisted         *bool                `json:"is_blocklisted,omitempty"`
+	ReputationScore       *int                 `json:"reputation_score,omitempty"`
+	IPLists               []string             `json:"ip_lists,omitempty"`
+	CloudProvider         string               `json:"cloud_provider,omitempty"`
+	CloudRegion           string               `json:"cloud_region,omitempty"`
+	CloudService          string               `json:"cloud_service,omitempty"`
+	IPv6Transition        string               `json:"ipv6_transition,omitempty"`
+	EmbeddedIPv4          string               `json:"embedded_ipv4,omitempty"`
+	TeredoServer          string               `json:"teredo_server,omitempty"`
+	TeredoPort            uint16               `json:"teredo_port,omitempty"`
+	MAC                   string               `json:"mac,omitempty"`
+	MACVendor             string               `json:"mac_vendor,omitempty"`
+	PrivacyAddress        bool                 `json:"privacy_address,omitempty"`
+	Network               string               `json:"network,omitempty"`
+	Country               string               `json:"country,omitempty"`
+	CountryISO            string               `json:"country_iso,omitempty"`
+	CountryEU             *bool                `json:"country_eu,omitempty"`
+	CountryGeoNameID      uint                 `json:"country_geoname_id,omitempty"`
+	CountryFlag           string               `json:"country_flag,omitempty"`
+	CountryISO3           string               `json:"country_iso3,omitempty"`
+	CountryNumeric        string               `json:"country_iso_numeric,omitempty"`
+	CountryCapital        string               `json:"country_capital,omitempty"`
+	CountryTLD            string               `json:"country_tld,omitempty"`
+	Currency              string               `json:"currency,omitempty"`
+	CurrencyName          string               `json:"currency_name,omitempty"`
+	CurrencySymbol        string               `json:"currency_symbol,omitempty"`
+	CallingCode           string               `json:"calling_code,omitempty"`
+	Languages             []string             `json:"languages,omitempty"`
+	Continent             string               `json:"continent,omitempty"`
+	ContinentCode         string               `json:"continent_code,omitempty"`
+	RegisteredCountry     string               `json:"registered_country,omitempty"`
+	RegisteredCountryISO  string               `json:"registered_country_iso,omitempty"`
+	RepresentedCountry    string               `json:"represented_country,omitempty"`
+	RepresentedCountryISO string               `json:"represented_country_iso,omitempty"`
+	RegionName            string               `json:"region_name,omitempty"`
+	RegionCode            string               `json:"region_code,omitempty"`
+	Subdivisions          []string             `json:"subdivisions,omitempty"`
+	SubdivisionCodes      []string             `json:"subdivision_codes,omitempty"`
+	MetroCode             uint                 `json:"metro_code,omitempty"`
+	PostalCode            string               `json:"zip_code,omitempty"`
+	City                  string               `json:"city,omitempty"`
+	CityGeoNameID         uint                 `json:"city_geoname_id,omitempty"`
+	Latitude              float64              `json:"latitude,omitempty"`
+	Longitude             float64              `json:"longitude,omitempty"`
+	AccuracyRadius        uint                 `json:"accuracy_radius,omitempty"`
+	Timezone              string               `json:"time_zone,omitempty"`
+	LocalTime             string               `json:"local_time,omitempty"`
+	UTCOffset             string               `json:"utc_offset,omitempty"`
+	TimezoneAbbreviation  string               `json:"time_zone_abbreviation,omitempty"`
+	IsDST                 *bool                `json:"is_dst,omitempty"`
+	NextTransition        string               `json:"next_transition,omitempty"`
+	ASN                   string               `json:"asn,omitempty"`
+	ASNOrg                string               `json:"asn_org,omitempty"`
+	Registry              string               `json:"registry,omitempty"`
+	AllocatedCountry      string               `json:"allocated_country,omitempty"`
+	AllocationDate        string               `json:"allocation_date,omitempty"`
+	AllocationStatus      string               `json:"allocation_status,omitempty"`
+	Hostname              string               `json:"hostname,omitempty"`
+	BotVerified           *bool                `json:"bot_verified,omitempty"`
+	BotName               string               `json:"bot_name,omitempty"`
+	Tags                  map[string]string    `json:"tags,omitempty"`
+	Sources               map[string]string    `json:"sources,omitempty"`
+	UserAgent             *useragent.UserAgent `json:"user_agent,omitempty"`
+
+	// names holds the localized names of the geo fields
+	names localizedNames
+	// lookups are the lookups the response was built with
+	lookups lookups
+}
+
+// localizedNames maps language codes to names for the Response fields of
+// place names.
+type localizedNames struct {
+	country            map[string]string
+	continent          map[string]string
+	registeredCountry  map[string]string
+	representedCountry map[string]string
+	region             map[string]string
+	city               map[string]string
+	subdivisions       []map[string]string
+}
+
+// localize replaces the place names of r with their translation to the first
+// of langs that is available. Names that have no translation stay English.
+func (r *Response) localize(langs []string) {
+	if len(langs) == 0 {
+		return
+	}
+	r.Country = localName(r.names.country, r.Country, langs)
+	r.Continent = localName(r.names.continent, r.Continent, langs)
+	r.RegisteredCountry = localName(r.names.registeredCountry, r.RegisteredCountry, langs)
+	r.RepresentedCountry = localName(r.names.representedCountry, r.RepresentedCountry, langs)
+	r.RegionName = localName(r.names.region, r.RegionName, langs)
+	r.City = localName(r.names.city, r.City, langs)
+	if len(r.names.subdivisions) == len(r.Subdivisions) {
+		// The slice is shared with the cached response
+		subdivisions := make([]string, len(r.Subdivisions))
+		for i, name := range r.Subdivisions {
+			subdivisions[i] = localName(r.names.subdivisions[i], name, langs)
+		}
+		r.Subdivisions = subdivisions
+	}
 }
 
 type PortResponse struct {
@@ -84,6 +197,9 @@ func ipFromRequest(headers []string, r *http.Request, customIP bool) (net.IP, er
 	remoteIP := ""
 	if customIP && r.URL != nil {
 		if v, ok := r.URL.Query()["ip"]; ok {
+			if ip := iputil.ParseIP(v[0]); ip != nil {
+				return ip, nil
+			}
 			remoteIP = v[0]
 		}
 	}
@@ -127,45 +243,300 @@ func (s *Server) newResponse(r *http.Request) (Response, error) {
 	if err != nil {
 		return Response{}, err
 	}
-	response, ok := s.cache.Get(ip)
-	if ok {
-		// Do not cache user agent
-		response.UserAgent = userAgentFromRequest(r)
-		return response, nil
+	want, err := requestedLookups(r)
+	if err != nil {
+		return Response{}, err
 	}
+	response := s.lookupIP(ip, want)
+	s.prepareResponse(&response, r)
+	// Do not cache user agent
+	response.UserAgent = userAgentFromRequest(r)
+	s.setClaimedBot(&response, r)
+	return response, nil
+}
+
+// prepareResponse applies the options of r that do not affect caching to a
+// response looked up for it.
+func (s *Server) prepareResponse(response *Response, r *http.Request) {
+	response.Sources = responseSources(r, response.Sources)
+	response.localize(requestLanguages(r))
+	if wantLocalTime(r) {
+		response.setLocalTime(s.now())
+	}
+	if wantCountryInfo(r) {
+		response.setCountryInfo()
+	}
+}
+
+// lookupIP builds the Response for ip from the geo databases, consulting the
+// cache first. Only the lookups in want are performed. Responses are cached
+// with the lookups they were built with, and a cached response lacking some
+// of want is extended, reusing its reverse DNS and bot lookups, so the result
+// may include more than want. It never includes request specific data
+// such as the user agent, but always includes the sources of geo fields if
+// the geo reader reports them. Overrides configured for ip take precedence
+// over the geo databases, which are not consulted for bogon addresses unless
+// LookupBogons is set. Cached responses must be cleared when the lists of
+// LookupLists, the ranges of LookupCloud or LookupBot or the delegations of
+// LookupRIR change.
+func (s *Server) lookupIP(ip net.IP, want lookups) Response {
+	// Read before the lookup, so that a response looked up while the cache
+	// is cleared is not cached
+	generation := s.cache.Generation()
+	cached, ok := s.cache.Get(ip)
+	if ok && cached.lookups&want == want {
+		return cached
+	}
+	// Extend the cached response, which is empty if there is none
+	want |= cached.lookups
+	built := want
 	ipDecimal := iputil.ToDecimal(ip)
-	country, _ := s.gr.Country(ip)
-	city, _ := s.gr.City(ip)
-	asn, _ := s.gr.ASN(ip)
-	var hostname string
-	if s.LookupAddr != nil {
+	class := iputil.Classify(ip)
+	if class.Bogon && !s.LookupBogons {
+		// The geo databases have nothing useful for addresses that are not
+		// globally reachable
+		want &^= countryLookup | cityLookup | asnLookup
+	}
+	var (
+		country geo.Country
+		city    geo.City
+		asn     geo.ASN
+	)
+	if want&countryLookup != 0 {
+		country, _ = s.gr.Country(ip)
+	}
+	if want&cityLookup != 0 {
+		city, _ = s.gr.City(ip)
+	}
+	if want&asnLookup != 0 {
+		asn, _ = s.gr.ASN(ip)
+	}
+	hostname := cached.Hostname
+	if s.LookupAddr != nil && want&^cached.lookups&hostnameLookup != 0 {
 		hostname, _ = s.LookupAddr(ip)
 	}
+	botName, botVerified := cached.BotName, cached.BotVerified
+	if s.LookupBot != nil && want&^cached.lookups&botLookup != 0 {
+		name, verified := s.LookupBot(ip, "")
+		botName, botVerified = name, &verified
+	}
+	var (
+		override        overrides.Override
+		overrideNetwork *net.IPNet
+	)
+	if s.LookupOverride != nil {
+		if o, ok := s.LookupOverride(ip); ok {
+			override = o
+			_, overrideNetwork, _ = net.ParseCIDR(override.Network)
+		}
+	}
 	var autonomousSystemNumber string
 	if asn.AutonomousSystemNumber > 0 {
 		autonomousSystemNumber = fmt.Sprintf("AS%d", asn.AutonomousSystemNumber)
 	}
-	response = Response{
-		IP:         ip,
-		IPDecimal:  ipDecimal,
-		Country:    country.Name,
-		CountryISO: country.ISO,
-		CountryEU:  country.IsEU,
-		RegionName: city.RegionName,
-		RegionCode: city.RegionCode,
-		MetroCode:  city.MetroCode,
-		PostalCode: city.PostalCode,
-		City:       city.Name,
-		Latitude:   city.Latitude,
-		Longitude:  city.Longitude,
-		Timezone:   city.Timezone,
-		ASN:        autonomousSystemNumber,
-		ASNOrg:     asn.AutonomousSystemOrganization,
-		Hostname:   hostname,
-	}
-	s.cache.Set(ip, response)
-	response.UserAgent = userAgentFromRequest(r)
-	return response, nil
+	response := Response{
+		IP:                    ip,
+		IPDecimal:             ipDecimal,
+		IPHex:                 iputil.ToHex(ip),
+		IPOctal:               iputil.ToOctal(ip),
+		IPBinary:              iputil.ToBinary(ip),
+		IPDottedOctal:         iputil.ToDottedOctal(ip),
+		ReversePointer:        iputil.ReversePointer(ip),
+		IPVersion:             iputil.Version(ip),
+		Category:              class.Category,
+		IsPrivate:             class.Private,
+		IsBogon:               class.Bogon,
+		Network:               mostSpecificNetwork(country.Network, city.Network, asn.Network, overrideNetwork),
+		Country:               country.Name,
+		CountryISO:            country.ISO,
+		CountryEU:             country.IsEU,
+		CountryGeoNameID:      country.GeoNameID,
+		Continent:             country.Continent.Name,
+		ContinentCode:         country.Continent.ISO,
+		RegisteredCountry:     country.RegisteredCountry.Name,
+		RegisteredCountryISO:  country.RegisteredCountry.ISO,
+		RepresentedCountry:    country.RepresentedCountry.Name,
+		RepresentedCountryISO: country.RepresentedCountry.ISO,
+		RegionName:            city.RegionName,
+		RegionCode:            city.RegionCode,
+		MetroCode:             city.MetroCode,
+		PostalCode:            city.PostalCode,
+		City:                  city.Name,
+		CityGeoNameID:         city.GeoNameID,
+		Latitude:              city.Latitude,
+		Longitude:             city.Longitude,
+		AccuracyRadius:        city.AccuracyRadius,
+		Timezone:              city.Timezone,
+		ASN:                   autonomousSystemNumber,
+		ASNOrg:                asn.AutonomousSystemOrganization,
+		Hostname:              hostname,
+		BotVerified:           botVerified,
+		BotName:               botName,
+		Sources:               geoSources(country, city, asn),
+	}
+	response.names = localizedNames{
+		country:            country.Names,
+		continent:          country.Continent.Names,
+		registeredCountry:  country.RegisteredCountry.Names,
+		representedCountry: country.RepresentedCountry.Names,
+		city:               city.Names,
+	}
+	for _, s := range city.Subdivisions {
+		response.Subdivisions = append(response.Subdivisions, s.Name)
+		response.SubdivisionCodes = append(response.SubdivisionCodes, s.ISO)
+		response.names.subdivisions = append(response.names.subdivisions, s.Names)
+	}
+	if len(city.Subdivisions) > 0 && city.Subdivisions[0].Name == city.RegionName {
+		response.names.region = city.Subdivisions[0].Names
+	}
+	if ip.To4() == nil {
+		response.setIPv6Info(ip)
+	}
+	if s.LookupLists != nil {
+		response.setListMatches(s.LookupLists(ip))
+	}
+	if s.LookupRIR != nil {
+		if d, ok := s.LookupRIR(ip); ok {
+			response.Registry, response.AllocatedCountry = d.Registry, d.Country
+			response.AllocationDate, response.AllocationStatus = d.Date, d.Status
+		}
+	}
+	if s.LookupCloud != nil {
+		if r, ok := s.LookupCloud(ip); ok {
+			response.CloudProvider, response.CloudRegion, response.CloudService = r.Provider, r.Region, r.Service
+		}
+	}
+	applyOverride(&response, override)
+	response.lookups = built
+	s.cache.Set(ip, response, generation)
+	return response
+}
+
+// setClaimedBot sets the name of the bot the user agent of r claims to be,
+// for responses about the address r was sent from that is not a verified bot.
+func (s *Server) setClaimedBot(response *Response, r *http.Request) {
+	if s.LookupBot == nil || response.BotVerified == nil || *response.BotVerified {
+		return
+	}
+	if _, ok := r.URL.Query()["ip"]; ok {
+		return
+	}
+	response.BotName, _ = s.LookupBot(response.IP, r.UserAgent())
+}
+
+// setListMatches sets the fields describing the lists that contain the
+// address.
+func (r *Response) setListMatches(matches []iplist.Match) {
+	var tor, vpn, hosting, blocklisted bool
+	for _, m := range matches {
+		switch m.Kind {
+		case iplist.Tor:
+			tor = true
+		case iplist.VPN:
+			vpn = true
+		case iplist.Hosting:
+			hosting = true
+		case iplist.Blocklist:
+			blocklisted = true
+		}
+		r.IPLists = append(r.IPLists, m.Name)
+	}
+	score := iplist.Score(matches)
+	r.IsTorExit, r.IsVPN, r.IsHosting, r.IsBlocklisted = &tor, &vpn, &hosting, &blocklisted
+	r.ReputationScore = &score
+}
+
+// setIPv6Info sets the fields decoded from the IPv6 address ip.
+func (r *Response) setIPv6Info(ip net.IP) {
+	info, ok := iputil.AnalyzeIPv6(ip)
+	if !ok {
+		return
+	}
+	r.IPv6Transition = info.Transition
+	if info.EmbeddedIPv4 != nil {
+		r.EmbeddedIPv4 = info.EmbeddedIPv4.String()
+	}
+	if info.TeredoServer != nil {
+		r.TeredoServer = info.TeredoServer.String()
+	}
+	r.TeredoPort = info.TeredoPort
+	if info.MAC != nil {
+		r.MAC = info.MAC.String()
+	}
+	r.MACVendor = info.MACVendor
+	r.PrivacyAddress = info.Privacy
+}
+
+// mostSpecificNetwork returns the longest of the given prefixes in CIDR
+// notation. They all contain the looked up address, so the longest one is the
+// range for which every database returns the same records.
+func mostSpecificNetwork(networks ...*net.IPNet) string {
+	var best *net.IPNet
+	bestOnes := -1
+	for _, n := range networks {
+		if n == nil {
+			continue
+		}
+		if ones, _ := n.Mask.Size(); ones > bestOnes {
+			best, bestOnes = n, ones
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.String()
+}
+
+// applyOverride replaces the fields of response that are set in o and adds its
+// tags. The sources of the replaced fields are reported as override.
+func applyOverride(response *Response, o overrides.Override) {
+	overridden := func(names ...string) {
+		if response.Sources == nil {
+			response.Sources = make(map[string]string)
+		}
+		for _, name := range names {
+			response.Sources[name] = "override"
+		}
+	}
+	set := func(name string, dst *string, v string) {
+		if v != "" {
+			*dst = v
+			overridden(name)
+		}
+	}
+	// Overridden names are not localized
+	if o.Country != "" {
+		response.names.country = nil
+	}
+	if o.RegionName != "" {
+		response.names.region = nil
+	}
+	if o.City != "" {
+		response.names.city = nil
+	}
+	set("country", &response.Country, o.Country)
+	set("country_iso", &response.CountryISO, o.CountryISO)
+	if o.CountryEU != nil {
+		response.CountryEU = o.CountryEU
+		overridden("country_eu")
+	}
+	set("region_name", &response.RegionName, o.RegionName)
+	set("region_code", &response.RegionCode, o.RegionCode)
+	set("city", &response.City, o.City)
+	set("zip_code", &response.PostalCode, o.PostalCode)
+	set("time_zone", &response.Timezone, o.Timezone)
+	if o.Latitude != 0 || o.Longitude != 0 {
+		response.Latitude, response.Longitude = o.Latitude, o.Longitude
+		// The accuracy of the database location does not apply
+		response.AccuracyRadius = 0
+		delete(response.Sources, "accuracy_radius")
+		overridden("latitude", "longitude")
+	}
+	if o.ASN > 0 {
+		set("asn", &response.ASN, fmt.Sprintf("AS%d", o.ASN))
+	}
+	set("asn_org", &response.ASNOrg, o.ASNOrg)
+	response.Tags = o.Tags
 }
 
 func (s *Server) newPortResponse(r *http.Request) (PortResponse, error) {
@@ -195,57 +566,47 @@ func (s *Server) CLIHandler(w http.ResponseWriter, r *http.Request) *appError {
 	return nil
 }
 
-func (s *Server) CLICountryHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
-	if err != nil {
-		return badRequest(err).WithMessage(err.Error()).AsJSON()
-	}
-	fmt.Fprintln(w, response.Country)
-	return nil
-}
-
-func (s *Server) CLICountryISOHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
-	if err != nil {
-		return badRequest(err).WithMessage(err.Error()).AsJSON()
-	}
-	fmt.Fprintln(w, response.CountryISO)
-	return nil
-}
-
-func (s *Server) CLICityHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
-	if err != nil {
-		return badRequest(err).WithMessage(err.Error()).AsJSON()
+// CLIFieldHandler returns a handler writing the Response field with the given
+// JSON name as plain text.
+func (s *Server) CLIFieldHandler(name string) appHandler {
+	want := fieldLookups[name]
+	return func(w http.ResponseWriter, r *http.Request) *appError {
+		if want&(countryLookup|cityLookup|asnLookup) != 0 && s.gr.IsEmpty() {
+			// The geo databases may not have been downloaded yet
+			return NotFoundHandler(w, r)
+		}
+		ip, err := ipFromRequest(s.IPHeaders, r, true)
+		if err != nil {
+			return badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		response := s.lookupIP(ip, want)
+		response.localize(requestLanguages(r))
+		if localTimeFields[name] {
+			response.setLocalTime(s.now())
+		}
+		if countryInfoFields[name] {
+			response.setCountryInfo()
+		}
+		s.setClaimedBot(&response, r)
+		value, err := fieldValue(response, name)
+		if err != nil {
+			return internalServerError(err).AsJSON()
+		}
+		fmt.Fprintln(w, value)
+		return nil
 	}
-	fmt.Fprintln(w, response.City)
-	return nil
 }
 
 func (s *Server) CLICoordinatesHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
-	if err != nil {
-		return badRequest(err).WithMessage(err.Error()).AsJSON()
-	}
-	fmt.Fprintf(w, "%s,%s\n", formatCoordinate(response.Latitude), formatCoordinate(response.Longitude))
-	return nil
-}
-
-func (s *Server) CLIASNHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
-	if err != nil {
-		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	if s.gr.IsEmpty() {
+		return NotFoundHandler(w, r)
 	}
-	fmt.Fprintf(w, "%s\n", response.ASN)
-	return nil
-}
-
-func (s *Server) CLIASNOrgHandler(w http.ResponseWriter, r *http.Request) *appError {
-	response, err := s.newResponse(r)
+	ip, err := ipFromRequest(s.IPHeaders, r, true)
 	if err != nil {
 		return badRequest(err).WithMessage(err.Error()).AsJSON()
 	}
-	fmt.Fprintf(w, "%s\n", response.ASNOrg)
+	response := s.lookupIP(ip, cityLookup)
+	fmt.Fprintf(w, "%s,%s\n", formatCoordinate(response.Latitude), formatCoordinate(response.Longitude))
 	return nil
 }
 
@@ -254,13 +615,7 @@ func (s *Server) JSONHandler(w http.ResponseWriter, r *http.Request) *appError {
 	if err != nil {
 		return badRequest(err).WithMessage(err.Error()).AsJSON()
 	}
-	b, err := json.MarshalIndent(response, "", "  ")
-	if err != nil {
-		return internalServerError(err).AsJSON()
-	}
-	w.Header().Set("Content-Type", jsonMediaType)
-	w.Write(b)
-	return nil
+	return writeFormatted(w, r, response)
 }
 
 func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) *appError {
@@ -341,6 +696,7 @@ func (s *Server) DefaultHandler(w http.ResponseWriter, r *http.Request) *appErro
 		return internalServerError(err)
 	}
 
+	top, bottom, left, right := boundingBox(response.Latitude, response.Longitude, response.AccuracyRadius)
 	var data = struct {
 		Response
 		Host         string
@@ -354,10 +710,10 @@ func (s *Server) DefaultHandler(w http.ResponseWriter, r *http.Request) *appErro
 	}{
 		response,
 		r.Host,
-		response.Latitude + 0.05,
-		response.Latitude - 0.05,
-		response.Longitude - 0.05,
-		response.Longitude + 0.05,
+		top,
+		bottom,
+		left,
+		right,
 		string(json),
 		s.LookupPort != nil,
 		s.Sponsor,
@@ -368,6 +724,23 @@ func (s *Server) DefaultHandler(w http.ResponseWriter, r *http.Request) *appErro
 	return nil
 }
 
+// boundingBox returns the latitudes and longitudes bounding the area within
+// radius kilometers of a location, for showing it on a map. Without a radius
+// the box extends 0.05° in every direction.
+func boundingBox(lat, lon float64, radius uint) (top, bottom, left, right float64) {
+	const kmPerDegree = 111.32
+	dLat, dLon := 0.05, 0.05
+	if radius > 0 {
+		dLat = float64(radius) / kmPerDegree
+		// Degrees of longitude get shorter towards the poles
+		dLon = 180.0
+		if c := math.Cos(lat * math.Pi / 180); c > dLat/180 {
+			dLon = dLat / c
+		}
+	}
+	return math.Min(lat+dLat, 90), math.Max(lat-dLat, -90), math.Max(lon-dLon, -180), math.Min(lon+dLon, 180)
+}
+
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) *appError {
 	err := notFound(nil).WithMessage("404 page not found")
 	if r.Header.Get("accept") == jsonMediaType {
@@ -424,56 +797,18 @@ func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) IPLookupHandler(w http.ResponseWriter, r *http.Request) *appError {
 	// Extract IP from path
 	ipStr := strings.TrimPrefix(r.URL.Path, "/")
-	ipStr = strings.Trim(ipStr, "[]") // Remove brackets for IPv6
-
-	ip := net.ParseIP(ipStr)
+	ip := iputil.ParseIPStrict(ipStr)
 	if ip == nil {
 		return badRequest(fmt.Errorf("invalid IP address")).WithMessage("Invalid IP address: " + ipStr).AsJSON()
 	}
 
-	// Create a response for the provided IP
-	ipDecimal := iputil.ToDecimal(ip)
-	country, _ := s.gr.Country(ip)
-	city, _ := s.gr.City(ip)
-	asn, _ := s.gr.ASN(ip)
-
-	var hostname string
-	if s.LookupAddr != nil {
-		hostname, _ = s.LookupAddr(ip)
-	}
-
-	var autonomousSystemNumber string
-	if asn.AutonomousSystemNumber > 0 {
-		autonomousSystemNumber = fmt.Sprintf("AS%d", asn.AutonomousSystemNumber)
-	}
-
-	response := Response{
-		IP:         ip,
-		IPDecimal:  ipDecimal,
-		Country:    country.Name,
-		CountryISO: country.ISO,
-		CountryEU:  country.IsEU,
-		RegionName: city.RegionName,
-		RegionCode: city.RegionCode,
-		MetroCode:  city.MetroCode,
-		PostalCode: city.PostalCode,
-		City:       city.Name,
-		Latitude:   city.Latitude,
-		Longitude:  city.Longitude,
-		Timezone:   city.Timezone,
-		ASN:        autonomousSystemNumber,
-		ASNOrg:     asn.AutonomousSystemOrganization,
-		Hostname:   hostname,
-	}
-
-	b, err := json.MarshalIndent(response, "", "  ")
+	want, err := requestedLookups(r)
 	if err != nil {
-		return internalServerError(err).AsJSON()
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
 	}
-
-	w.Header().Set("Content-Type", jsonMediaType)
-	w.Write(b)
-	return nil
+	response := s.lookupIP(ip, want)
+	s.prepareResponse(&response, r)
+	return writeFormatted(w, r, response)
 }
 
 // API v1 handlers - these wrap existing handlers for the /api/v1 prefix
@@ -488,30 +823,18 @@ func (s *Server) APIV1IPHandler(w http.ResponseWriter, r *http.Request) *appErro
 func (s *Server) APIV1IPLookupHandler(w http.ResponseWriter, r *http.Request) *appError {
 	// Extract IP from /api/v1/ip/{ip}
 	ipStr := strings.TrimPrefix(r.URL.Path, "/api/v1/ip/")
-	ipStr = strings.Trim(ipStr, "[]")
-
-	ip := net.ParseIP(ipStr)
+	ip := iputil.ParseIP(ipStr)
 	if ip == nil {
 		return badRequest(fmt.Errorf("invalid IP address")).WithMessage("Invalid IP address: " + ipStr).AsJSON()
 	}
 
 	// Create a modified request to use the IP
-	r.URL.RawQuery = "ip=" + ip.String()
+	q := r.URL.Query()
+	q.Set("ip", ip.String())
+	r.URL.RawQuery = q.Encode()
 	return s.JSONHandler(w, r)
 }
 
-func (s *Server) APIV1CountryHandler(w http.ResponseWriter, r *http.Request) *appError {
-	return s.CLICountryHandler(w, r)
-}
-
-func (s *Server) APIV1CityHandler(w http.ResponseWriter, r *http.Request) *appError {
-	return s.CLICityHandler(w, r)
-}
-
-func (s *Server) APIV1ASNHandler(w http.ResponseWriter, r *http.Request) *appError {
-	return s.CLIASNHandler(w, r)
-}
-
 func (s *Server) Handler() http.Handler {
 	r := NewRouter()
 
@@ -519,7 +842,7 @@ func (s *Server) Handler() http.Handler {
 	_ = InitTemplates()
 
 	// Static files (embedded)
-	http.Handle("/static/", http.StripPrefix("/static/", StaticHandler()))
+	r.RoutePrefix("GET", "/static/", wrapHandlerFunc(http.StripPrefix("/static/", StaticHandler()).ServeHTTP))
 
 	// Health
 	r.Route("GET", "/health", s.HealthHandler)
@@ -527,28 +850,43 @@ func (s *Server) Handler() http.Handler {
 	// API v1 routes
 	r.Route("GET", "/api/v1", s.APIV1InfoHandler)
 	r.Route("GET", "/api/v1/ip", s.APIV1IPHandler)
+	r.Route("POST", "/api/v1/ip/batch", s.BatchHandler)
 	r.RoutePrefix("GET", "/api/v1/ip/", s.APIV1IPLookupHandler)
-	if !s.gr.IsEmpty() {
-		r.Route("GET", "/api/v1/country", s.APIV1CountryHandler)
-		r.Route("GET", "/api/v1/city", s.APIV1CityHandler)
-		r.Route("GET", "/api/v1/asn", s.APIV1ASNHandler)
+
+	// Subnet calculator
+	r.Route("POST", "/api/v1/subnet/aggregate", s.AggregateHandler)
+	r.RoutePrefix("GET", "/api/v1/subnet/", s.SubnetHandler)
+	r.Route("POST", "/subnet/aggregate", s.CLIAggregateHandler)
+	r.RoutePrefix("GET", "/subnet/", s.CLISubnetHandler)
+
+	// Distance between locations
+	r.Route("GET", "/api/v1/distance", s.DistanceHandler)
+
+	// Country metadata
+	r.RoutePrefix("GET", "/api/v1/country/", s.CountryHandler)
+
+	// Reputation from the configured lists
+	if s.LookupLists != nil {
+		r.Route("GET", "/api/v1/reputation", s.ReputationHandler)
+		r.RoutePrefix("GET", "/api/v1/reputation/", s.ReputationHandler)
 	}
 
 	// JSON
 	r.Route("GET", "/", s.JSONHandler).Header("Accept", jsonMediaType)
 	r.Route("GET", "/json", s.JSONHandler)
+	r.Route("GET", "/", s.JSONHandler).MatcherFunc(formatMatcher)
 
 	// CLI
 	r.Route("GET", "/", s.CLIHandler).MatcherFunc(cliMatcher)
 	r.Route("GET", "/", s.CLIHandler).Header("Accept", textMediaType)
 	r.Route("GET", "/ip", s.CLIHandler)
-	if !s.gr.IsEmpty() {
-		r.Route("GET", "/country", s.CLICountryHandler)
-		r.Route("GET", "/country-iso", s.CLICountryISOHandler)
-		r.Route("GET", "/city", s.CLICityHandler)
-		r.Route("GET", "/coordinates", s.CLICoordinatesHandler)
-		r.Route("GET", "/asn", s.CLIASNHandler)
-		r.Route("GET", "/asn-org", s.CLIASNOrgHandler)
+	r.Route("GET", "/time", s.CLITimeHandler)
+	r.Route("GET", "/coordinates", s.CLICoordinatesHandler)
+	r.Route("GET", "/api/v1/coordinates", s.CLICoordinatesHandler)
+	for _, name := range s.cliFields() {
+		path := fieldPath(name)
+		r.Route("GET", "/"+path, s.CLIFieldHandler(name))
+		r.Route("GET", "/api/v1/"+path, s.CLIFieldHandler(name))
 	}
 
 	// Browser
@@ -561,17 +899,6 @@ func (s *Server) Handler() http.Handler {
 		r.RoutePrefix("GET", "/port/", s.PortHandler)
 	}
 
-	// IP lookup endpoint /{ip} - must be registered after other specific routes
-	// This handles IPv4 addresses like /8.8.8.8 and IPv6 like /2001:4860:4860::8888
-	r.RoutePrefix("GET", "/", func(w http.ResponseWriter, r *http.Request) *appError {
-		path := strings.TrimPrefix(r.URL.Path, "/")
-		// Only handle if path looks like an IP address
-		if path != "" && (strings.Contains(path, ".") || strings.Contains(path, ":")) {
-			return s.IPLookupHandler(w, r)
-		}
-		return NotFoundHandler(w, r)
-	})
-
 	// Profiling
 	if s.profile {
 		r.Route("POST", "/debug/cache/resize", s.cacheResizeHandler)
@@ -583,6 +910,18 @@ func (s *Server) Handler() http.Handler {
 		r.RoutePrefix("GET", "/debug/pprof/", wrapHandlerFunc(pprof.Index))
 	}
 
+	// IP lookup endpoint /{ip} - must be registered after other specific routes
+	// This handles IPv4 addresses like /8.8.8.8 and IPv6 like /2001:4860:4860::8888.
+	// Numeric forms like /134744072 are only accepted by /api/v1/ip/{ip}, as
+	// any other path of digits would be taken for an address
+	r.RoutePrefix("GET", "/", func(w http.ResponseWriter, r *http.Request) *appError {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		if iputil.ParseIPStrict(path) != nil {
+			return s.IPLookupHandler(w, r)
+		}
+		return NotFoundHandler(w, r)
+	})
+
 	return r.Handler()
 }
 
@@ -1,16 +1,25 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/apimgr/echoip/src/cloud"
+	"github.com/apimgr/echoip/src/iplist"
 	"github.com/apimgr/echoip/src/iputil/geo"
+	"github.com/apimgr/echoip/src/overrides"
+	"github.com/apimgr/echoip/src/rir"
 )
 
 func lookupAddr(net.IP) (string, error) { return "localhost", nil }
@@ -32,8 +41,52 @@ func (t *testDb) ASN(net.IP) (geo.ASN, error) {
 
 func (t *testDb) IsEmpty() bool { return false }
 
+// networkDb returns the same records as testDb, along with the networks of
+// the matching database records.
+type networkDb struct{ testDb }
+
+func (t *networkDb) Country(ip net.IP) (geo.Country, error) {
+	country, _ := t.testDb.Country(ip)
+	_, country.Network, _ = net.ParseCIDR("127.0.0.0/8")
+	return country, nil
+}
+
+func (t *networkDb) City(ip net.IP) (geo.City, error) {
+	city, _ := t.testDb.City(ip)
+	_, city.Network, _ = net.ParseCIDR("127.0.0.0/24")
+	return city, nil
+}
+
+func (t *networkDb) ASN(ip net.IP) (geo.ASN, error) {
+	asn, _ := t.testDb.ASN(ip)
+	_, asn.Network, _ = net.ParseCIDR("127.0.0.0/16")
+	return asn, nil
+}
+
+// detailDb returns the records of testDb with continent, subdivisions and
+// accuracy radius.
+type detailDb struct{ testDb }
+
+func (t *detailDb) Country(ip net.IP) (geo.Country, error) {
+	country, _ := t.testDb.Country(ip)
+	country.Names = map[string]string{"en": "Elbonia", "de": "Elbonien", "ja": "エルボニア"}
+	country.Continent = geo.Place{Name: "Europe", ISO: "EU", GeoNameID: 6255148}
+	country.RegisteredCountry = geo.Place{Name: "Norway", ISO: "NO"}
+	return country, nil
+}
+
+func (t *detailDb) City(ip net.IP) (geo.City, error) {
+	city, _ := t.testDb.City(ip)
+	city.AccuracyRadius = 20
+	city.Names = map[string]string{"en": "Bornyasherk", "de": "Bornjascherk"}
+	city.Subdivisions = []geo.Place{{Name: "North Elbonia", ISO: "1234", Names: map[string]string{"de": "Nordelbonien"}},
+		{Name: "Mudville", ISO: "MV"}}
+	return city, nil
+}
+
 func testServer() *Server {
-	return &Server{cache: NewCache(100), gr: &testDb{}, LookupAddr: lookupAddr, LookupPort: lookupPort}
+	// Test requests come from a loopback address
+	return &Server{cache: NewCache(100), gr: &testDb{}, LookupAddr: lookupAddr, LookupPort: lookupPort, LookupBogons: true}
 }
 
 func httpGet(url string, acceptMediaType string, userAgent string) (string, int, error) {
@@ -95,6 +148,24 @@ func TestCLIHandlers(t *testing.T) {
 		{s.URL + "/foo", "404 page not found", 404, "", ""},
 		{s.URL + "/asn", "AS59795\n", 200, "", ""},
 		{s.URL + "/asn-org", "Hosting4Real\n", 200, "", ""},
+		{s.URL + "/ip-decimal", "2130706433\n", 200, "", ""},
+		{s.URL + "/country-eu", "false\n", 200, "", ""},
+		{s.URL + "/region-name", "North Elbonia\n", 200, "", ""},
+		{s.URL + "/region-code", "1234\n", 200, "", ""},
+		{s.URL + "/metro-code", "1234\n", 200, "", ""},
+		{s.URL + "/zip-code", "1234\n", 200, "", ""},
+		{s.URL + "/latitude", "63.416667\n", 200, "", ""},
+		{s.URL + "/time-zone", "Europe/Bornyasherk\n", 200, "", ""},
+		{s.URL + "/hostname", "localhost\n", 200, "", ""},
+		{s.URL + "/network", "\n", 200, "", ""},
+		{s.URL + "/api/v1/time-zone", "Europe/Bornyasherk\n", 200, "", ""},
+		{s.URL + "/api/v1/ip-decimal?ip=1.3.3.7", "16974599\n", 200, "", ""},
+		{s.URL + "/api/v1/ip-hex?ip=16974599", "0x01030307\n", 200, "", ""},
+		{s.URL + "/ip?ip=0x01030307", "1.3.3.7\n", 200, "", ""},
+		{s.URL + "/reverse-pointer?ip=1.3.775", "7.3.3.1.in-addr.arpa\n", 200, "", ""},
+		{s.URL + "/ip-dotted-octal", "0177.0000.0000.0001\n", 200, "", ""},
+		{s.URL + "/api/v1/coordinates", "63.416667,10.416667\n", 200, "", ""},
+		{s.URL + "/user-agent", "404 page not found", 404, "", ""},
 	}
 
 	for _, tt := range tests {
@@ -128,7 +199,15 @@ func TestDisabledHandlers(t *testing.T) {
 		{s.URL + "/country", "404 page not found", 404},
 		{s.URL + "/country-iso", "404 page not found", 404},
 		{s.URL + "/city", "404 page not found", 404},
-		{s.URL + "/json", "{\n  \"ip\": \"127.0.0.1\",\n  \"ip_decimal\": 2130706433\n}", 200},
+		{s.URL + "/time-zone", "404 page not found", 404},
+		{s.URL + "/hostname", "404 page not found", 404},
+		{s.URL + "/is-tor-exit", "404 page not found", 404},
+		{s.URL + "/api/v1/reputation", "404 page not found", 404},
+		{s.URL + "/cloud-provider", "404 page not found", 404},
+		{s.URL + "/bot-verified", "404 page not found", 404},
+		{s.URL + "/allocation-date", "404 page not found", 404},
+		{s.URL + "/ip-decimal", "2130706433\n", 200},
+		{s.URL + "/json", "{\n  \"ip\": \"127.0.0.1\",\n  \"ip_decimal\": 2130706433,\n  \"ip_hex\": \"0x7f000001\",\n  \"ip_octal\": \"017700000001\",\n  \"ip_binary\": \"01111111.00000000.00000000.00000001\",\n  \"ip_dotted_octal\": \"0177.0000.0000.0001\",\n  \"reverse_pointer\": \"1.0.0.127.in-addr.arpa\",\n  \"ip_version\": 4,\n  \"category\": \"loopback\",\n  \"is_private\": false,\n  \"is_bogon\": true\n}", 200},
 	}
 
 	for _, tt := range tests {
@@ -145,6 +224,34 @@ func TestDisabledHandlers(t *testing.T) {
 	}
 }
 
+func TestGeoHandlersAfterLoad(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	server := testServer()
+	server.gr, _ = geo.Open("", "", "")
+	s := httptest.NewServer(server.Handler())
+
+	if _, status, _ := httpGet(s.URL+"/country", "", ""); status != 404 {
+		t.Errorf("Expected 404 without geo databases, got %d", status)
+	}
+	// Databases that are loaded after the routes were registered are used
+	server.gr = &testDb{}
+	for _, tt := range []struct {
+		url string
+		out string
+	}{
+		{s.URL + "/country", "Elbonia\n"},
+		{s.URL + "/coordinates", "63.416667,10.416667\n"},
+	} {
+		out, status, err := httpGet(tt.url, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != 200 || out != tt.out {
+			t.Errorf("Expected %q for %s, got %d %q", tt.out, tt.url, status, out)
+		}
+	}
+}
+
 func TestJSONHandlers(t *testing.T) {
 	log.SetOutput(ioutil.Discard)
 	s := httptest.NewServer(testServer().Handler())
@@ -154,7 +261,7 @@ func TestJSONHandlers(t *testing.T) {
 		out    string
 		status int
 	}{
-		{s.URL, "{\n  \"ip\": \"127.0.0.1\",\n  \"ip_decimal\": 2130706433,\n  \"country\": \"Elbonia\",\n  \"country_iso\": \"EB\",\n  \"country_eu\": false,\n  \"region_name\": \"North Elbonia\",\n  \"region_code\": \"1234\",\n  \"metro_code\": 1234,\n  \"zip_code\": \"1234\",\n  \"city\": \"Bornyasherk\",\n  \"latitude\": 63.416667,\n  \"longitude\": 10.416667,\n  \"time_zone\": \"Europe/Bornyasherk\",\n  \"asn\": \"AS59795\",\n  \"asn_org\": \"Hosting4Real\",\n  \"hostname\": \"localhost\",\n  \"user_agent\": {\n    \"product\": \"curl\",\n    \"version\": \"7.2.6.0\",\n    \"raw_value\": \"curl/7.2.6.0\"\n  }\n}", 200},
+		{s.URL, "{\n  \"ip\": \"127.0.0.1\",\n  \"ip_decimal\": 2130706433,\n  \"ip_hex\": \"0x7f000001\",\n  \"ip_octal\": \"017700000001\",\n  \"ip_binary\": \"01111111.00000000.00000000.00000001\",\n  \"ip_dotted_octal\": \"0177.0000.0000.0001\",\n  \"reverse_pointer\": \"1.0.0.127.in-addr.arpa\",\n  \"ip_version\": 4,\n  \"category\": \"loopback\",\n  \"is_private\": false,\n  \"is_bogon\": true,\n  \"country\": \"Elbonia\",\n  \"country_iso\": \"EB\",\n  \"country_eu\": false,\n  \"region_name\": \"North Elbonia\",\n  \"region_code\": \"1234\",\n  \"metro_code\": 1234,\n  \"zip_code\": \"1234\",\n  \"city\": \"Bornyasherk\",\n  \"latitude\": 63.416667,\n  \"longitude\": 10.416667,\n  \"time_zone\": \"Europe/Bornyasherk\",\n  \"asn\": \"AS59795\",\n  \"asn_org\": \"Hosting4Real\",\n  \"hostname\": \"localhost\",\n  \"user_agent\": {\n    \"product\": \"curl\",\n    \"version\": \"7.2.6.0\",\n    \"raw_value\": \"curl/7.2.6.0\"\n  }\n}", 200},
 		{s.URL + "/port/foo", "{\n  \"status\": 400,\n  \"error\": \"invalid port: foo\"\n}", 400},
 		{s.URL + "/port/0", "{\n  \"status\": 400,\n  \"error\": \"invalid port: 0\"\n}", 400},
 		{s.URL + "/port/65537", "{\n  \"status\": 400,\n  \"error\": \"invalid port: 65537\"\n}", 400},
@@ -278,3 +385,552 @@ func TestCLIMatcher(t *testing.T) {
 		}
 	}
 }
+
+func TestNetwork(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = &networkDb{}
+	s := httptest.NewServer(srv.Handler())
+
+	out, _, err := httpGet(s.URL+"/json", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\"network\": \"127.0.0.0/24\""; !strings.Contains(out, want) {
+		t.Errorf("Expected %q in %q", want, out)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = &networkDb{}
+	srv.LookupOverride = func(ip net.IP) (overrides.Override, bool) {
+		if !ip.IsLoopback() {
+			return overrides.Override{}, false
+		}
+		return overrides.Override{Network: "127.0.0.0/25", CountryISO: "NO", City: "Oslo", ASN: 64500,
+			Tags: map[string]string{"site": "hq"}}, true
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	overridden := "{\n  \"network\": \"127.0.0.0/25\",\n  \"country_iso\": \"NO\",\n  \"city\": \"Oslo\",\n  \"asn\": \"AS64500\",\n  \"tags\": {\n    \"site\": \"hq\"\n  }\n}"
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/json?fields=network,country_iso,city,asn,tags", overridden},
+		{"/127.0.0.2?fields=network,country_iso,city,asn,tags", overridden},
+		{"/1.3.3.7?fields=network,country_iso,city,asn,tags", "{\n  \"network\": \"127.0.0.0/24\",\n  \"country_iso\": \"EB\",\n  \"city\": \"Bornyasherk\",\n  \"asn\": \"AS59795\"\n}"},
+		{"/json?fields=country,city&sources=true", "{\n  \"country\": \"Elbonia\",\n  \"city\": \"Oslo\",\n  \"sources\": {\n    \"city\": \"override\"\n  }\n}"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestBogons(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupBogons = false
+	srv.LookupOverride = func(ip net.IP) (overrides.Override, bool) {
+		return overrides.Override{Network: "10.0.0.0/8", City: "Oslo"}, ip.IsPrivate()
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/json?fields=ip,ip_version,category,is_private,is_bogon,country,city", "{\n  \"ip\": \"127.0.0.1\",\n  \"ip_version\": 4,\n  \"category\": \"loopback\",\n  \"is_private\": false,\n  \"is_bogon\": true\n}"},
+		{"/100.64.0.1?fields=ip_version,category,is_private,is_bogon,country", "{\n  \"ip_version\": 4,\n  \"category\": \"cgnat\",\n  \"is_private\": true,\n  \"is_bogon\": true\n}"},
+		{"/10.0.0.1?fields=category,network,city", "{\n  \"category\": \"private\",\n  \"network\": \"10.0.0.0/8\",\n  \"city\": \"Oslo\"\n}"},
+		{"/2001:db8::1?fields=ip_version,category,is_bogon", "{\n  \"ip_version\": 6,\n  \"category\": \"documentation\",\n  \"is_bogon\": true\n}"},
+		{"/1.3.3.7?fields=category,is_bogon,country", "{\n  \"category\": \"public\",\n  \"is_bogon\": false,\n  \"country\": \"Elbonia\"\n}"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestIPLists(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupLists = func(ip net.IP) []iplist.Match {
+		switch ip.String() {
+		case "192.0.2.1":
+			return []iplist.Match{{Name: "tor-exits", Kind: iplist.Tor}}
+		case "198.51.100.1":
+			return []iplist.Match{{Name: "x4bnet-vpn", Kind: iplist.VPN}, {Name: "x4bnet-datacenter", Kind: iplist.Hosting}}
+		case "203.0.113.66":
+			return []iplist.Match{{Name: "spamhaus-drop", Kind: iplist.Blocklist, Score: 100}}
+		case "127.0.0.1":
+			return []iplist.Match{{Name: "firehol-level3", Kind: iplist.Blocklist, Score: 40}, {Name: "tor-exits", Kind: iplist.Tor, Score: 20}}
+		}
+		return nil
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/192.0.2.1?fields=is_tor_exit,is_vpn,is_hosting,ip_lists", "{\n  \"is_tor_exit\": true,\n  \"is_vpn\": false,\n  \"is_hosting\": false,\n  \"ip_lists\": [\n    \"tor-exits\"\n  ]\n}"},
+		{"/198.51.100.1?fields=is_tor_exit,is_vpn,is_hosting,ip_lists", "{\n  \"is_tor_exit\": false,\n  \"is_vpn\": true,\n  \"is_hosting\": true,\n  \"ip_lists\": [\n    \"x4bnet-vpn\",\n    \"x4bnet-datacenter\"\n  ]\n}"},
+		{"/203.0.113.1?fields=ip,is_tor_exit,ip_lists", "{\n  \"ip\": \"203.0.113.1\",\n  \"is_tor_exit\": false\n}"},
+		{"/api/v1/is-hosting?ip=198.51.100.1", "true\n"},
+		{"/is-tor-exit?ip=198.51.100.1", "false\n"},
+		{"/203.0.113.66?fields=is_blocklisted,reputation_score,ip_lists", "{\n  \"is_blocklisted\": true,\n  \"reputation_score\": 100,\n  \"ip_lists\": [\n    \"spamhaus-drop\"\n  ]\n}"},
+		{"/203.0.113.1?fields=is_blocklisted,reputation_score", "{\n  \"is_blocklisted\": false,\n  \"reputation_score\": 0\n}"},
+		{"/api/v1/reputation/203.0.113.66", "{\n  \"ip\": \"203.0.113.66\",\n  \"score\": 100,\n  \"blocklisted\": true,\n  \"lists\": [\n    {\n      \"name\": \"spamhaus-drop\",\n      \"kind\": \"blocklist\",\n      \"score\": 100\n    }\n  ]\n}"},
+		{"/api/v1/reputation", "{\n  \"ip\": \"127.0.0.1\",\n  \"score\": 52,\n  \"blocklisted\": true,\n  \"lists\": [\n    {\n      \"name\": \"firehol-level3\",\n      \"kind\": \"blocklist\",\n      \"score\": 40\n    },\n    {\n      \"name\": \"tor-exits\",\n      \"kind\": \"tor\",\n      \"score\": 20\n    }\n  ]\n}"},
+		{"/api/v1/reputation/192.0.2.1?fields=score,blocklisted", "{\n  \"score\": 0,\n  \"blocklisted\": false\n}"},
+		{"/api/v1/reputation/203.0.113.1", "{\n  \"ip\": \"203.0.113.1\",\n  \"score\": 0,\n  \"blocklisted\": false,\n  \"lists\": []\n}"},
+		{"/api/v1/reputation/foo", "{\n  \"status\": 400,\n  \"error\": \"Invalid IP address: foo\"\n}"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestCloudRanges(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupCloud = func(ip net.IP) (cloud.Range, bool) {
+		switch ip.String() {
+		case "3.5.140.1":
+			return cloud.Range{Provider: cloud.AWS, Region: "ap-northeast-2", Service: "S3"}, true
+		case "173.245.48.1":
+			return cloud.Range{Provider: cloud.Cloudflare}, true
+		}
+		return cloud.Range{}, false
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/3.5.140.1?fields=cloud_provider,cloud_region,cloud_service", "{\n  \"cloud_provider\": \"aws\",\n  \"cloud_region\": \"ap-northeast-2\",\n  \"cloud_service\": \"S3\"\n}"},
+		{"/173.245.48.1?fields=ip,cloud_provider,cloud_region", "{\n  \"ip\": \"173.245.48.1\",\n  \"cloud_provider\": \"cloudflare\"\n}"},
+		{"/192.0.2.1?fields=ip,cloud_provider", "{\n  \"ip\": \"192.0.2.1\"\n}"},
+		{"/api/v1/cloud-provider?ip=3.5.140.1", "aws\n"},
+		{"/cloud-service?ip=3.5.140.1", "S3\n"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestBotVerification(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupBot = func(ip net.IP, userAgent string) (string, bool) {
+		if ip.String() == "66.249.66.1" {
+			return "Googlebot", true
+		}
+		if strings.Contains(userAgent, "Googlebot") {
+			return "Googlebot", false
+		}
+		return "", false
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	googlebot := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	var tests = []struct {
+		url       string
+		userAgent string
+		out       string
+	}{
+		{"/66.249.66.1?fields=bot_verified,bot_name", "curl/7.2.6.0", "{\n  \"bot_verified\": true,\n  \"bot_name\": \"Googlebot\"\n}"},
+		{"/192.0.2.1?fields=bot_verified,bot_name", "curl/7.2.6.0", "{\n  \"bot_verified\": false\n}"},
+		// Only the user agent of the requester says what it claims to be
+		{"/192.0.2.1?fields=bot_verified,bot_name", googlebot, "{\n  \"bot_verified\": false\n}"},
+		{"/json?fields=bot_verified,bot_name", googlebot, "{\n  \"bot_verified\": false,\n  \"bot_name\": \"Googlebot\"\n}"},
+		{"/json?ip=192.0.2.1&fields=bot_verified,bot_name", googlebot, "{\n  \"bot_verified\": false\n}"},
+		{"/bot-name?ip=66.249.66.1", "curl/7.2.6.0", "Googlebot\n"},
+		{"/api/v1/bot-verified", googlebot, "false\n"},
+		{"/api/v1/bot-name", googlebot, "Googlebot\n"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, tt.userAgent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestRIRDelegations(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupRIR = func(ip net.IP) (rir.Delegation, bool) {
+		switch ip.String() {
+		case "2.0.0.1":
+			return rir.Delegation{Registry: "ripencc", Country: "FR", Date: "2010-07-12", Status: "allocated"}, true
+		case "23.128.1.1":
+			return rir.Delegation{Registry: "arin", Status: "reserved"}, true
+		}
+		return rir.Delegation{}, false
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/2.0.0.1?fields=registry,allocated_country,allocation_date,allocation_status", "{\n  \"registry\": \"ripencc\",\n  \"allocated_country\": \"FR\",\n  \"allocation_date\": \"2010-07-12\",\n  \"allocation_status\": \"allocated\"\n}"},
+		{"/23.128.1.1?fields=registry,allocated_country,allocation_date,allocation_status", "{\n  \"registry\": \"arin\",\n  \"allocation_status\": \"reserved\"\n}"},
+		{"/192.0.2.1?fields=ip,registry", "{\n  \"ip\": \"192.0.2.1\"\n}"},
+		{"/api/v1/allocation-date?ip=2.0.0.1", "2010-07-12\n"},
+		{"/allocated-country?ip=2.0.0.1", "FR\n"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestIPInputForms(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	s := httptest.NewServer(testServer().Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url    string
+		out    string
+		status int
+	}{
+		{"/[2001:db8::1]", "2001:db8::1", 200},
+		{"/fe80::1%25eth0", "fe80::1", 200},
+		{"/api/v1/ip/0x20010db8000000000000000000000001", "2001:db8::1", 200},
+		{"/api/v1/ip/16974599", "1.3.3.7", 200},
+		{"/api/v1/ip/1.3.775", "1.3.3.7", 200},
+		{"/1.3.3.256", "", 404},
+		// Other paths are not taken for numeric forms of addresses
+		{"/0", "", 404},
+		{"/123", "", 404},
+		{"/16974599", "", 404},
+		{"/0x01030307", "", 404},
+		{"/10.1", "", 404},
+	}
+	for _, tt := range tests {
+		out, status, err := httpGet(s.URL+tt.url+"?fields=ip", jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %s, got %d", tt.status, tt.url, status)
+		}
+		if want := "{\n  \"ip\": \"" + tt.out + "\"\n}"; status == 200 && out != want {
+			t.Errorf("Expected %q for %s, got %q", want, tt.url, out)
+		}
+	}
+}
+
+func TestIPv6Info(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	s := httptest.NewServer(testServer().Handler())
+	defer s.Close()
+
+	fields := "?fields=ipv6_transition,embedded_ipv4,teredo_server,teredo_port,mac,mac_vendor,privacy_address"
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/2001:0:4136:e378:8000:63bf:3fff:fdd2" + fields, "{\n  \"ipv6_transition\": \"teredo\",\n  \"embedded_ipv4\": \"192.0.2.45\",\n  \"teredo_server\": \"65.54.227.120\",\n  \"teredo_port\": 40000\n}"},
+		{"/2002:c000:22d::21b:21ff:fe12:3456" + fields, "{\n  \"ipv6_transition\": \"6to4\",\n  \"embedded_ipv4\": \"192.0.2.45\",\n  \"mac\": \"00:1b:21:12:34:56\",\n  \"mac_vendor\": \"Intel Corporate\"\n}"},
+		{"/2001:db8:1:2:a1b2:c3d4:e5f6:1789" + fields, "{\n  \"privacy_address\": true\n}"},
+		{"/::ffff:192.0.2.1" + fields, "{}"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestGeoDetails(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = &detailDb{}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/json?fields=continent,continent_code,registered_country_iso,subdivisions,subdivision_codes,accuracy_radius",
+			"{\n  \"continent\": \"Europe\",\n  \"continent_code\": \"EU\",\n  \"registered_country_iso\": \"NO\",\n  \"subdivisions\": [\n    \"North Elbonia\",\n    \"Mudville\"\n  ],\n  \"subdivision_codes\": [\n    \"1234\",\n    \"MV\"\n  ],\n  \"accuracy_radius\": 20\n}"},
+		{"/json?fields=subdivisions&format=yaml", "subdivisions: [\"North Elbonia\", \"Mudville\"]\n"},
+		{"/json?fields=subdivisions&format=csv", "subdivisions\n\"North Elbonia,Mudville\"\n"},
+		{"/subdivisions", "North Elbonia,Mudville\n"},
+		{"/accuracy-radius", "20\n"},
+		{"/json?fields=country,region_name,city,subdivisions&lang=de", "{\n  \"country\": \"Elbonien\",\n  \"region_name\": \"Nordelbonien\",\n  \"subdivisions\": [\n    \"Nordelbonien\",\n    \"Mudville\"\n  ],\n  \"city\": \"Bornjascherk\"\n}"},
+		{"/country?lang=ja", "エルボニア\n"},
+		{"/city?lang=ja", "Bornyasherk\n"},
+		{"/country", "Elbonia\n"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.gr = &detailDb{}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	r, err := http.NewRequest("GET", s.URL+"/1.3.3.7?fields=country,city", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept-Language", "fr;q=0.9, de-CH, en;q=0.8")
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	out, _ := ioutil.ReadAll(res.Body)
+	if want := "{\n  \"country\": \"Elbonien\",\n  \"city\": \"Bornjascherk\"\n}"; string(out) != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	var tests = []struct {
+		lat, lon                 float64
+		radius                   uint
+		top, bottom, left, right float64
+	}{
+		{63.4, 10.4, 0, 63.45, 63.35, 10.35, 10.45},
+		{0, 20, 1000, 8.983, -8.983, 11.017, 28.983},
+		{60, 10, 100, 60.898, 59.102, 8.203, 11.797},
+		{89.9, 0, 50, 90, 89.451, -180, 180},
+	}
+	round := func(f float64) float64 { return math.Round(f*1000) / 1000 }
+	for _, tt := range tests {
+		top, bottom, left, right := boundingBox(tt.lat, tt.lon, tt.radius)
+		if round(top) != tt.top || round(bottom) != tt.bottom || round(left) != tt.left || round(right) != tt.right {
+			t.Errorf("boundingBox(%f, %f, %d) = %f, %f, %f, %f, want %f, %f, %f, %f", tt.lat, tt.lon, tt.radius,
+				top, bottom, left, right, tt.top, tt.bottom, tt.left, tt.right)
+		}
+	}
+}
+
+func TestMostSpecificNetwork(t *testing.T) {
+	parse := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	var tests = []struct {
+		in  []*net.IPNet
+		out string
+	}{
+		{nil, ""},
+		{[]*net.IPNet{nil, nil}, ""},
+		{[]*net.IPNet{parse("8.8.0.0/16"), nil, parse("8.8.8.0/24")}, "8.8.8.0/24"},
+		{[]*net.IPNet{parse("2001:db8::/32"), parse("2001:db8::/48")}, "2001:db8::/48"},
+	}
+	for _, tt := range tests {
+		if got := mostSpecificNetwork(tt.in...); got != tt.out {
+			t.Errorf("Expected %q, got %q", tt.out, got)
+		}
+	}
+}
+
+func httpPostType(url, contentType, body string) (string, int, error) {
+	r, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(data), res.StatusCode, nil
+}
+
+func TestBatchHandler(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.LookupAddr = nil
+	srv.BatchLimit = 2
+	s := httptest.NewServer(srv.Handler())
+
+	result := "{\n    \"query\": \"%s\",\n    \"ip\": \"%s\",\n    \"ip_decimal\": %d,\n%s    \"ip_version\": %d,\n    \"category\": \"%s\",\n    \"is_private\": false,\n    \"is_bogon\": %t,\n    \"country\": \"Elbonia\",\n    \"country_iso\": \"EB\",\n    \"country_eu\": false,\n    \"region_name\": \"North Elbonia\",\n    \"region_code\": \"1234\",\n    \"metro_code\": 1234,\n    \"zip_code\": \"1234\",\n    \"city\": \"Bornyasherk\",\n    \"latitude\": 63.416667,\n    \"longitude\": 10.416667,\n    \"time_zone\": \"Europe/Bornyasherk\",\n    \"asn\": \"AS59795\",\n    \"asn_org\": \"Hosting4Real\"\n  }"
+	var tests = []struct {
+		url         string
+		contentType string
+		body        string
+		out         string
+		status      int
+	}{
+		{s.URL + "/api/v1/ip/batch", jsonMediaType, `["1.3.3.7", "foo"]`, "[\n  " + fmt.Sprintf(result, "1.3.3.7", "1.3.3.7", 16974599, "    \"ip_hex\": \"0x01030307\",\n    \"ip_octal\": \"0100601407\",\n    \"ip_binary\": \"00000001.00000011.00000011.00000111\",\n    \"ip_dotted_octal\": \"0001.0003.0003.0007\",\n    \"reverse_pointer\": \"7.3.3.1.in-addr.arpa\",\n", 4, "public", false) + ",\n  {\n    \"query\": \"foo\",\n    \"error\": \"invalid IP address\"\n  }\n]", 200},
+		{s.URL + "/api/v1/ip/batch", "", "\n1.3.3.7\n\n[::1]\n", "[\n  " + fmt.Sprintf(result, "1.3.3.7", "1.3.3.7", 16974599, "    \"ip_hex\": \"0x01030307\",\n    \"ip_octal\": \"0100601407\",\n    \"ip_binary\": \"00000001.00000011.00000011.00000111\",\n    \"ip_dotted_octal\": \"0001.0003.0003.0007\",\n    \"reverse_pointer\": \"7.3.3.1.in-addr.arpa\",\n", 4, "public", false) + ",\n  " + fmt.Sprintf(result, "[::1]", "::1", 1, "    \"ip_hex\": \"0x00000000000000000000000000000001\",\n    \"ip_octal\": \"01\",\n    \"ip_binary\": \"0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000000:0000000000000001\",\n    \"reverse_pointer\": \"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa\",\n", 6, "loopback", true) + "\n]", 200},
+		{s.URL + "/api/v1/ip/batch", "", "  []", "[]", 200},
+		{s.URL + "/api/v1/ip/batch", "", "1.1.1.1\n2.2.2.2\n3.3.3.3\n", "{\n  \"status\": 400,\n  \"error\": \"batch exceeds limit of 2 addresses\"\n}", 400},
+		{s.URL + "/api/v1/ip/batch", jsonMediaType, `{"ip": "1.1.1.1"}`, "{\n  \"status\": 400,\n  \"error\": \"expected JSON array of IP addresses\"\n}", 400},
+		{s.URL + "/api/v1/ip/batch", jsonMediaType, `["foo", 5]`, "[\n  {\n    \"query\": \"foo\",\n    \"error\": \"invalid IP address\"\n  },\n  {\n    \"query\": \"5\",\n    \"error\": \"expected IP address string\"\n  }\n]", 200},
+		{s.URL + "/api/v1/ip/batch?stream=true", jsonMediaType, `{"ip": "1.1.1.1"}`, "{\n  \"status\": 400,\n  \"error\": \"expected JSON array of IP addresses\"\n}", 400},
+		{s.URL + "/api/v1/ip/batch?stream=true", "", "foo\nbar\nbaz\n", "{\"query\":\"foo\",\"error\":\"invalid IP address\"}\n{\"query\":\"bar\",\"error\":\"invalid IP address\"}\n{\"error\":\"batch exceeds limit of 2 addresses\"}\n", 200},
+	}
+
+	for _, tt := range tests {
+		out, status, err := httpPostType(tt.url, tt.contentType, tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %q, got %d", tt.status, tt.body, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %q, got %q", tt.out, tt.body, out)
+		}
+	}
+}
+
+func TestBatchConcurrency(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	var active, maxActive int
+	var mu sync.Mutex
+	srv.LookupAddr = func(ip net.IP) (string, error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return "host-" + ip.String(), nil
+	}
+	s := httptest.NewServer(srv.Handler())
+
+	var queries []string
+	for i := 1; i <= 3*batchConcurrency; i++ {
+		queries = append(queries, fmt.Sprintf("192.0.2.%d", i))
+	}
+	out, status, err := httpPostType(s.URL+"/api/v1/ip/batch", "", strings.Join(queries, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 200 {
+		t.Fatalf("Expected 200, got %d: %s", status, out)
+	}
+	var results []BatchResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(queries) {
+		t.Fatalf("Expected %d results, got %d", len(queries), len(results))
+	}
+	for i, r := range results {
+		if r.Query != queries[i] || r.Hostname != "host-"+queries[i] {
+			t.Errorf("Result %d = %s with hostname %s, want %s", i, r.Query, r.Hostname, queries[i])
+		}
+	}
+	if maxActive < 2 || maxActive > batchConcurrency {
+		t.Errorf("Expected between 2 and %d concurrent lookups, got %d", batchConcurrency, maxActive)
+	}
+}
+
+func TestLookupCacheGroups(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	var calls int
+	srv.LookupAddr = func(net.IP) (string, error) {
+		calls++
+		return "localhost", nil
+	}
+	s := httptest.NewServer(srv.Handler())
+
+	// Partial lookups are cached and extended by later requests, without
+	// repeating the reverse lookup
+	for _, tt := range []struct {
+		url   string
+		out   string
+		calls int
+	}{
+		{s.URL + "/country", "Elbonia\n", 0},
+		{s.URL + "/hostname", "localhost\n", 1},
+		{s.URL + "/hostname", "localhost\n", 1},
+		{s.URL + "/json?fields=hostname,city", "{\n  \"city\": \"Bornyasherk\",\n  \"hostname\": \"localhost\"\n}", 1},
+		{s.URL + "/country", "Elbonia\n", 1},
+	} {
+		out, _, err := httpGet(tt.url, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+		if calls != tt.calls {
+			t.Errorf("Expected %d reverse lookups after %s, got %d", tt.calls, tt.url, calls)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// qualityValue is an element of a header such as Accept or Accept-Language
+// with its quality value.
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// qualityValues parses a comma separated header value with optional quality
+// values, ordered by decreasing quality. Values are lower-cased.
+func qualityValues(header string) []qualityValue {
+	var values []qualityValue
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		values = append(values, qualityValue{value, q})
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].q > values[j].q })
+	return values
+}
+
+// requestLanguages returns the languages for place names requested by r,
+// most preferred first. The lang query parameter takes precedence over the
+// Accept-Language header.
+func requestLanguages(r *http.Request) []string {
+	if r.URL != nil {
+		if lang := r.URL.Query().Get("lang"); lang != "" {
+			return []string{strings.ToLower(lang)}
+		}
+	}
+	var langs []string
+	for _, v := range qualityValues(r.Header.Get("Accept-Language")) {
+		if v.q <= 0 {
+			break
+		}
+		langs = append(langs, v.value)
+	}
+	return langs
+}
+
+// localName returns the name for the first of langs that names has a
+// translation for, or name if there is none. A language without a region
+// matches the same language with any region, and vice versa, so that de-AT
+// matches de and pt matches pt-BR. Among several such matches, the language
+// without a region is preferred, then the first region in sorted order.
+func localName(names map[string]string, name string, langs []string) string {
+	if len(names) == 0 {
+		return name
+	}
+	var tags []string
+	for _, lang := range langs {
+		if lang == "*" {
+			break
+		}
+		for tag, local := range names {
+			if strings.EqualFold(tag, lang) {
+				return local
+			}
+		}
+		if tags == nil {
+			for tag := range names {
+				tags = append(tags, tag)
+			}
+			// A language sorts before its regions
+			sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+		}
+		base, region, _ := strings.Cut(lang, "-")
+		for _, tag := range tags {
+			tagBase, tagRegion, _ := strings.Cut(strings.ToLower(tag), "-")
+			if base == tagBase && (region == "" || tagRegion == "") {
+				return names[tag]
+			}
+		}
+	}
+	return name
+}
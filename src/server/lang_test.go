@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequestLanguages(t *testing.T) {
+	var tests = []struct {
+		url            string
+		acceptLanguage string
+		out            []string
+	}{
+		{"/", "", nil},
+		{"/", "de-DE,de;q=0.9,en;q=0.8", []string{"de-de", "de", "en"}},
+		{"/", "en;q=0.5, ja", []string{"ja", "en"}},
+		{"/", "fr, *;q=0.1, en;q=0", []string{"fr", "*"}},
+		{"/?lang=pt-BR", "de", []string{"pt-br"}},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", tt.url, nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		if out := requestLanguages(r); !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("requestLanguages(%s, %q) = %q, want %q", tt.url, tt.acceptLanguage, out, tt.out)
+		}
+	}
+}
+
+func TestLocalName(t *testing.T) {
+	names := map[string]string{"en": "Germany", "de": "Deutschland", "ja": "ドイツ", "pt-BR": "Alemanha", "zh-CN": "德国"}
+	var tests = []struct {
+		langs []string
+		out   string
+	}{
+		{nil, "Germany"},
+		{[]string{"de"}, "Deutschland"},
+		{[]string{"de-at"}, "Deutschland"},
+		{[]string{"pt"}, "Alemanha"},
+		{[]string{"pt-br"}, "Alemanha"},
+		{[]string{"zh-tw"}, "Germany"},
+		{[]string{"sv", "ja"}, "ドイツ"},
+		{[]string{"*", "ja"}, "Germany"},
+	}
+	for _, tt := range tests {
+		if out := localName(names, "Germany", tt.langs); out != tt.out {
+			t.Errorf("localName(%q) = %q, want %q", tt.langs, out, tt.out)
+		}
+	}
+	regional := map[string]string{"zh-TW": "德國", "zh-CN": "德国", "pt-PT": "Alemanha", "pt": "Alemanha (pt)", "pt-BR": "Alemanha (BR)"}
+	for i := 0; i < 10; i++ {
+		if out := localName(regional, "Germany", []string{"zh"}); out != "德国" {
+			t.Errorf("localName(zh) = %q, want the first region 德国", out)
+		}
+		if out := localName(regional, "Germany", []string{"pt"}); out != "Alemanha (pt)" {
+			t.Errorf("localName(pt) = %q, want the language without region", out)
+		}
+	}
+	if out := localName(nil, "Elbonia", []string{"de"}); out != "Elbonia" {
+		t.Errorf("localName without names = %q, want Elbonia", out)
+	}
+}
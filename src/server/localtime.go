@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// localTimeFields holds the Response fields describing the current time in
+// the time zone of the address. They are only computed on request, since they
+// change with every request and cannot be cached.
+var localTimeFields = map[string]bool{
+	"local_time":             true,
+	"utc_offset":             true,
+	"time_zone_abbreviation": true,
+	"is_dst":                 true,
+	"next_transition":        true,
+}
+
+// wantLocalTime reports whether responses to r should include the local time
+// fields, requested with time=true or by selecting one of them.
+func wantLocalTime(r *http.Request) bool {
+	return wantOptional(r, "time", localTimeFields)
+}
+
+// setLocalTime sets the local time fields of r for the instant now. They are
+// left empty if the time zone is unknown.
+func (r *Response) setLocalTime(now time.Time) {
+	if r.Timezone == "" {
+		return
+	}
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return
+	}
+	t := now.In(loc)
+	abbreviation, _ := t.Zone()
+	dst := t.IsDST()
+	r.LocalTime = t.Format(time.RFC3339)
+	r.UTCOffset = t.Format("-07:00")
+	r.TimezoneAbbreviation = abbreviation
+	r.IsDST = &dst
+	if _, end := t.ZoneBounds(); !end.IsZero() {
+		r.NextTransition = end.In(loc).Format(time.RFC3339)
+	}
+}
+
+// now returns the current time, which tests can fix by setting s.clock.
+func (s *Server) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// CLITimeHandler handles /time requests with the current local time of the
+// address in RFC 3339 format, or an empty line if its time zone is unknown.
+func (s *Server) CLITimeHandler(w http.ResponseWriter, r *http.Request) *appError {
+	ip, err := ipFromRequest(s.IPHeaders, r, true)
+	if err != nil {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	response := s.lookupIP(ip, cityLookup)
+	response.setLocalTime(s.now())
+	fmt.Fprintln(w, response.LocalTime)
+	return nil
+}
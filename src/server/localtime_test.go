@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/echoip/src/overrides"
+)
+
+func TestLocalTime(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.clock = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+	srv.LookupOverride = func(ip net.IP) (overrides.Override, bool) {
+		if ip.Equal(net.ParseIP("1.3.3.7")) {
+			return overrides.Override{Network: "1.3.3.0/24", Timezone: "Europe/Oslo"}, true
+		}
+		return overrides.Override{}, false
+	}
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	oslo := "{\n  \"time_zone\": \"Europe/Oslo\",\n  \"local_time\": \"2026-10-17T14:00:00+02:00\",\n  \"utc_offset\": \"+02:00\",\n  \"time_zone_abbreviation\": \"CEST\",\n  \"is_dst\": true,\n  \"next_transition\": \"2026-10-25T02:00:00+01:00\"\n}"
+	var tests = []struct {
+		url string
+		out string
+	}{
+		{"/1.3.3.7?fields=time_zone,local_time,utc_offset,time_zone_abbreviation,is_dst,next_transition", oslo},
+		{"/1.3.3.7?fields=time_zone,utc_offset&time=false", "{\n  \"time_zone\": \"Europe/Oslo\",\n  \"utc_offset\": \"+02:00\"\n}"},
+		{"/1.3.3.7?fields=time_zone,local_time", "{\n  \"time_zone\": \"Europe/Oslo\",\n  \"local_time\": \"2026-10-17T14:00:00+02:00\"\n}"},
+		{"/json?fields=time_zone,local_time", "{\n  \"time_zone\": \"Europe/Bornyasherk\"\n}"},
+		{"/time?ip=1.3.3.7", "2026-10-17T14:00:00+02:00\n"},
+		{"/api/v1/is-dst?ip=1.3.3.7", "true\n"},
+		{"/time", "\n"},
+	}
+	for _, tt := range tests {
+		out, _, err := httpGet(s.URL+tt.url, jsonMediaType, "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+
+	// Without a selection, the fields are only included on request
+	out, _, err := httpGet(s.URL+"/1.3.3.7", jsonMediaType, "curl/7.2.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTime, _, err := httpGet(s.URL+"/1.3.3.7?time=true", jsonMediaType, "curl/7.2.6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "local_time") || !strings.Contains(withTime, "\"local_time\": \"2026-10-17T14:00:00+02:00\"") {
+		t.Errorf("Expected local_time only with time=true, got %q and %q", out, withTime)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iplist"
+	"github.com/apimgr/echoip/src/iputil"
+)
+
+// ListMatch is a list that contains an address.
+type ListMatch struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Score int    `json:"score"`
+}
+
+// ReputationResponse holds the lists that contain an address and the
+// reputation score they add up to.
+type ReputationResponse struct {
+	IP          net.IP      `json:"ip"`
+	Score       int         `json:"score"`
+	Blocklisted bool        `json:"blocklisted"`
+	Lists       []ListMatch `json:"lists"`
+}
+
+// ReputationHandler handles /api/v1/reputation/{ip} requests, and
+// /api/v1/reputation requests for the address of the client.
+func (s *Server) ReputationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	var ip net.IP
+	if ipStr := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/reputation"), "/"); ipStr != "" {
+		if ip = iputil.ParseIP(ipStr); ip == nil {
+			return badRequest(fmt.Errorf("invalid IP address")).WithMessage("Invalid IP address: " + ipStr).AsJSON()
+		}
+	} else {
+		var err error
+		if ip, err = ipFromRequest(s.IPHeaders, r, true); err != nil {
+			return badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+	}
+	matches := s.LookupLists(ip)
+	response := ReputationResponse{IP: ip, Score: iplist.Score(matches), Lists: []ListMatch{}}
+	for _, m := range matches {
+		response.Lists = append(response.Lists, ListMatch{Name: m.Name, Kind: string(m.Kind), Score: m.Score})
+		response.Blocklisted = response.Blocklisted || m.Kind == iplist.Blocklist
+	}
+	return writeFormatted(w, r, response)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/echoip/src/iputil"
+	"github.com/apimgr/echoip/src/iputil/subnet"
+)
+
+// maxSubnets limits the number of networks a split may return.
+const maxSubnets = 4096
+
+// SubnetResponse describes a network and the results of the operations
+// requested for it.
+type SubnetResponse struct {
+	Network      string   `json:"network"`
+	IPVersion    int      `json:"ip_version"`
+	PrefixLength int      `json:"prefix_length"`
+	Netmask      string   `json:"netmask"`
+	Wildcard     string   `json:"wildcard"`
+	Broadcast    string   `json:"broadcast,omitempty"`
+	FirstHost    string   `json:"first_host"`
+	LastHost     string   `json:"last_host"`
+	Addresses    *big.Int `json:"addresses"`
+	Hosts        *big.Int `json:"hosts"`
+	Category     string   `json:"category"`
+	Expanded     string   `json:"expanded,omitempty"`
+	Subnets64    *big.Int `json:"subnets_64,omitempty"`
+	ReverseZone  string   `json:"reverse_zone,omitempty"`
+	IP           string   `json:"ip,omitempty"`
+	Contains     *bool    `json:"contains,omitempty"`
+	Supernet     string   `json:"supernet,omitempty"`
+	Subnets      []string `json:"subnets,omitempty"`
+}
+
+// AggregateResponse holds the networks summarizing those of a request.
+type AggregateResponse struct {
+	Networks []string `json:"networks"`
+}
+
+// reverseZone returns the DNS zone for reverse lookups of the addresses in n,
+// or an empty string if the prefix length does not end on a label boundary.
+func reverseZone(n *net.IPNet) string {
+	ones, size := n.Mask.Size()
+	bitsPerLabel := 8
+	if size == 128 {
+		bitsPerLabel = 4
+	}
+	if ones%bitsPerLabel != 0 {
+		return ""
+	}
+	labels := strings.Split(iputil.ReversePointer(n.IP), ".")
+	// Keep the labels of the prefix and the in-addr.arpa or ip6.arpa suffix
+	return strings.Join(labels[len(labels)-2-ones/bitsPerLabel:], ".")
+}
+
+// expandIPv6 returns ip with all leading zeros.
+func expandIPv6(ip net.IP) string {
+	b := ip.To16()
+	groups := make([]string, len(b)/2)
+	for i := range groups {
+		groups[i] = fmt.Sprintf("%02x%02x", b[2*i], b[2*i+1])
+	}
+	return strings.Join(groups, ":")
+}
+
+func newSubnetResponse(r *http.Request, cidr string) (SubnetResponse, error) {
+	n, err := subnet.Parse(cidr)
+	if err != nil {
+		return SubnetResponse{}, err
+	}
+	info := subnet.Describe(n)
+	ones, size := n.Mask.Size()
+	response := SubnetResponse{
+		Network:      n.String(),
+		IPVersion:    iputil.Version(n.IP),
+		PrefixLength: ones,
+		Netmask:      info.Netmask.String(),
+		Wildcard:     info.Wildcard.String(),
+		FirstHost:    info.FirstHost.String(),
+		LastHost:     info.LastHost.String(),
+		Addresses:    info.Addresses,
+		Hosts:        info.Hosts,
+		Category:     iputil.Classify(n.IP).Category,
+		ReverseZone:  reverseZone(n),
+	}
+	if info.Broadcast != nil {
+		response.Broadcast = info.Broadcast.String()
+	}
+	if size == 128 {
+		response.Expanded = expandIPv6(n.IP)
+		if ones <= 64 {
+			response.Subnets64 = new(big.Int).Lsh(big.NewInt(1), uint(64-ones))
+		}
+	}
+	q := r.URL.Query()
+	if v := q.Get("contains"); v != "" {
+		ip := iputil.ParseIP(v)
+		if ip == nil {
+			return SubnetResponse{}, fmt.Errorf("invalid IP address: %s", v)
+		}
+		contains := subnet.Contains(n, ip)
+		response.IP = ip.String()
+		response.Contains = &contains
+	}
+	if v := q.Get("supernet"); v != "" {
+		length, err := strconv.Atoi(strings.TrimPrefix(v, "/"))
+		if err != nil {
+			return SubnetResponse{}, fmt.Errorf("invalid prefix length: %s", v)
+		}
+		supernet, err := subnet.Supernet(n, length)
+		if err != nil {
+			return SubnetResponse{}, err
+		}
+		response.Supernet = supernet.String()
+	}
+	if v := q.Get("split"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 1 || count > maxSubnets {
+			return SubnetResponse{}, fmt.Errorf("number of networks must be between 1 and %d: %s", maxSubnets, v)
+		}
+		subnets, err := subnet.Split(n, count)
+		if err != nil {
+			return SubnetResponse{}, err
+		}
+		for _, s := range subnets {
+			response.Subnets = append(response.Subnets, s.String())
+		}
+	}
+	return response, nil
+}
+
+// SubnetHandler handles /api/v1/subnet/{cidr} requests. The split, supernet
+// and contains query parameters split the network into the given number of
+// networks, widen it to the given prefix length and test whether it contains
+// an address.
+func (s *Server) SubnetHandler(w http.ResponseWriter, r *http.Request) *appError {
+	response, err := newSubnetResponse(r, strings.TrimPrefix(r.URL.Path, "/api/v1/subnet/"))
+	if err != nil {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	return writeFormatted(w, r, response)
+}
+
+// CLISubnetHandler handles /subnet/{cidr} requests like SubnetHandler, but
+// responds with plain text.
+func (s *Server) CLISubnetHandler(w http.ResponseWriter, r *http.Request) *appError {
+	response, err := newSubnetResponse(r, strings.TrimPrefix(r.URL.Path, "/subnet/"))
+	if err != nil {
+		return badRequest(err).WithMessage(err.Error()).AsJSON()
+	}
+	fields, err := toFields(response)
+	if err != nil {
+		return internalServerError(err).AsJSON()
+	}
+	encodeText(w, fields)
+	return nil
+}
+
+// encodeText writes one field per line with aligned values. Arrays continue
+// on the following lines, one value per line.
+func encodeText(w io.Writer, fields []field) {
+	width := 0
+	for _, f := range fields {
+		if len(f.Key) > width {
+			width = len(f.Key)
+		}
+	}
+	for _, f := range fields {
+		if values, ok := f.Value.([]interface{}); ok {
+			fmt.Fprintf(w, "%s:\n", f.Key)
+			for _, v := range values {
+				fmt.Fprintf(w, "  %s\n", scalarString(v))
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%-*s %s\n", width+1, f.Key+":", scalarString(f.Value))
+	}
+}
+
+// aggregate reads the networks of an aggregate request, at most as many as
+// the batch limit.
+func (s *Server) aggregate(w http.ResponseWriter, r *http.Request) ([]string, *appError) {
+	limit := s.batchLimit()
+	body := http.MaxBytesReader(w, r.Body, int64(limit)*maxBatchItemSize)
+	br := newBatchReader(r, body)
+	var networks []*net.IPNet
+	for {
+		query, ok, err := br.Next()
+		if err != nil {
+			return nil, badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		if !ok {
+			break
+		}
+		if len(networks) == limit {
+			err := fmt.Errorf("aggregate exceeds limit of %d networks", limit)
+			return nil, badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		if query.err != "" {
+			err := fmt.Errorf("invalid network: %s", query.text)
+			return nil, badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		n, err := subnet.Parse(query.text)
+		if err != nil {
+			return nil, badRequest(err).WithMessage(err.Error()).AsJSON()
+		}
+		networks = append(networks, n)
+	}
+	aggregated := []string{}
+	for _, n := range subnet.Aggregate(networks) {
+		aggregated = append(aggregated, n.String())
+	}
+	return aggregated, nil
+}
+
+// AggregateHandler handles POST /api/v1/subnet/aggregate requests, whose body
+// lists networks like a batch lookup.
+func (s *Server) AggregateHandler(w http.ResponseWriter, r *http.Request) *appError {
+	networks, appErr := s.aggregate(w, r)
+	if appErr != nil {
+		return appErr
+	}
+	return writeFormatted(w, r, AggregateResponse{Networks: networks})
+}
+
+// CLIAggregateHandler handles POST /subnet/aggregate requests, responding with
+// one network per line.
+func (s *Server) CLIAggregateHandler(w http.ResponseWriter, r *http.Request) *appError {
+	networks, appErr := s.aggregate(w, r)
+	if appErr != nil {
+		return appErr
+	}
+	for _, n := range networks {
+		fmt.Fprintln(w, n)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubnetHandler(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	s := httptest.NewServer(testServer().Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url    string
+		out    string
+		status int
+	}{
+		{"/api/v1/subnet/192.168.1.77/24", "{\n  \"network\": \"192.168.1.0/24\",\n  \"ip_version\": 4,\n  \"prefix_length\": 24,\n  \"netmask\": \"255.255.255.0\",\n  \"wildcard\": \"0.0.0.255\",\n  \"broadcast\": \"192.168.1.255\",\n  \"first_host\": \"192.168.1.1\",\n  \"last_host\": \"192.168.1.254\",\n  \"addresses\": 256,\n  \"hosts\": 254,\n  \"category\": \"private\",\n  \"reverse_zone\": \"1.168.192.in-addr.arpa\"\n}", 200},
+		{"/api/v1/subnet/2001:db8::/48", "{\n  \"network\": \"2001:db8::/48\",\n  \"ip_version\": 6,\n  \"prefix_length\": 48,\n  \"netmask\": \"ffff:ffff:ffff::\",\n  \"wildcard\": \"::ffff:ffff:ffff:ffff:ffff\",\n  \"first_host\": \"2001:db8::\",\n  \"last_host\": \"2001:db8:0:ffff:ffff:ffff:ffff:ffff\",\n  \"addresses\": 1208925819614629174706176,\n  \"hosts\": 1208925819614629174706176,\n  \"category\": \"documentation\",\n  \"expanded\": \"2001:0db8:0000:0000:0000:0000:0000:0000\",\n  \"subnets_64\": 65536,\n  \"reverse_zone\": \"0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa\"\n}", 200},
+		{"/api/v1/subnet/10.0.0.0/8?fields=network,ip,contains,supernet,subnets&contains=10.1.2.3&supernet=7&split=2", "{\n  \"network\": \"10.0.0.0/8\",\n  \"ip\": \"10.1.2.3\",\n  \"contains\": true,\n  \"supernet\": \"10.0.0.0/7\",\n  \"subnets\": [\n    \"10.0.0.0/9\",\n    \"10.128.0.0/9\"\n  ]\n}", 200},
+		{"/api/v1/subnet/10.0.0.0/8?fields=contains&contains=2001:db8::1", "{\n  \"contains\": false\n}", 200},
+		{"/api/v1/subnet/10.0.0.0/8?format=csv&fields=network,subnets&split=2", "network,subnets\n10.0.0.0/8,\"10.0.0.0/9,10.128.0.0/9\"\n", 200},
+		{"/subnet/10.0.0.0/30?split=2", "network:       10.0.0.0/30\nip_version:    4\nprefix_length: 30\nnetmask:       255.255.255.252\nwildcard:      0.0.0.3\nbroadcast:     10.0.0.3\nfirst_host:    10.0.0.1\nlast_host:     10.0.0.2\naddresses:     4\nhosts:         2\ncategory:      private\nsubnets:\n  10.0.0.0/31\n  10.0.0.2/31\n", 200},
+		{"/api/v1/subnet/10.0.0.0/33", "{\n  \"status\": 400,\n  \"error\": \"invalid prefix length: 33\"\n}", 400},
+		{"/api/v1/subnet/10.0.0.0/8?supernet=8", "{\n  \"status\": 400,\n  \"error\": \"invalid prefix length for supernet of 10.0.0.0/8: 8\"\n}", 400},
+		{"/api/v1/subnet/10.0.0.0/8?split=5000", "{\n  \"status\": 400,\n  \"error\": \"number of networks must be between 1 and 4096: 5000\"\n}", 400},
+		{"/api/v1/subnet/10.0.0.0/8?split=3", "{\n  \"status\": 400,\n  \"error\": \"number of networks must be a power of two: 3\"\n}", 400},
+		{"/api/v1/subnet/10.0.0.0/31?split=4", "{\n  \"status\": 400,\n  \"error\": \"cannot split 10.0.0.0/31 into 4 networks\"\n}", 400},
+	}
+	for _, tt := range tests {
+		out, status, err := httpGet(s.URL+tt.url, "", "curl/7.2.6.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %s, got %d", tt.status, tt.url, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.url, out)
+		}
+	}
+}
+
+func TestAggregateHandler(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	srv := testServer()
+	srv.BatchLimit = 3
+	s := httptest.NewServer(srv.Handler())
+	defer s.Close()
+
+	var tests = []struct {
+		url         string
+		contentType string
+		body        string
+		out         string
+		status      int
+	}{
+		{"/api/v1/subnet/aggregate", jsonMediaType, `["10.0.0.0/25", "10.0.0.128/25", "2001:db8::/48"]`, "{\n  \"networks\": [\n    \"10.0.0.0/24\",\n    \"2001:db8::/48\"\n  ]\n}", 200},
+		{"/api/v1/subnet/aggregate", "", "", "{\n  \"networks\": []\n}", 200},
+		{"/subnet/aggregate", "", "10.0.1.0/24\n10.0.0.0/24\n", "10.0.0.0/23\n", 200},
+		{"/subnet/aggregate", "", "10.0.0.0/24\nfoo\n", "{\n  \"status\": 400,\n  \"error\": \"invalid network: foo\"\n}", 400},
+		{"/api/v1/subnet/aggregate", jsonMediaType, `["10.0.0.0/24", 5]`, "{\n  \"status\": 400,\n  \"error\": \"invalid network: 5\"\n}", 400},
+		{"/api/v1/subnet/aggregate", "", "10.0.0.0/8\n10.0.0.0/8\n10.0.0.0/8\n10.0.0.0/8\n", "{\n  \"status\": 400,\n  \"error\": \"aggregate exceeds limit of 3 networks\"\n}", 400},
+	}
+	for _, tt := range tests {
+		out, status, err := httpPostType(s.URL+tt.url, tt.contentType, tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != tt.status {
+			t.Errorf("Expected %d for %q, got %d", tt.status, tt.body, status)
+		}
+		if out != tt.out {
+			t.Errorf("Expected %q for %q, got %q", tt.out, tt.body, out)
+		}
+	}
+}